@@ -0,0 +1,417 @@
+//go:build wasm
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/extism/go-pdk"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// The journal is stored in fixed-size segments under keyAuditSegmentPrefix,
+// with an MPC-signed checkpoint under KeyAuditHead. Entries are only hash
+// chained when recorded; the checkpoint is re-signed every
+// auditCheckpointInterval entries and on export, so signing stays a single
+// MPC round. Only the newest auditRetainedSegments segments are kept; older
+// ones are pruned and the checkpoint records where the retained chain starts.
+const (
+	KeyAuditHead            = "audit_log/head"
+	keyAuditSegmentPrefix   = "audit_log/"
+	auditSegmentSize        = 256
+	auditRetainedSegments   = 8
+	auditCheckpointInterval = 64
+	AuditCheckpointJWTType  = "audit-checkpoint+jwt"
+)
+
+// Audited operation types
+const (
+	AuditOpSignData    = "sign_data"
+	AuditOpSessionSign = "session_sign"
+	AuditOpUCAN        = "ucan"
+	AuditOpJWT         = "jwt"
+	AuditOpChainCode   = "chain_code"
+)
+
+// auditGenesisHash is the prev_hash of the first journal entry
+var auditGenesisHash = strings.Repeat("0", sha256.Size*2)
+
+// AuditEntry records a single signing operation. Each entry commits to its
+// predecessor through PrevHash, so rewriting history breaks the chain.
+type AuditEntry struct {
+	Seq          uint64 `json:"seq"`
+	Timestamp    int64  `json:"timestamp"`
+	Operation    string `json:"operation"`
+	Type         string `json:"type,omitempty"`
+	Digest       string `json:"digest"`
+	Signer       string `json:"signer"`
+	Audience     string `json:"audience,omitempty"`
+	Capabilities string `json:"capabilities,omitempty"`
+	Status       string `json:"status"`
+	PrevHash     string `json:"prev_hash"`
+	Hash         string `json:"hash"`
+}
+
+// AuditRecord is the caller-supplied part of an audit entry
+type AuditRecord struct {
+	Operation    string
+	Type         string
+	Data         []byte
+	Signer       string
+	Audience     string
+	Capabilities string
+	Err          error
+}
+
+// AuditCheckpoint is the signed head of the journal. It pins the last entry,
+// so truncating or rewriting the chain no longer verifies, and the first
+// retained entry, so pruned segments are accounted for.
+type AuditCheckpoint struct {
+	Seq           uint64 `json:"seq"`
+	Hash          string `json:"hash"`
+	First         uint64 `json:"first"`
+	FirstPrevHash string `json:"first_prev_hash"`
+}
+
+// AuditJournal is a hash-chained, append-only log of signing operations,
+// mirrored to the plugin vars so it survives across calls
+type AuditJournal struct {
+	mu      sync.Mutex
+	entries []AuditEntry
+	// checkpoint is the signed token for head, the last checkpointed entry
+	checkpoint string
+	head       AuditCheckpoint
+	sign       func(AuditCheckpoint) (string, error)
+	err        error
+}
+
+// LoadAuditJournal restores the journal from the plugin vars. sign issues
+// head checkpoints and verify checks the stored one. A journal that fails
+// verification is kept for export but refuses further entries.
+func LoadAuditJournal(sign func(AuditCheckpoint) (string, error), verify func(string) (*AuditCheckpoint, error)) *AuditJournal {
+	j := &AuditJournal{sign: sign}
+
+	head := pdk.GetVar(KeyAuditHead)
+	if head == nil {
+		if pdk.GetVar(auditSegmentKey(0)) != nil {
+			j.fail(errors.New("journal segments are present without a signed head"))
+		}
+		return j
+	}
+
+	checkpoint, err := verify(string(head))
+	if err != nil {
+		j.fail(fmt.Errorf("invalid head checkpoint: %w", err))
+		return j
+	}
+	// Entries recorded after the checkpoint may spill into the next segment
+	entries, err := loadAuditSegments(checkpoint.First, checkpoint.Seq, checkpoint.Seq+auditCheckpointInterval)
+	if err != nil {
+		j.fail(err)
+		return j
+	}
+	j.entries = entries
+	j.checkpoint = string(head)
+	j.head = *checkpoint
+	if err := verifyCheckpointedEntries(entries, checkpoint); err != nil {
+		j.fail(err)
+	}
+	return j
+}
+
+// Record appends an entry for a signing operation, signing a new checkpoint
+// every auditCheckpointInterval entries. It fails when the journal did not
+// verify or the entry cannot be committed; callers must then withhold the
+// result of the operation.
+func (j *AuditJournal) Record(rec AuditRecord) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.err != nil {
+		return NewEnclaveError(ErrCodeAuditLogInvalid, "audit log failed verification: %v", j.err)
+	}
+
+	digest := sha256.Sum256(rec.Data)
+	entry := AuditEntry{
+		Timestamp:    time.Now().Unix(),
+		Operation:    rec.Operation,
+		Type:         rec.Type,
+		Digest:       hex.EncodeToString(digest[:]),
+		Signer:       rec.Signer,
+		Audience:     rec.Audience,
+		Capabilities: rec.Capabilities,
+		Status:       "ok",
+		PrevHash:     auditGenesisHash,
+	}
+	if rec.Err != nil {
+		entry.Status = "error"
+	}
+	if n := len(j.entries); n > 0 {
+		entry.Seq = j.entries[n-1].Seq + 1
+		entry.PrevHash = j.entries[n-1].Hash
+	}
+	entry.Hash = hashAuditEntry(entry)
+
+	entries := append(j.entries, entry)
+	segment := entry.Seq / auditSegmentSize
+	var pruned []uint64
+	if segment >= auditRetainedSegments && entry.Seq%auditSegmentSize == 0 {
+		oldest := (segment - auditRetainedSegments + 1) * auditSegmentSize
+		for len(entries) > 0 && entries[0].Seq < oldest {
+			entries = entries[1:]
+		}
+		pruned = append(pruned, segment-auditRetainedSegments)
+	}
+
+	// Pruning always falls on a checkpoint, so the signed head never points
+	// at a removed segment
+	var checkpoint string
+	head := AuditCheckpoint{
+		Seq:           entry.Seq,
+		Hash:          entry.Hash,
+		First:         entries[0].Seq,
+		FirstPrevHash: entries[0].PrevHash,
+	}
+	if entry.Seq%auditCheckpointInterval == 0 {
+		var err error
+		if checkpoint, err = j.sign(head); err != nil {
+			return NewEnclaveError(ErrCodeSigningFailed, "failed to sign audit checkpoint: %v", err)
+		}
+	}
+
+	var current []AuditEntry
+	for _, e := range entries {
+		if e.Seq/auditSegmentSize == segment {
+			current = append(current, e)
+		}
+	}
+	data, err := json.Marshal(current)
+	if err != nil {
+		return NewEnclaveError(ErrCodeOperationFailed, "failed to serialize audit segment: %v", err)
+	}
+
+	pdk.SetVar(auditSegmentKey(segment), data)
+	if checkpoint != "" {
+		pdk.SetVar(KeyAuditHead, []byte(checkpoint))
+		j.checkpoint = checkpoint
+		j.head = head
+	}
+	for _, k := range pruned {
+		pdk.RemoveVar(auditSegmentKey(k))
+	}
+
+	j.entries = entries
+	return nil
+}
+
+// Export returns a copy of the retained journal and a checkpoint of its
+// last entry, signing one when the stored checkpoint is behind
+func (j *AuditJournal) Export() ([]AuditEntry, string, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entries := append([]AuditEntry(nil), j.entries...)
+	n := len(j.entries)
+	if j.err != nil || n == 0 || j.head.Seq == j.entries[n-1].Seq {
+		return entries, j.checkpoint, nil
+	}
+
+	last := j.entries[n-1]
+	head := AuditCheckpoint{
+		Seq:           last.Seq,
+		Hash:          last.Hash,
+		First:         j.entries[0].Seq,
+		FirstPrevHash: j.entries[0].PrevHash,
+	}
+	checkpoint, err := j.sign(head)
+	if err != nil {
+		return entries, j.checkpoint, NewEnclaveError(ErrCodeSigningFailed, "failed to sign audit checkpoint: %v", err)
+	}
+	pdk.SetVar(KeyAuditHead, []byte(checkpoint))
+	j.checkpoint = checkpoint
+	j.head = head
+	return entries, checkpoint, nil
+}
+
+// Err reports why the journal was rejected at load, if it was
+func (j *AuditJournal) Err() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.err
+}
+
+func (j *AuditJournal) fail(err error) {
+	j.err = err
+	pdk.Log(pdk.LogError, fmt.Sprintf("Audit log failed verification, signing is disabled: %v", err))
+}
+
+func auditSegmentKey(segment uint64) string {
+	return keyAuditSegmentPrefix + strconv.FormatUint(segment, 10)
+}
+
+// loadAuditSegments reads the segments from first's through last's, and
+// those up to limit's that are present, returning the entries from first on
+func loadAuditSegments(first, last, limit uint64) ([]AuditEntry, error) {
+	var entries []AuditEntry
+	for k := first / auditSegmentSize; k <= limit/auditSegmentSize; k++ {
+		v := pdk.GetVar(auditSegmentKey(k))
+		if v == nil {
+			if k <= last/auditSegmentSize {
+				return nil, fmt.Errorf("audit segment %d is missing", k)
+			}
+			break
+		}
+		var segment []AuditEntry
+		if err := json.Unmarshal(v, &segment); err != nil {
+			return nil, fmt.Errorf("failed to parse audit segment %d: %w", k, err)
+		}
+		for _, e := range segment {
+			if e.Seq >= first {
+				entries = append(entries, e)
+			}
+		}
+	}
+	return entries, nil
+}
+
+// VerifyAuditLog checks a journal against its signed head checkpoint. The
+// enclave's own key verifies its journal; publicKey verifies another's.
+func (s *EnclaveService) VerifyAuditLog(entries []AuditEntry, checkpoint string, publicKey []byte) error {
+	if checkpoint == "" {
+		if len(entries) == 0 {
+			return nil
+		}
+		return errors.New("missing signed head checkpoint")
+	}
+
+	cp, err := s.parseAuditCheckpoint(checkpoint, publicKey)
+	if err != nil {
+		return fmt.Errorf("invalid head checkpoint: %w", err)
+	}
+	return verifyAuditEntries(entries, cp)
+}
+
+// signAuditCheckpoint signs a head checkpoint with the MPC enclave. It does
+// not go through SignJWT, which would record the checkpoint itself.
+func (s *EnclaveService) signAuditCheckpoint(cp AuditCheckpoint) (string, error) {
+	token := jwt.NewWithClaims(s.signingMethod(), jwt.MapClaims{
+		"iss":             s.issuerDID,
+		"iat":             time.Now().Unix(),
+		"seq":             cp.Seq,
+		"hash":            cp.Hash,
+		"first":           cp.First,
+		"first_prev_hash": cp.FirstPrevHash,
+	})
+	token.Header["typ"] = AuditCheckpointJWTType
+	token.Header["kid"] = s.issuerDID + verificationMethodSuffix
+	return token.SignedString(nil)
+}
+
+// parseAuditCheckpoint verifies a signed head checkpoint and decodes it
+func (s *EnclaveService) parseAuditCheckpoint(tokenString string, publicKey []byte) (*AuditCheckpoint, error) {
+	token, err := s.parseSignedJWT(tokenString, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	if typ, _ := token.Header["typ"].(string); typ != AuditCheckpointJWTType {
+		return nil, fmt.Errorf("typ must be %s", AuditCheckpointJWTType)
+	}
+
+	claims, _ := token.Claims.(jwt.MapClaims)
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+	var cp AuditCheckpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("malformed checkpoint claims: %w", err)
+	}
+	return &cp, nil
+}
+
+// verifyAuditEntries checks sequence numbers, entry hashes and chain links
+// from the checkpoint's first entry to its head, reporting the first entry
+// that has been altered, removed or reordered
+func verifyAuditEntries(entries []AuditEntry, cp *AuditCheckpoint) error {
+	if err := verifyAuditChain(entries, cp); err != nil {
+		return err
+	}
+	last := entries[len(entries)-1]
+	if last.Seq != cp.Seq || last.Hash != cp.Hash {
+		return fmt.Errorf("journal ends at entry %d but the signed head is entry %d", last.Seq, cp.Seq)
+	}
+	return nil
+}
+
+// verifyCheckpointedEntries checks a stored journal, which may continue past
+// its checkpoint with entries recorded since. Only the checkpointed part is
+// protected against truncation.
+func verifyCheckpointedEntries(entries []AuditEntry, cp *AuditCheckpoint) error {
+	if err := verifyAuditChain(entries, cp); err != nil {
+		return err
+	}
+	i := cp.Seq - cp.First
+	if i >= uint64(len(entries)) {
+		return fmt.Errorf("journal ends before the signed head, entry %d", cp.Seq)
+	}
+	if entries[i].Hash != cp.Hash {
+		return fmt.Errorf("entry %d does not match the signed head", cp.Seq)
+	}
+	return nil
+}
+
+// verifyAuditChain checks sequence numbers, entry hashes and chain links
+// from the checkpoint's first entry
+func verifyAuditChain(entries []AuditEntry, cp *AuditCheckpoint) error {
+	if cp.First == 0 && cp.FirstPrevHash != auditGenesisHash {
+		return errors.New("checkpoint does not start at the genesis entry")
+	}
+	if len(entries) == 0 {
+		return errors.New("journal is empty but has a signed head")
+	}
+
+	prev := cp.FirstPrevHash
+	for i, entry := range entries {
+		seq := cp.First + uint64(i)
+		if entry.Seq != seq {
+			return fmt.Errorf("entry %d has sequence %d", seq, entry.Seq)
+		}
+		if entry.PrevHash != prev {
+			return fmt.Errorf("entry %d does not link to its predecessor", seq)
+		}
+		if hashAuditEntry(entry) != entry.Hash {
+			return fmt.Errorf("entry %d hash mismatch", seq)
+		}
+		prev = entry.Hash
+	}
+	return nil
+}
+
+// hashAuditEntry hashes every field of the entry except Hash itself
+func hashAuditEntry(entry AuditEntry) string {
+	entry.Hash = ""
+	data, _ := json.Marshal(entry)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// summarizeCapabilities renders attenuations as "ability@resource" pairs
+func summarizeCapabilities(attenuations []map[string]any) string {
+	return formatCapabilities(capabilitiesFromAttenuations(attenuations))
+}
+
+func formatCapabilities(caps []Capability) string {
+	parts := make([]string, len(caps))
+	for i, c := range caps {
+		parts[i] = c.Ability + "@" + c.Resource
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,278 @@
+//go:build wasm
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// W3C VC Data Model 2.0 constants. Credentials are secured as JWTs per
+// VC-JOSE-COSE: the JWT payload is the credential itself.
+const (
+	CredentialsContextV2     = "https://www.w3.org/ns/credentials/v2"
+	CredentialType           = "VerifiableCredential"
+	CredentialJWTType        = "vc+jwt"
+	DefaultCredentialTTL     = 365 * 24 * time.Hour
+	credentialTimeFormat     = time.RFC3339
+	verificationMethodSuffix = "#mpc-1"
+)
+
+// VerifiableCredential is a W3C VC Data Model 2.0 credential
+type VerifiableCredential struct {
+	Context           []string       `json:"@context"`
+	ID                string         `json:"id,omitempty"`
+	Type              []string       `json:"type"`
+	Issuer            string         `json:"issuer"`
+	ValidFrom         string         `json:"validFrom,omitempty"`
+	ValidUntil        string         `json:"validUntil,omitempty"`
+	CredentialSubject map[string]any `json:"credentialSubject"`
+	CredentialStatus  map[string]any `json:"credentialStatus,omitempty"`
+	CredentialSchema  map[string]any `json:"credentialSchema,omitempty"`
+}
+
+// CredentialVerification is the outcome of verifying a JWT-VC
+type CredentialVerification struct {
+	Valid      bool
+	Reason     string
+	Credential *VerifiableCredential
+}
+
+// SignJWT signs claims with the MPC enclave under a JOSE typ header and a
+// kid pointing at the issuer DID's verification method
+func (s *EnclaveService) SignJWT(typ string, claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(s.signingMethod(), claims)
+	token.Header["typ"] = typ
+	token.Header["kid"] = s.issuerDID + verificationMethodSuffix
+
+	tokenString, err := token.SignedString(nil)
+	audience, _ := claims["aud"].(string)
+	if auditErr := s.audit.Record(AuditRecord{
+		Operation: AuditOpJWT,
+		Type:      typ,
+		Data:      []byte(tokenString),
+		Signer:    s.issuerDID,
+		Audience:  audience,
+		Err:       err,
+	}); auditErr != nil {
+		return "", auditErr
+	}
+	if err != nil {
+		return "", NewEnclaveError(ErrCodeSigningFailed, "failed to sign %s with MPC: %v", typ, err)
+	}
+	return tokenString, nil
+}
+
+// IssueCredential completes and signs a credential as a JWT-VC issued by the
+// enclave's DID. Missing context, type and validity entries are filled in.
+func (s *EnclaveService) IssueCredential(vc *VerifiableCredential, ttl time.Duration) (string, *VerifiableCredential, error) {
+	if !s.enclave.IsValid() {
+		return "", nil, errNotInitialized()
+	}
+	if vc == nil || len(vc.CredentialSubject) == 0 {
+		return "", nil, NewEnclaveError(ErrCodeInvalidCredential, "credentialSubject is required")
+	}
+	if vc.Issuer != "" && vc.Issuer != s.issuerDID {
+		return "", nil, NewEnclaveError(ErrCodeInvalidCredential, "issuer must be %s", s.issuerDID)
+	}
+
+	issued := *vc
+	issued.Issuer = s.issuerDID
+	if !slices.Contains(issued.Context, CredentialsContextV2) {
+		issued.Context = append([]string{CredentialsContextV2}, issued.Context...)
+	} else if issued.Context[0] != CredentialsContextV2 {
+		return "", nil, NewEnclaveError(ErrCodeInvalidCredential, "first @context entry must be %s", CredentialsContextV2)
+	}
+	if !slices.Contains(issued.Type, CredentialType) {
+		issued.Type = append([]string{CredentialType}, issued.Type...)
+	}
+
+	now := time.Now()
+	validFrom := now
+	if issued.ValidFrom != "" {
+		t, err := time.Parse(credentialTimeFormat, issued.ValidFrom)
+		if err != nil {
+			return "", nil, NewEnclaveError(ErrCodeInvalidCredential, "invalid validFrom: %v", err)
+		}
+		validFrom = t
+	} else {
+		issued.ValidFrom = now.UTC().Format(credentialTimeFormat)
+	}
+
+	if ttl <= 0 {
+		ttl = DefaultCredentialTTL
+	}
+	validUntil := validFrom.Add(ttl)
+	if issued.ValidUntil != "" {
+		t, err := time.Parse(credentialTimeFormat, issued.ValidUntil)
+		if err != nil {
+			return "", nil, NewEnclaveError(ErrCodeInvalidCredential, "invalid validUntil: %v", err)
+		}
+		validUntil = t
+	} else {
+		issued.ValidUntil = validUntil.UTC().Format(credentialTimeFormat)
+	}
+	if !validUntil.After(validFrom) {
+		return "", nil, NewEnclaveError(ErrCodeInvalidCredential, "validUntil must be after validFrom")
+	}
+
+	claims, err := credentialClaims(&issued)
+	if err != nil {
+		return "", nil, err
+	}
+	claims["iss"] = issued.Issuer
+	claims["iat"] = now.Unix()
+	claims["nbf"] = validFrom.Unix()
+	claims["exp"] = validUntil.Unix()
+	if sub, ok := issued.CredentialSubject["id"].(string); ok && sub != "" {
+		claims["sub"] = sub
+	}
+	if issued.ID != "" {
+		claims["jti"] = issued.ID
+	}
+
+	tokenString, err := s.SignJWT(CredentialJWTType, claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return tokenString, &issued, nil
+}
+
+// VerifyCredential checks the signature, structure and validity period of a
+// JWT-VC. issuerPublicKey is required unless the enclave issued the credential.
+func (s *EnclaveService) VerifyCredential(tokenString string, issuerPublicKey []byte) (*CredentialVerification, error) {
+	token, err := s.parseSignedJWT(tokenString, issuerPublicKey)
+	if err != nil {
+		var encErr *EnclaveError
+		if errors.As(err, &encErr) {
+			return nil, err
+		}
+		return &CredentialVerification{Reason: err.Error()}, nil
+	}
+
+	if typ, _ := token.Header["typ"].(string); typ != CredentialJWTType {
+		return &CredentialVerification{Reason: fmt.Sprintf("unexpected typ %q", typ)}, nil
+	}
+
+	vc, err := credentialFromClaims(token.Claims.(jwt.MapClaims))
+	if err != nil {
+		return &CredentialVerification{Reason: err.Error()}, nil
+	}
+
+	if reason := checkCredential(vc, claimString(token.Claims.(jwt.MapClaims), "iss"), time.Now()); reason != "" {
+		return &CredentialVerification{Reason: reason, Credential: vc}, nil
+	}
+	return &CredentialVerification{Valid: true, Credential: vc}, nil
+}
+
+// parseSignedJWT verifies an MPC256 JWT against the public key of its iss.
+// Malformed input and unresolvable issuers are reported as EnclaveErrors;
+// signature and time-claim failures are returned as plain errors.
+func (s *EnclaveService) parseSignedJWT(tokenString string, issuerPublicKey []byte) (*jwt.Token, error) {
+	claims, err := decodeUnverifiedClaims(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	pubKey, err := s.resolveIssuerKey(claimString(claims, "iss"), issuerPublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{MPCAlg}))
+	return parser.Parse(tokenString, func(*jwt.Token) (any, error) {
+		return pubKey, nil
+	})
+}
+
+// resolveIssuerKey returns the public key for an issuer DID. The enclave's own
+// key is used for its DID; otherwise the supplied key must derive to the DID.
+func (s *EnclaveService) resolveIssuerKey(issuer string, supplied []byte) ([]byte, error) {
+	if issuer == "" {
+		return nil, NewEnclaveError(ErrCodeInvalidCredential, "missing iss claim")
+	}
+	if issuer == s.issuerDID && len(supplied) == 0 {
+		return s.enclave.PubKeyBytes(), nil
+	}
+	if len(supplied) == 0 {
+		return nil, NewEnclaveError(ErrCodeUnknownIssuer, "public key required to verify issuer %s", issuer).WithDetail("issuer", issuer)
+	}
+
+	derived, _, err := s.deriveIssuerDID(supplied)
+	if err != nil {
+		return nil, NewEnclaveError(ErrCodeInvalidRequest, "invalid issuer public key: %v", err)
+	}
+	if derived != issuer {
+		return nil, NewEnclaveError(ErrCodeUnknownIssuer, "public key does not belong to issuer %s", issuer).WithDetail("issuer", issuer)
+	}
+	return supplied, nil
+}
+
+// checkCredential validates data model requirements and the validity period,
+// returning a reason when the credential is not acceptable
+func checkCredential(vc *VerifiableCredential, iss string, now time.Time) string {
+	if len(vc.Context) == 0 || vc.Context[0] != CredentialsContextV2 {
+		return fmt.Sprintf("first @context entry must be %s", CredentialsContextV2)
+	}
+	if !slices.Contains(vc.Type, CredentialType) {
+		return fmt.Sprintf("type must include %s", CredentialType)
+	}
+	if vc.Issuer != iss {
+		return "issuer does not match iss claim"
+	}
+	if len(vc.CredentialSubject) == 0 {
+		return "credentialSubject is required"
+	}
+	if vc.ValidFrom != "" {
+		t, err := time.Parse(credentialTimeFormat, vc.ValidFrom)
+		if err != nil {
+			return "invalid validFrom"
+		}
+		if now.Before(t) {
+			return "credential is not yet valid"
+		}
+	}
+	if vc.ValidUntil != "" {
+		t, err := time.Parse(credentialTimeFormat, vc.ValidUntil)
+		if err != nil {
+			return "invalid validUntil"
+		}
+		if now.After(t) {
+			return "credential has expired"
+		}
+	}
+	return ""
+}
+
+// credentialClaims flattens a credential into JWT claims
+func credentialClaims(vc *VerifiableCredential) (jwt.MapClaims, error) {
+	data, err := json.Marshal(vc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode credential: %w", err)
+	}
+
+	claims := jwt.MapClaims{}
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return nil, fmt.Errorf("failed to encode credential: %w", err)
+	}
+	return claims, nil
+}
+
+// credentialFromClaims reads the credential out of a JWT-VC payload
+func credentialFromClaims(claims jwt.MapClaims) (*VerifiableCredential, error) {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode credential: %w", err)
+	}
+
+	var vc VerifiableCredential
+	if err := json.Unmarshal(data, &vc); err != nil {
+		return nil, fmt.Errorf("failed to decode credential: %w", err)
+	}
+	return &vc, nil
+}
@@ -0,0 +1,101 @@
+//go:build wasm
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Multicodec prefixes for public keys carried in did:key identifiers
+var (
+	multicodecEd25519   = []byte{0xed, 0x01}
+	multicodecSecp256k1 = []byte{0xe7, 0x01}
+)
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// EncodeDIDKey returns the did:key identifier for a public key of the given type
+func EncodeDIDKey(keyType KeyType, pubKey []byte) (string, error) {
+	var prefix []byte
+	switch keyType {
+	case KeyTypeEd25519:
+		prefix = multicodecEd25519
+	case KeyTypeSecp256k1:
+		prefix = multicodecSecp256k1
+	default:
+		return "", fmt.Errorf("unsupported key type %q", keyType)
+	}
+
+	buf := append(append([]byte{}, prefix...), pubKey...)
+	return "did:key:z" + base58Encode(buf), nil
+}
+
+// DecodeDIDKey returns the key type and public key encoded in a did:key identifier
+func DecodeDIDKey(did string) (KeyType, []byte, error) {
+	encoded, ok := strings.CutPrefix(did, "did:key:z")
+	if !ok {
+		return "", nil, fmt.Errorf("not a base58btc did:key: %s", did)
+	}
+
+	buf, err := base58Decode(encoded)
+	if err != nil {
+		return "", nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(buf, multicodecEd25519):
+		return KeyTypeEd25519, buf[len(multicodecEd25519):], nil
+	case bytes.HasPrefix(buf, multicodecSecp256k1):
+		return KeyTypeSecp256k1, buf[len(multicodecSecp256k1):], nil
+	}
+	return "", nil, fmt.Errorf("unsupported did:key multicodec")
+}
+
+func base58Encode(input []byte) string {
+	x := new(big.Int).SetBytes(input)
+	base := big.NewInt(58)
+	mod := new(big.Int)
+
+	var out []byte
+	for x.Sign() > 0 {
+		x.DivMod(x, base, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for _, b := range input {
+		if b != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+func base58Decode(input string) ([]byte, error) {
+	x := new(big.Int)
+	base := big.NewInt(58)
+
+	for _, r := range input {
+		idx := strings.IndexRune(base58Alphabet, r)
+		if idx < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", r)
+		}
+		x.Mul(x, base)
+		x.Add(x, big.NewInt(int64(idx)))
+	}
+
+	var leading int
+	for _, r := range input {
+		if r != rune(base58Alphabet[0]) {
+			break
+		}
+		leading++
+	}
+	return append(make([]byte, leading), x.Bytes()...), nil
+}
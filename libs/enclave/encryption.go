@@ -0,0 +1,343 @@
+//go:build wasm
+
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/sonr-io/crypto/mpc"
+	"github.com/sonr-io/crypto/tecdsa/dklsv1"
+)
+
+// JWE parameters: direct ECDH-ES key agreement on secp256k1 with A256GCM
+// content encryption (RFC 7516, RFC 7518 §4.6, RFC 8812)
+const (
+	JWEAlg   = "ECDH-ES"
+	JWEEnc   = "A256GCM"
+	jweCurve = "secp256k1"
+)
+
+// encryptionKeyState lazily holds the enclave's key agreement key.
+// Key agreement runs on the DID's own MPC key: the plugin holds both the
+// validator and user shares, whose DKLs secret shares multiply to the private
+// key. Refreshing the shares preserves their product, so the key agreement
+// key is the DID's key for the enclave's whole life and senders need nothing
+// beyond the DID and its public key.
+type encryptionKeyState struct {
+	once sync.Once
+	key  *secp256k1.PrivateKey
+	err  error
+}
+
+// JWK is the public part of an EC key in JSON Web Key form
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	Kid string `json:"kid,omitempty"`
+}
+
+type jweHeader struct {
+	Alg string `json:"alg"`
+	Enc string `json:"enc"`
+	Kid string `json:"kid,omitempty"`
+	Epk JWK    `json:"epk"`
+}
+
+// EncryptionRecipient identifies the key a JWE is encrypted to
+type EncryptionRecipient struct {
+	// DID is a secp256k1 did:key, the enclave's own DID, or another Motor DID
+	DID string
+	// PublicKey is the recipient's secp256k1 public key. It is accepted on
+	// its own or with a DID it derives to, never for any other DID.
+	PublicKey []byte
+}
+
+// EncryptionKey returns the enclave's key agreement key, combined from its
+// key shares on first use
+func (s *EnclaveService) EncryptionKey() (*secp256k1.PrivateKey, error) {
+	state := &s.encryption
+	state.once.Do(func() {
+		state.key, state.err = combineKeyShares(s.enclave.GetData())
+	})
+	return state.key, state.err
+}
+
+// combineKeyShares multiplies the validator (Alice) and user (Bob) DKLs
+// secret shares into the enclave's private key, checking it against the
+// enclave public key
+func combineKeyShares(data *mpc.EnclaveData) (*secp256k1.PrivateKey, error) {
+	if data == nil || !data.IsValid() {
+		return nil, fmt.Errorf("enclave shares are required for key agreement")
+	}
+	alice, err := dklsv1.DecodeAliceDkgResult(data.ValShare)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode validator share: %w", err)
+	}
+	bob, err := dklsv1.DecodeBobDkgResult(data.UserShare)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode user share: %w", err)
+	}
+
+	var scalar secp256k1.ModNScalar
+	if overflow := scalar.SetByteSlice(alice.SecretKeyShare.Mul(bob.SecretKeyShare).Bytes()); overflow || scalar.IsZero() {
+		return nil, fmt.Errorf("enclave shares do not combine to a valid key")
+	}
+	key := secp256k1.NewPrivateKey(&scalar)
+	if !bytes.Equal(key.PubKey().SerializeUncompressed(), data.PubBytes) {
+		return nil, fmt.Errorf("enclave shares do not match the enclave public key")
+	}
+	return key, nil
+}
+
+// EncryptionKeyID returns the verification method of the enclave's key
+// agreement key, which is its DID's MPC key
+func (s *EnclaveService) EncryptionKeyID() string {
+	return s.issuerDID + verificationMethodSuffix
+}
+
+// EncryptionJWK returns the enclave's key agreement key in JWK form
+func (s *EnclaveService) EncryptionJWK() (*JWK, error) {
+	pub, err := secp256k1.ParsePubKey(s.enclave.PubKeyBytes())
+	if err != nil {
+		return nil, fmt.Errorf("invalid enclave public key: %w", err)
+	}
+	jwk := publicJWK(pub)
+	jwk.Kid = s.EncryptionKeyID()
+	return jwk, nil
+}
+
+// EncryptFor encrypts plaintext to a recipient as a compact JWE
+func (s *EnclaveService) EncryptFor(recipient EncryptionRecipient, plaintext []byte) (string, error) {
+	pub, kid, err := s.resolveRecipientKey(recipient)
+	if err != nil {
+		return "", err
+	}
+
+	ephemeral, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		return "", NewEnclaveError(ErrCodeOperationFailed, "failed to generate ephemeral key: %v", err)
+	}
+
+	header := jweHeader{
+		Alg: JWEAlg,
+		Enc: JWEEnc,
+		Kid: kid,
+		Epk: *publicJWK(ephemeral.PubKey()),
+	}
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", NewEnclaveError(ErrCodeOperationFailed, "failed to encode JWE header: %v", err)
+	}
+	protected := base64.RawURLEncoding.EncodeToString(headerJSON)
+
+	cek := concatKDF(secp256k1.GenerateSharedSecret(ephemeral, pub), JWEEnc, 256)
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return "", NewEnclaveError(ErrCodeOperationFailed, "%v", err)
+	}
+
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return "", NewEnclaveError(ErrCodeOperationFailed, "failed to generate iv: %v", err)
+	}
+
+	sealed := gcm.Seal(nil, iv, plaintext, []byte(protected))
+	ciphertext, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+
+	return strings.Join([]string{
+		protected,
+		"",
+		base64.RawURLEncoding.EncodeToString(iv),
+		base64.RawURLEncoding.EncodeToString(ciphertext),
+		base64.RawURLEncoding.EncodeToString(tag),
+	}, "."), nil
+}
+
+// Decrypt opens a compact JWE addressed to the enclave's key agreement key
+func (s *EnclaveService) Decrypt(jwe string) ([]byte, error) {
+	parts := strings.Split(jwe, ".")
+	if len(parts) != 5 {
+		return nil, NewEnclaveError(ErrCodeInvalidRequest, "JWE must have five segments")
+	}
+	if parts[1] != "" {
+		return nil, NewEnclaveError(ErrCodeInvalidRequest, "JWE encrypted key must be empty for %s", JWEAlg)
+	}
+
+	var header jweHeader
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err == nil {
+		err = json.Unmarshal(headerJSON, &header)
+	}
+	if err != nil {
+		return nil, NewEnclaveError(ErrCodeInvalidRequest, "invalid JWE header: %v", err)
+	}
+	if header.Alg != JWEAlg || header.Enc != JWEEnc {
+		return nil, NewEnclaveError(ErrCodeInvalidRequest, "unsupported JWE alg/enc %s/%s", header.Alg, header.Enc)
+	}
+
+	epk, err := parseJWK(&header.Epk)
+	if err != nil {
+		return nil, NewEnclaveError(ErrCodeInvalidRequest, "invalid epk: %v", err)
+	}
+
+	var iv, ciphertext, tag []byte
+	for i, dst := range []*[]byte{&iv, &ciphertext, &tag} {
+		if *dst, err = base64.RawURLEncoding.DecodeString(parts[i+2]); err != nil {
+			return nil, NewEnclaveError(ErrCodeInvalidRequest, "invalid JWE segment %d: %v", i+2, err)
+		}
+	}
+
+	key, err := s.EncryptionKey()
+	if err != nil {
+		return nil, toEnclaveError(err, ErrCodeOperationFailed)
+	}
+
+	cek := concatKDF(secp256k1.GenerateSharedSecret(key, epk), JWEEnc, 256)
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return nil, NewEnclaveError(ErrCodeOperationFailed, "%v", err)
+	}
+	if len(iv) != gcm.NonceSize() {
+		return nil, NewEnclaveError(ErrCodeInvalidRequest, "invalid JWE iv length")
+	}
+
+	plaintext, err := gcm.Open(nil, iv, append(ciphertext, tag...), []byte(parts[0]))
+	if err != nil {
+		return nil, NewEnclaveError(ErrCodeDecryptionFailed, "failed to decrypt JWE")
+	}
+	return plaintext, nil
+}
+
+// resolveRecipientKey returns the key agreement key and kid for a
+// recipient. A key is only trusted for a DID that encodes it or that it
+// derives to.
+func (s *EnclaveService) resolveRecipientKey(recipient EncryptionRecipient) (*secp256k1.PublicKey, string, error) {
+	switch {
+	case recipient.DID == "" && len(recipient.PublicKey) == 0:
+		return nil, "", NewEnclaveError(ErrCodeInvalidRecipient, "recipient DID or public key is required")
+	case recipient.DID == s.issuerDID && len(recipient.PublicKey) == 0:
+		pub, err := secp256k1.ParsePubKey(s.enclave.PubKeyBytes())
+		if err != nil {
+			return nil, "", NewEnclaveError(ErrCodeOperationFailed, "invalid enclave public key: %v", err)
+		}
+		return pub, s.EncryptionKeyID(), nil
+	case strings.HasPrefix(recipient.DID, "did:key:"):
+		keyType, raw, err := DecodeDIDKey(recipient.DID)
+		if err != nil {
+			return nil, "", NewEnclaveError(ErrCodeInvalidRecipient, "%v", err)
+		}
+		if keyType != KeyTypeSecp256k1 {
+			return nil, "", NewEnclaveError(ErrCodeInvalidRecipient, "recipient key type %s does not support %s", keyType, JWEAlg)
+		}
+		pub, err := secp256k1.ParsePubKey(raw)
+		if err != nil {
+			return nil, "", NewEnclaveError(ErrCodeInvalidRecipient, "invalid recipient public key: %v", err)
+		}
+		if len(recipient.PublicKey) > 0 {
+			supplied, err := secp256k1.ParsePubKey(recipient.PublicKey)
+			if err != nil || !supplied.IsEqual(pub) {
+				return nil, "", NewEnclaveError(ErrCodeInvalidRecipient, "recipient_public_key does not belong to %s", recipient.DID).WithDetail("recipient", recipient.DID)
+			}
+		}
+		return pub, recipient.DID, nil
+	}
+
+	if len(recipient.PublicKey) == 0 {
+		return nil, "", NewEnclaveError(ErrCodeInvalidRecipient, "recipient_public_key is required to encrypt to %s", recipient.DID).WithDetail("recipient", recipient.DID)
+	}
+	pub, err := secp256k1.ParsePubKey(recipient.PublicKey)
+	if err != nil {
+		return nil, "", NewEnclaveError(ErrCodeInvalidRecipient, "invalid recipient public key: %v", err)
+	}
+	if recipient.DID == "" {
+		kid, err := EncodeDIDKey(KeyTypeSecp256k1, pub.SerializeCompressed())
+		if err != nil {
+			return nil, "", NewEnclaveError(ErrCodeInvalidRecipient, "%v", err)
+		}
+		return pub, kid, nil
+	}
+
+	// A Motor DID is derived from its uncompressed MPC public key
+	derived, _, err := s.deriveIssuerDID(pub.SerializeUncompressed())
+	if err != nil || derived != recipient.DID {
+		return nil, "", NewEnclaveError(ErrCodeInvalidRecipient, "recipient_public_key does not belong to %s", recipient.DID).WithDetail("recipient", recipient.DID)
+	}
+	return pub, recipient.DID + verificationMethodSuffix, nil
+}
+
+// concatKDF derives a content encryption key per RFC 7518 §4.6.2 with
+// empty PartyUInfo and PartyVInfo
+func concatKDF(z []byte, algID string, keyBits int) []byte {
+	var otherInfo []byte
+	otherInfo = binary.BigEndian.AppendUint32(otherInfo, uint32(len(algID)))
+	otherInfo = append(otherInfo, algID...)
+	otherInfo = binary.BigEndian.AppendUint32(otherInfo, 0)
+	otherInfo = binary.BigEndian.AppendUint32(otherInfo, 0)
+	otherInfo = binary.BigEndian.AppendUint32(otherInfo, uint32(keyBits))
+
+	keyLen := keyBits / 8
+	var out []byte
+	for counter := uint32(1); len(out) < keyLen; counter++ {
+		h := sha256.New()
+		h.Write(binary.BigEndian.AppendUint32(nil, counter))
+		h.Write(z)
+		h.Write(otherInfo)
+		out = h.Sum(out)
+	}
+	return out[:keyLen]
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return gcm, nil
+}
+
+func publicJWK(pub *secp256k1.PublicKey) *JWK {
+	uncompressed := pub.SerializeUncompressed()
+	return &JWK{
+		Kty: "EC",
+		Crv: jweCurve,
+		X:   base64.RawURLEncoding.EncodeToString(uncompressed[1:33]),
+		Y:   base64.RawURLEncoding.EncodeToString(uncompressed[33:65]),
+	}
+}
+
+func parseJWK(jwk *JWK) (*secp256k1.PublicKey, error) {
+	if jwk.Kty != "EC" || jwk.Crv != jweCurve {
+		return nil, fmt.Errorf("unsupported key %s/%s", jwk.Kty, jwk.Crv)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+	if err != nil {
+		return nil, err
+	}
+	if len(x) != 32 || len(y) != 32 {
+		return nil, fmt.Errorf("invalid coordinate length")
+	}
+
+	uncompressed := append(append([]byte{0x04}, x...), y...)
+	return secp256k1.ParsePubKey(uncompressed)
+}
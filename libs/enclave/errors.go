@@ -0,0 +1,88 @@
+//go:build wasm
+
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrorCode is a stable, machine-readable identifier for an enclave failure.
+// Values are shared with VaultErrorCode in the TypeScript client; see the
+// error code catalog in README.md.
+type ErrorCode string
+
+const (
+	ErrCodeNotInitialized     ErrorCode = "VAULT_NOT_INITIALIZED"
+	ErrCodeInvalidRequest     ErrorCode = "INVALID_REQUEST"
+	ErrCodeInvalidAudience    ErrorCode = "INVALID_AUDIENCE"
+	ErrCodeInvalidFacts       ErrorCode = "INVALID_FACTS"
+	ErrCodeInvalidToken       ErrorCode = "INVALID_TOKEN"
+	ErrCodeSigningFailed      ErrorCode = "SIGNING_FAILED"
+	ErrCodeVerificationFailed ErrorCode = "VERIFICATION_FAILED"
+	ErrCodeSessionNotFound    ErrorCode = "SESSION_NOT_FOUND"
+	ErrCodeSessionExpired     ErrorCode = "SESSION_EXPIRED"
+	ErrCodeCapabilityDenied   ErrorCode = "CAPABILITY_DENIED"
+	ErrCodeInvalidCredential  ErrorCode = "INVALID_CREDENTIAL"
+	ErrCodeUnknownIssuer      ErrorCode = "UNKNOWN_ISSUER"
+	ErrCodeInvalidRecipient   ErrorCode = "INVALID_RECIPIENT"
+	ErrCodeDecryptionFailed   ErrorCode = "DECRYPTION_FAILED"
+	ErrCodeAuditLogInvalid    ErrorCode = "AUDIT_LOG_INVALID"
+	ErrCodeOperationFailed    ErrorCode = "OPERATION_FAILED"
+)
+
+// retryableCodes lists codes where repeating the same request may succeed
+var retryableCodes = map[ErrorCode]bool{
+	ErrCodeSigningFailed:   true,
+	ErrCodeOperationFailed: true,
+}
+
+// EnclaveError is the error envelope returned by every enclave export
+type EnclaveError struct {
+	Code      ErrorCode      `json:"code"`
+	Message   string         `json:"message"`
+	Retryable bool           `json:"retryable"`
+	Details   map[string]any `json:"details,omitempty"`
+}
+
+func (e *EnclaveError) Error() string {
+	return e.Message
+}
+
+// NewEnclaveError creates an error envelope with the retryable flag derived from code
+func NewEnclaveError(code ErrorCode, format string, args ...any) *EnclaveError {
+	return &EnclaveError{
+		Code:      code,
+		Message:   fmt.Sprintf(format, args...),
+		Retryable: retryableCodes[code],
+	}
+}
+
+// WithDetail attaches a detail entry to the envelope
+func (e *EnclaveError) WithDetail(key string, value any) *EnclaveError {
+	if e.Details == nil {
+		e.Details = make(map[string]any)
+	}
+	e.Details[key] = value
+	return e
+}
+
+// toEnclaveError wraps err in an envelope. Errors that already carry an
+// envelope keep their code; anything else is reported under fallback.
+func toEnclaveError(err error, fallback ErrorCode) *EnclaveError {
+	var encErr *EnclaveError
+	if errors.As(err, &encErr) {
+		return &EnclaveError{
+			Code:      encErr.Code,
+			Message:   err.Error(),
+			Retryable: encErr.Retryable,
+			Details:   encErr.Details,
+		}
+	}
+	return NewEnclaveError(fallback, "%s", err.Error())
+}
+
+// errNotInitialized is returned when the MPC enclave failed to load
+func errNotInitialized() *EnclaveError {
+	return NewEnclaveError(ErrCodeNotInitialized, "enclave not initialized")
+}
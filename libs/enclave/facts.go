@@ -0,0 +1,92 @@
+//go:build wasm
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Known fact types with registered schemas
+const (
+	FactTypeSessionBinding    = "session_binding"
+	FactTypeDeviceAttestation = "device_attestation"
+)
+
+// Fact is a single UCAN fact carried in the fct claim. Facts are arbitrary
+// JSON objects; a "type" member selects schema validation for known types.
+type Fact map[string]any
+
+// UnmarshalJSON accepts either a JSON object or a legacy plain string,
+// which is wrapped as {"value": "<string>"}. Anything else, including null,
+// is rejected as INVALID_FACTS.
+func (f *Fact) UnmarshalJSON(data []byte) error {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte(`"`)):
+		var s string
+		if err := json.Unmarshal(trimmed, &s); err != nil {
+			return NewEnclaveError(ErrCodeInvalidFacts, "invalid fact string: %v", err)
+		}
+		*f = Fact{"value": s}
+		return nil
+
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		var m map[string]any
+		if err := json.Unmarshal(trimmed, &m); err != nil {
+			return NewEnclaveError(ErrCodeInvalidFacts, "invalid fact object: %v", err)
+		}
+		*f = m
+		return nil
+
+	default:
+		return NewEnclaveError(ErrCodeInvalidFacts, "fact must be a JSON object or string, got %s", trimmed)
+	}
+}
+
+// Type returns the fact's declared type, if any
+func (f Fact) Type() string {
+	t, _ := f["type"].(string)
+	return t
+}
+
+// factSchema lists the members a known fact type must carry
+type factSchema struct {
+	required []string
+}
+
+var factSchemas = map[string]factSchema{
+	FactTypeSessionBinding: {
+		required: []string{"session_id", "origin"},
+	},
+	FactTypeDeviceAttestation: {
+		required: []string{"device_id", "format", "attestation"},
+	},
+}
+
+// ValidateFacts checks facts of known types against their schema.
+// Facts without a type, or with an unregistered type, are passed through.
+func ValidateFacts(facts []Fact) error {
+	for i, fact := range facts {
+		if fact == nil {
+			return fmt.Errorf("fact %d is null", i)
+		}
+
+		schema, ok := factSchemas[fact.Type()]
+		if !ok {
+			continue
+		}
+
+		for _, field := range schema.required {
+			v, exists := fact[field]
+			if !exists {
+				return fmt.Errorf("fact %d (%s) missing required field %q", i, fact.Type(), field)
+			}
+			if s, isString := v.(string); isString && s == "" {
+				return fmt.Errorf("fact %d (%s) has empty field %q", i, fact.Type(), field)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+//go:build wasm
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestFactUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []Fact
+		wantErr bool
+	}{
+		{
+			name:  "objects",
+			input: `[{"type":"session_binding","session_id":"s1","origin":"https://motor.sonr.io"},{"note":"free-form"}]`,
+			want:  []Fact{{"type": "session_binding", "session_id": "s1", "origin": "https://motor.sonr.io"}, {"note": "free-form"}},
+		},
+		{
+			name:  "legacy string",
+			input: `["hello"]`,
+			want:  []Fact{{"value": "hello"}},
+		},
+		{
+			name:  "empty object",
+			input: `[{}]`,
+			want:  []Fact{{}},
+		},
+		{name: "null", input: `[null]`, wantErr: true},
+		{name: "number", input: `[42]`, wantErr: true},
+		{name: "boolean", input: `[true]`, wantErr: true},
+		{name: "array", input: `[["nested"]]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var facts []Fact
+			err := json.Unmarshal([]byte(tt.input), &facts)
+			if tt.wantErr {
+				var encErr *EnclaveError
+				if !errors.As(err, &encErr) || encErr.Code != ErrCodeInvalidFacts {
+					t.Fatalf("Unmarshal() error = %v, want %s", err, ErrCodeInvalidFacts)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			got, _ := json.Marshal(facts)
+			want, _ := json.Marshal(tt.want)
+			if string(got) != string(want) {
+				t.Errorf("Unmarshal() = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestValidateFacts(t *testing.T) {
+	session := func(modify func(Fact)) Fact {
+		f := Fact{"type": FactTypeSessionBinding, "session_id": "s1", "origin": "https://motor.sonr.io"}
+		if modify != nil {
+			modify(f)
+		}
+		return f
+	}
+
+	tests := []struct {
+		name    string
+		facts   []Fact
+		wantErr bool
+	}{
+		{name: "no facts"},
+		{name: "untyped fact", facts: []Fact{{"note": "anything"}}},
+		{name: "unregistered type", facts: []Fact{{"type": "custom", "x": 1}}},
+		{name: "session binding", facts: []Fact{session(nil)}},
+		{
+			name:  "device attestation",
+			facts: []Fact{{"type": FactTypeDeviceAttestation, "device_id": "d1", "format": "packed", "attestation": "o2Nm"}},
+		},
+		{name: "non-string required field", facts: []Fact{session(func(f Fact) { f["session_id"] = 7 })}},
+		{name: "missing required field", facts: []Fact{session(func(f Fact) { delete(f, "origin") })}, wantErr: true},
+		{name: "empty required field", facts: []Fact{session(func(f Fact) { f["session_id"] = "" })}, wantErr: true},
+		{
+			name:    "device attestation missing attestation",
+			facts:   []Fact{{"type": FactTypeDeviceAttestation, "device_id": "d1", "format": "packed"}},
+			wantErr: true,
+		},
+		{name: "invalid fact after valid ones", facts: []Fact{{"note": "ok"}, session(nil), session(func(f Fact) { delete(f, "session_id") })}, wantErr: true},
+		{name: "null fact", facts: []Fact{nil}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateFacts(tt.facts); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateFacts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
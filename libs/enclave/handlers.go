@@ -8,7 +8,7 @@ import (
 
 func handleNewOriginToken(svc *EnclaveService, req *NewOriginTokenRequest) *UCANTokenResponse {
 	if !svc.IsValid() {
-		return &UCANTokenResponse{Error: "enclave not initialized"}
+		return &UCANTokenResponse{Error: errNotInitialized()}
 	}
 
 	var notBefore, expiresAt time.Time
@@ -19,7 +19,7 @@ func handleNewOriginToken(svc *EnclaveService, req *NewOriginTokenRequest) *UCAN
 		expiresAt = time.Unix(req.ExpiresAt, 0)
 	}
 
-	tokenString, err := svc.CreateUCANToken(
+	token, err := svc.CreateUCANToken(
 		req.AudienceDID,
 		nil,
 		req.Attenuations,
@@ -28,19 +28,23 @@ func handleNewOriginToken(svc *EnclaveService, req *NewOriginTokenRequest) *UCAN
 		expiresAt,
 	)
 	if err != nil {
-		return &UCANTokenResponse{Error: err.Error()}
+		return &UCANTokenResponse{Error: toEnclaveError(err, ErrCodeOperationFailed)}
 	}
 
 	return &UCANTokenResponse{
-		Token:   tokenString,
-		Issuer:  svc.GetIssuerDID(),
-		Address: svc.GetAddress(),
+		Token:    token.Raw,
+		CID:      token.CID,
+		TokenID:  token.ID,
+		Nonce:    token.Nonce,
+		IssuedAt: token.IssuedAt,
+		Issuer:   svc.GetIssuerDID(),
+		Address:  svc.GetAddress(),
 	}
 }
 
 func handleNewAttenuatedToken(svc *EnclaveService, req *NewAttenuatedTokenRequest) *UCANTokenResponse {
 	if !svc.IsValid() {
-		return &UCANTokenResponse{Error: "enclave not initialized"}
+		return &UCANTokenResponse{Error: errNotInitialized()}
 	}
 
 	var notBefore, expiresAt time.Time
@@ -51,9 +55,30 @@ func handleNewAttenuatedToken(svc *EnclaveService, req *NewAttenuatedTokenReques
 		expiresAt = time.Unix(req.ExpiresAt, 0)
 	}
 
-	proofs := []string{req.ParentToken}
+	if req.ParentToken == "" {
+		return &UCANTokenResponse{Error: NewEnclaveError(ErrCodeInvalidRequest, "parent token is required")}
+	}
+
+	store := svc.GetProofStore()
+	for cid, proof := range req.ParentProofs {
+		if ProofCID(proof) != cid {
+			return &UCANTokenResponse{Error: NewEnclaveError(ErrCodeInvalidToken, "parent proof does not match its CID").WithDetail("proof", cid)}
+		}
+		if _, err := store.Put(proof); err != nil {
+			return &UCANTokenResponse{Error: toEnclaveError(err, ErrCodeOperationFailed)}
+		}
+	}
+
+	parentRef, err := store.Put(req.ParentToken)
+	if err != nil {
+		return &UCANTokenResponse{Error: toEnclaveError(err, ErrCodeOperationFailed)}
+	}
+	if req.EmbedProof {
+		parentRef = req.ParentToken
+	}
+	proofs := []string{parentRef}
 
-	tokenString, err := svc.CreateUCANToken(
+	token, err := svc.CreateUCANToken(
 		req.AudienceDID,
 		proofs,
 		req.Attenuations,
@@ -62,37 +87,55 @@ func handleNewAttenuatedToken(svc *EnclaveService, req *NewAttenuatedTokenReques
 		expiresAt,
 	)
 	if err != nil {
-		return &UCANTokenResponse{Error: err.Error()}
+		return &UCANTokenResponse{Error: toEnclaveError(err, ErrCodeOperationFailed)}
 	}
 
 	return &UCANTokenResponse{
-		Token:   tokenString,
-		Issuer:  svc.GetIssuerDID(),
-		Address: svc.GetAddress(),
+		Token:    token.Raw,
+		CID:      token.CID,
+		TokenID:  token.ID,
+		Nonce:    token.Nonce,
+		IssuedAt: token.IssuedAt,
+		Issuer:   svc.GetIssuerDID(),
+		Address:  svc.GetAddress(),
 	}
 }
 
 func handleSignData(svc *EnclaveService, req *SignDataRequest) *SignDataResponse {
 	if !svc.IsValid() {
-		return &SignDataResponse{Error: "enclave not initialized"}
+		return &SignDataResponse{Error: errNotInitialized()}
+	}
+
+	if req.SessionID != "" {
+		signature, key, err := svc.SignWithSession(req.SessionID, req.Data)
+		if err != nil {
+			return &SignDataResponse{Error: toEnclaveError(err, ErrCodeOperationFailed)}
+		}
+		return &SignDataResponse{Signature: signature, Signer: key.DID}
 	}
 
 	signature, err := svc.Sign(req.Data)
 	if err != nil {
-		return &SignDataResponse{Error: err.Error()}
+		return &SignDataResponse{Error: toEnclaveError(err, ErrCodeOperationFailed)}
 	}
 
-	return &SignDataResponse{Signature: signature}
+	return &SignDataResponse{Signature: signature, Signer: svc.GetIssuerDID()}
 }
 
 func handleVerifyData(svc *EnclaveService, req *VerifyDataRequest) *VerifyDataResponse {
 	if !svc.IsValid() {
-		return &VerifyDataResponse{Error: "enclave not initialized"}
+		return &VerifyDataResponse{Error: errNotInitialized()}
 	}
 
-	valid, err := svc.Verify(req.Data, req.Signature)
+	var valid bool
+	var err error
+	if req.SessionID != "" {
+		valid, err = svc.VerifyWithSession(req.SessionID, req.Data, req.Signature)
+	} else {
+		valid, err = svc.Verify(req.Data, req.Signature)
+	}
 	if err != nil {
-		return &VerifyDataResponse{Error: err.Error()}
+		return &VerifyDataResponse{Error: toEnclaveError(err, ErrCodeOperationFailed)}
 	}
 
 	return &VerifyDataResponse{Valid: valid}
@@ -100,17 +143,225 @@ func handleVerifyData(svc *EnclaveService, req *VerifyDataRequest) *VerifyDataRe
 
 func handleGetIssuerDID(svc *EnclaveService) *GetIssuerDIDResponse {
 	if !svc.IsValid() {
-		return &GetIssuerDIDResponse{Error: "enclave not initialized"}
+		return &GetIssuerDIDResponse{Error: errNotInitialized()}
 	}
 
 	chainCode, err := svc.GetChainCode()
 	if err != nil {
-		return &GetIssuerDIDResponse{Error: err.Error()}
+		return &GetIssuerDIDResponse{Error: toEnclaveError(err, ErrCodeOperationFailed)}
 	}
 
 	return &GetIssuerDIDResponse{
 		IssuerDID: svc.GetIssuerDID(),
 		Address:   svc.GetAddress(),
 		ChainCode: string(chainCode),
+		PublicKey: svc.GetPublicKey(),
+	}
+}
+
+func handleInspectUCAN(svc *EnclaveService, req *InspectUCANRequest) *InspectUCANResponse {
+	if req.Token == "" {
+		return &InspectUCANResponse{Error: NewEnclaveError(ErrCodeInvalidRequest, "token is required")}
+	}
+
+	// Inspection does not need the signing key, so fall back to the shared
+	// proof store even when the enclave itself failed to load
+	var fallback ProofStore = VarProofStore{}
+	if svc != nil {
+		fallback = svc.GetProofStore()
+	}
+	store := MapProofStore{Proofs: req.Proofs, Fallback: fallback}
+
+	inspection, err := InspectUCAN(req.Token, store, time.Now())
+	if err != nil {
+		return &InspectUCANResponse{Error: toEnclaveError(err, ErrCodeInvalidToken)}
+	}
+
+	return &InspectUCANResponse{Inspection: inspection}
+}
+
+func handleBundleUCAN(svc *EnclaveService, req *BundleUCANRequest) *BundleUCANResponse {
+	if !svc.IsValid() {
+		return &BundleUCANResponse{Error: errNotInitialized()}
+	}
+	if req.Token == "" {
+		return &BundleUCANResponse{Error: NewEnclaveError(ErrCodeInvalidRequest, "token is required")}
+	}
+
+	proofs, err := BundleProofs(svc.GetProofStore(), req.Token)
+	if err != nil {
+		return &BundleUCANResponse{Error: toEnclaveError(err, ErrCodeInvalidToken)}
+	}
+
+	return &BundleUCANResponse{
+		Token:  req.Token,
+		CID:    ProofCID(req.Token),
+		Proofs: proofs,
+	}
+}
+
+func handleCreateSessionKey(svc *EnclaveService, req *CreateSessionKeyRequest) *CreateSessionKeyResponse {
+	if !svc.IsValid() {
+		return &CreateSessionKeyResponse{Error: errNotInitialized()}
+	}
+
+	ttl := time.Duration(req.TTLSeconds) * time.Second
+	key, err := svc.CreateSessionKey(req.KeyType, req.Attenuations, req.Facts, ttl)
+	if err != nil {
+		return &CreateSessionKeyResponse{Error: toEnclaveError(err, ErrCodeOperationFailed)}
+	}
+
+	return &CreateSessionKeyResponse{
+		SessionID:  key.ID,
+		SessionDID: key.DID,
+		KeyType:    key.KeyType,
+		PublicKey:  key.PublicKey,
+		Token:      key.Token.Raw,
+		CID:        key.Token.CID,
+		ExpiresAt:  key.ExpiresAt.Unix(),
+	}
+}
+
+func handleIssueCredential(svc *EnclaveService, req *IssueCredentialRequest) *IssueCredentialResponse {
+	if !svc.IsValid() {
+		return &IssueCredentialResponse{Error: errNotInitialized()}
+	}
+
+	ttl := time.Duration(req.TTLSeconds) * time.Second
+	jwtVC, credential, err := svc.IssueCredential(req.Credential, ttl)
+	if err != nil {
+		return &IssueCredentialResponse{Error: toEnclaveError(err, ErrCodeOperationFailed)}
+	}
+
+	return &IssueCredentialResponse{
+		Credential: credential,
+		JWT:        jwtVC,
+	}
+}
+
+func handleVerifyCredential(svc *EnclaveService, req *VerifyCredentialRequest) *VerifyCredentialResponse {
+	if !svc.IsValid() {
+		return &VerifyCredentialResponse{Error: errNotInitialized()}
+	}
+	if req.JWT == "" {
+		return &VerifyCredentialResponse{Error: NewEnclaveError(ErrCodeInvalidRequest, "jwt is required")}
+	}
+
+	result, err := svc.VerifyCredential(req.JWT, req.IssuerPublicKey)
+	if err != nil {
+		return &VerifyCredentialResponse{Error: toEnclaveError(err, ErrCodeOperationFailed)}
+	}
+
+	return &VerifyCredentialResponse{
+		Valid:      result.Valid,
+		Reason:     result.Reason,
+		Credential: result.Credential,
+	}
+}
+
+func handleCreatePresentation(svc *EnclaveService, req *CreatePresentationRequest) *CreatePresentationResponse {
+	if !svc.IsValid() {
+		return &CreatePresentationResponse{Error: errNotInitialized()}
+	}
+
+	jwtVP, included, err := svc.CreatePresentation(req.Credentials, PresentationOptions{
+		Audience: req.Audience,
+		Nonce:    req.Nonce,
+		TTL:      time.Duration(req.TTLSeconds) * time.Second,
+		Include:  req.Include,
+	})
+	if err != nil {
+		return &CreatePresentationResponse{Error: toEnclaveError(err, ErrCodeOperationFailed)}
+	}
+
+	return &CreatePresentationResponse{
+		JWT:         jwtVP,
+		Holder:      svc.GetIssuerDID(),
+		Credentials: included,
+	}
+}
+
+func handleEncryptFor(svc *EnclaveService, req *EncryptForRequest) *EncryptForResponse {
+	if !svc.IsValid() {
+		return &EncryptForResponse{Error: errNotInitialized()}
+	}
+
+	jwe, err := svc.EncryptFor(EncryptionRecipient{
+		DID:       req.Recipient,
+		PublicKey: req.RecipientPublicKey,
+	}, req.Plaintext)
+	if err != nil {
+		return &EncryptForResponse{Error: toEnclaveError(err, ErrCodeOperationFailed)}
+	}
+
+	return &EncryptForResponse{JWE: jwe}
+}
+
+func handleDecrypt(svc *EnclaveService, req *DecryptRequest) *DecryptResponse {
+	if !svc.IsValid() {
+		return &DecryptResponse{Error: errNotInitialized()}
+	}
+	if req.JWE == "" {
+		return &DecryptResponse{Error: NewEnclaveError(ErrCodeInvalidRequest, "jwe is required")}
+	}
+
+	plaintext, err := svc.Decrypt(req.JWE)
+	if err != nil {
+		return &DecryptResponse{Error: toEnclaveError(err, ErrCodeOperationFailed)}
+	}
+
+	return &DecryptResponse{Plaintext: plaintext}
+}
+
+func handleGetEncryptionKey(svc *EnclaveService) *GetEncryptionKeyResponse {
+	if !svc.IsValid() {
+		return &GetEncryptionKeyResponse{Error: errNotInitialized()}
+	}
+
+	jwk, err := svc.EncryptionJWK()
+	if err != nil {
+		return &GetEncryptionKeyResponse{Error: toEnclaveError(err, ErrCodeOperationFailed)}
+	}
+
+	return &GetEncryptionKeyResponse{
+		KeyID: jwk.Kid,
+		JWK:   jwk,
+	}
+}
+
+func handleExportAuditLog(svc *EnclaveService) *ExportAuditLogResponse {
+	if !svc.IsValid() {
+		return &ExportAuditLogResponse{Error: errNotInitialized()}
+	}
+
+	journal := svc.GetAuditJournal()
+	entries, checkpoint, err := journal.Export()
+	resp := &ExportAuditLogResponse{Entries: entries, Checkpoint: checkpoint, Verified: true}
+	if n := len(entries); n > 0 {
+		resp.HeadHash = entries[n-1].Hash
+	}
+	if err != nil {
+		resp.Error = toEnclaveError(err, ErrCodeSigningFailed)
+		return resp
+	}
+	err = journal.Err()
+	if err == nil {
+		err = svc.VerifyAuditLog(entries, checkpoint, nil)
+	}
+	if err != nil {
+		resp.Verified = false
+		resp.Reason = err.Error()
+	}
+	return resp
+}
+
+func handleVerifyAuditLog(svc *EnclaveService, req *VerifyAuditLogRequest) *VerifyAuditLogResponse {
+	if !svc.IsValid() {
+		return &VerifyAuditLogResponse{Error: errNotInitialized()}
+	}
+
+	if err := svc.VerifyAuditLog(req.Entries, req.Checkpoint, req.PublicKey); err != nil {
+		return &VerifyAuditLogResponse{Reason: err.Error()}
 	}
+	return &VerifyAuditLogResponse{Verified: true}
 }
@@ -0,0 +1,307 @@
+//go:build wasm
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// maxProofDepth bounds recursion when decoding nested proofs
+const maxProofDepth = 16
+
+// Capability is a normalized UCAN capability: an ability on a resource
+type Capability struct {
+	Resource string         `json:"resource"`
+	Ability  string         `json:"ability"`
+	Caveats  map[string]any `json:"caveats,omitempty"`
+}
+
+// UCANInspection describes a decoded UCAN and its proof chain
+type UCANInspection struct {
+	ID                    string            `json:"id,omitempty"`
+	Issuer                string            `json:"issuer"`
+	Audience              string            `json:"audience"`
+	Algorithm             string            `json:"algorithm"`
+	Version               string            `json:"version,omitempty"`
+	Nonce                 string            `json:"nonce,omitempty"`
+	IssuedAt              int64             `json:"issued_at,omitempty"`
+	NotBefore             int64             `json:"not_before,omitempty"`
+	ExpiresAt             int64             `json:"expires_at,omitempty"`
+	Expired               bool              `json:"expired"`
+	RemainingSeconds      int64             `json:"remaining_seconds,omitempty"`
+	Capabilities          []Capability      `json:"capabilities"`
+	EffectiveCapabilities []Capability      `json:"effective_capabilities"`
+	Facts                 []Fact            `json:"facts,omitempty"`
+	Proofs                []*UCANInspection `json:"proofs,omitempty"`
+	Warnings              []string          `json:"warnings,omitempty"`
+}
+
+// InspectUCAN decodes a UCAN minted by CreateUCANToken, including nested
+// proofs, without verifying signatures. Proofs referenced by CID are
+// resolved through store.
+func InspectUCAN(tokenString string, store ProofStore, now time.Time) (*UCANInspection, error) {
+	return inspectUCAN(tokenString, store, now, 0)
+}
+
+func inspectUCAN(tokenString string, store ProofStore, now time.Time, depth int) (*UCANInspection, error) {
+	if depth > maxProofDepth {
+		return nil, NewEnclaveError(ErrCodeInvalidToken, "proof chain exceeds maximum depth of %d", maxProofDepth)
+	}
+
+	token, err := parseUnverified(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	claims := token.Claims.(jwt.MapClaims)
+
+	info := &UCANInspection{
+		ID:        claimString(claims, "jti"),
+		Issuer:    claimString(claims, "iss"),
+		Audience:  claimString(claims, "aud"),
+		Nonce:     claimString(claims, "nnc"),
+		IssuedAt:  claimInt(claims, "iat"),
+		NotBefore: claimInt(claims, "nbf"),
+		ExpiresAt: claimInt(claims, "exp"),
+	}
+	info.Algorithm, _ = token.Header["alg"].(string)
+	info.Version, _ = token.Header["ucv"].(string)
+
+	if info.Issuer == "" {
+		info.warn("missing iss claim")
+	}
+	if info.Audience == "" {
+		info.warn("missing aud claim")
+	}
+	if info.Algorithm != MPCAlg {
+		info.warn("unexpected signing algorithm %q", info.Algorithm)
+	}
+
+	nowUnix := now.Unix()
+	switch {
+	case info.ExpiresAt == 0:
+		info.warn("token has no expiry")
+	case nowUnix >= info.ExpiresAt:
+		info.Expired = true
+		info.warn("token expired at %d", info.ExpiresAt)
+	default:
+		info.RemainingSeconds = info.ExpiresAt - nowUnix
+	}
+	if info.NotBefore > 0 && nowUnix < info.NotBefore {
+		info.warn("token not valid before %d", info.NotBefore)
+	}
+
+	info.Capabilities = normalizeCapabilities(claims["att"], info)
+	info.Facts = decodeFacts(claims["fct"], info)
+
+	proofs, _ := claims["prf"].([]any)
+	for i, p := range proofs {
+		ref, ok := p.(string)
+		if !ok {
+			info.warn("proof %d is not a string", i)
+			continue
+		}
+
+		raw, err := resolveProof(store, ref)
+		if err != nil {
+			info.warn("proof %d could not be resolved: %v", i, err)
+			continue
+		}
+
+		proof, err := inspectUCAN(raw, store, now, depth+1)
+		if err != nil {
+			info.warn("proof %d could not be decoded: %v", i, err)
+			continue
+		}
+
+		if proof.Audience != info.Issuer {
+			info.warn("proof %d audience %q does not match issuer %q", i, proof.Audience, info.Issuer)
+		}
+		if proof.Expired {
+			info.warn("proof %d is expired", i)
+		}
+		if proof.ExpiresAt > 0 && (info.ExpiresAt == 0 || info.ExpiresAt > proof.ExpiresAt) {
+			info.warn("token outlives proof %d", i)
+		}
+		info.Proofs = append(info.Proofs, proof)
+	}
+
+	info.EffectiveCapabilities = info.effectiveCapabilities()
+	return info, nil
+}
+
+// effectiveCapabilities returns the capabilities that survive attenuation.
+// Tokens without proofs are root tokens and grant exactly what they claim.
+func (i *UCANInspection) effectiveCapabilities() []Capability {
+	if len(i.Proofs) == 0 {
+		return i.Capabilities
+	}
+
+	var parents []Capability
+	for _, proof := range i.Proofs {
+		if proof.Expired {
+			continue
+		}
+		parents = append(parents, proof.EffectiveCapabilities...)
+	}
+
+	effective := make([]Capability, 0, len(i.Capabilities))
+	for _, c := range i.Capabilities {
+		if capabilityCovered(c, parents) {
+			effective = append(effective, c)
+		} else {
+			i.warn("capability %s on %s is not delegated by any proof", c.Ability, c.Resource)
+		}
+	}
+	return effective
+}
+
+// parseUnverified decodes a UCAN without checking its signature. Tokens
+// with an unregistered alg are still decoded; only malformed tokens fail.
+func parseUnverified(tokenString string) (*jwt.Token, error) {
+	token, _, err := jwt.NewParser().ParseUnverified(tokenString, jwt.MapClaims{})
+	if err != nil && !errors.Is(err, jwt.ErrTokenUnverifiable) {
+		return nil, NewEnclaveError(ErrCodeInvalidToken, "failed to decode token: %v", err)
+	}
+	return token, nil
+}
+
+// decodeUnverifiedClaims returns the claims of a UCAN without checking its signature
+func decodeUnverifiedClaims(tokenString string) (jwt.MapClaims, error) {
+	token, err := parseUnverified(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	return token.Claims.(jwt.MapClaims), nil
+}
+
+func (i *UCANInspection) warn(format string, args ...any) {
+	i.Warnings = append(i.Warnings, fmt.Sprintf(format, args...))
+}
+
+// normalizeCapabilities accepts both UCAN 0.9 {with, can} attenuations and the
+// {resource, actions} shape used by the TypeScript client.
+func normalizeCapabilities(att any, info *UCANInspection) []Capability {
+	entries, _ := att.([]any)
+	caps := make([]Capability, 0, len(entries))
+
+	for i, entry := range entries {
+		m, ok := entry.(map[string]any)
+		if !ok {
+			info.warn("attenuation %d is not an object", i)
+			continue
+		}
+
+		resource := firstString(m, "with", "resource")
+		if resource == "" {
+			info.warn("attenuation %d has no resource", i)
+			continue
+		}
+
+		var abilities []string
+		if can := firstString(m, "can", "action", "ability"); can != "" {
+			abilities = append(abilities, can)
+		}
+		if actions, ok := m["actions"].([]any); ok {
+			for _, a := range actions {
+				if s, ok := a.(string); ok && s != "" {
+					abilities = append(abilities, s)
+				}
+			}
+		}
+		if len(abilities) == 0 {
+			info.warn("attenuation %d on %s has no ability", i, resource)
+			continue
+		}
+
+		caveats, _ := m["nb"].(map[string]any)
+		for _, ability := range abilities {
+			caps = append(caps, Capability{
+				Resource: resource,
+				Ability:  ability,
+				Caveats:  caveats,
+			})
+		}
+	}
+	return caps
+}
+
+// capabilitiesFromAttenuations normalizes request attenuations, dropping
+// entries that do not name a resource and ability
+func capabilitiesFromAttenuations(attenuations []map[string]any) []Capability {
+	att := make([]any, len(attenuations))
+	for i, a := range attenuations {
+		att[i] = a
+	}
+	return normalizeCapabilities(att, &UCANInspection{})
+}
+
+// capabilityCovered reports whether any parent grants c
+func capabilityCovered(c Capability, parents []Capability) bool {
+	for _, p := range parents {
+		if patternMatches(p.Resource, c.Resource) && patternMatches(p.Ability, c.Ability) {
+			return true
+		}
+	}
+	return false
+}
+
+// patternMatches reports whether pattern grants value. "*" matches anything,
+// and a trailing "*" matches any value with the preceding prefix.
+func patternMatches(pattern, value string) bool {
+	if pattern == "*" || pattern == value {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(value, prefix)
+	}
+	return false
+}
+
+func decodeFacts(fct any, info *UCANInspection) []Fact {
+	entries, _ := fct.([]any)
+	facts := make([]Fact, 0, len(entries))
+
+	for i, entry := range entries {
+		switch v := entry.(type) {
+		case map[string]any:
+			facts = append(facts, Fact(v))
+		case string:
+			facts = append(facts, Fact{"value": v})
+		default:
+			info.warn("fact %d is not an object", i)
+		}
+	}
+	if err := ValidateFacts(facts); err != nil {
+		info.warn("%v", err)
+	}
+	return facts
+}
+
+func claimString(claims jwt.MapClaims, key string) string {
+	s, _ := claims[key].(string)
+	return s
+}
+
+func claimInt(claims jwt.MapClaims, key string) int64 {
+	switch v := claims[key].(type) {
+	case float64:
+		return int64(v)
+	case int64:
+		return v
+	}
+	return 0
+}
+
+func firstString(m map[string]any, keys ...string) string {
+	for _, k := range keys {
+		if s, ok := m[k].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
@@ -11,51 +11,185 @@ import (
 type NewOriginTokenRequest struct {
 	AudienceDID  string           `json:"audience_did"`
 	Attenuations []map[string]any `json:"attenuations,omitempty"`
-	Facts        []string         `json:"facts,omitempty"`
+	Facts        []Fact           `json:"facts,omitempty"`
 	NotBefore    int64            `json:"not_before,omitempty"`
 	ExpiresAt    int64            `json:"expires_at,omitempty"`
 }
 
 type NewAttenuatedTokenRequest struct {
-	ParentToken  string           `json:"parent_token"`
-	AudienceDID  string           `json:"audience_did"`
-	Attenuations []map[string]any `json:"attenuations,omitempty"`
-	Facts        []string         `json:"facts,omitempty"`
-	NotBefore    int64            `json:"not_before,omitempty"`
-	ExpiresAt    int64            `json:"expires_at,omitempty"`
+	ParentToken  string            `json:"parent_token"`
+	ParentProofs map[string]string `json:"parent_proofs,omitempty"`
+	EmbedProof   bool              `json:"embed_proof,omitempty"`
+	AudienceDID  string            `json:"audience_did"`
+	Attenuations []map[string]any  `json:"attenuations,omitempty"`
+	Facts        []Fact            `json:"facts,omitempty"`
+	NotBefore    int64             `json:"not_before,omitempty"`
+	ExpiresAt    int64             `json:"expires_at,omitempty"`
 }
 
 type UCANTokenResponse struct {
-	Token   string `json:"token"`
-	Issuer  string `json:"issuer"`
-	Address string `json:"address"`
-	Error   string `json:"error,omitempty"`
+	Token    string        `json:"token"`
+	CID      string        `json:"cid,omitempty"`
+	TokenID  string        `json:"token_id,omitempty"`
+	Nonce    string        `json:"nonce,omitempty"`
+	IssuedAt int64         `json:"issued_at,omitempty"`
+	Issuer   string        `json:"issuer"`
+	Address  string        `json:"address"`
+	Error    *EnclaveError `json:"error,omitempty"`
 }
 
 type SignDataRequest struct {
-	Data []byte `json:"data"`
+	Data      []byte `json:"data"`
+	SessionID string `json:"session_id,omitempty"`
 }
 
 type SignDataResponse struct {
-	Signature []byte `json:"signature"`
-	Error     string `json:"error,omitempty"`
+	Signature []byte        `json:"signature"`
+	Signer    string        `json:"signer,omitempty"`
+	Error     *EnclaveError `json:"error,omitempty"`
 }
 
 type VerifyDataRequest struct {
 	Data      []byte `json:"data"`
 	Signature []byte `json:"signature"`
+	SessionID string `json:"session_id,omitempty"`
 }
 
 type VerifyDataResponse struct {
-	Valid bool   `json:"valid"`
-	Error string `json:"error,omitempty"`
+	Valid bool          `json:"valid"`
+	Error *EnclaveError `json:"error,omitempty"`
 }
 
 type GetIssuerDIDResponse struct {
-	IssuerDID string `json:"issuer_did"`
-	Address   string `json:"address"`
-	ChainCode string `json:"chain_code"`
-	Error     string `json:"error,omitempty"`
+	IssuerDID string        `json:"issuer_did"`
+	Address   string        `json:"address"`
+	ChainCode string        `json:"chain_code"`
+	PublicKey []byte        `json:"public_key,omitempty"`
+	Error     *EnclaveError `json:"error,omitempty"`
+}
+
+type InspectUCANRequest struct {
+	Token  string            `json:"token"`
+	Proofs map[string]string `json:"proofs,omitempty"`
+}
+
+type InspectUCANResponse struct {
+	Inspection *UCANInspection `json:"inspection,omitempty"`
+	Error      *EnclaveError   `json:"error,omitempty"`
+}
+
+type BundleUCANRequest struct {
+	Token string `json:"token"`
+}
+
+type BundleUCANResponse struct {
+	Token  string            `json:"token"`
+	CID    string            `json:"cid"`
+	Proofs map[string]string `json:"proofs"`
+	Error  *EnclaveError     `json:"error,omitempty"`
+}
+
+type CreateSessionKeyRequest struct {
+	KeyType      KeyType          `json:"key_type,omitempty"`
+	Attenuations []map[string]any `json:"attenuations"`
+	Facts        []Fact           `json:"facts,omitempty"`
+	TTLSeconds   int64            `json:"ttl_seconds,omitempty"`
+}
+
+type CreateSessionKeyResponse struct {
+	SessionID  string        `json:"session_id"`
+	SessionDID string        `json:"session_did"`
+	KeyType    KeyType       `json:"key_type"`
+	PublicKey  []byte        `json:"public_key"`
+	Token      string        `json:"token"`
+	CID        string        `json:"cid"`
+	ExpiresAt  int64         `json:"expires_at"`
+	Error      *EnclaveError `json:"error,omitempty"`
+}
+
+type IssueCredentialRequest struct {
+	Credential *VerifiableCredential `json:"credential"`
+	TTLSeconds int64                 `json:"ttl_seconds,omitempty"`
+}
+
+type IssueCredentialResponse struct {
+	Credential *VerifiableCredential `json:"credential,omitempty"`
+	JWT        string                `json:"jwt,omitempty"`
+	Error      *EnclaveError         `json:"error,omitempty"`
+}
+
+type VerifyCredentialRequest struct {
+	JWT             string `json:"jwt"`
+	IssuerPublicKey []byte `json:"issuer_public_key,omitempty"`
+}
+
+type VerifyCredentialResponse struct {
+	Valid      bool                  `json:"valid"`
+	Reason     string                `json:"reason,omitempty"`
+	Credential *VerifiableCredential `json:"credential,omitempty"`
+	Error      *EnclaveError         `json:"error,omitempty"`
+}
+
+type CreatePresentationRequest struct {
+	Credentials []string `json:"credentials"`
+	Audience    string   `json:"audience"`
+	Nonce       string   `json:"nonce"`
+	Include     []string `json:"include,omitempty"`
+	TTLSeconds  int64    `json:"ttl_seconds,omitempty"`
+}
+
+type CreatePresentationResponse struct {
+	JWT         string        `json:"jwt,omitempty"`
+	Holder      string        `json:"holder,omitempty"`
+	Credentials []string      `json:"credentials,omitempty"`
+	Error       *EnclaveError `json:"error,omitempty"`
+}
+
+type EncryptForRequest struct {
+	Recipient          string `json:"recipient,omitempty"`
+	RecipientPublicKey []byte `json:"recipient_public_key,omitempty"`
+	Plaintext          []byte `json:"plaintext"`
+}
+
+type EncryptForResponse struct {
+	JWE   string        `json:"jwe,omitempty"`
+	Error *EnclaveError `json:"error,omitempty"`
+}
+
+type DecryptRequest struct {
+	JWE string `json:"jwe"`
+}
+
+type DecryptResponse struct {
+	Plaintext []byte        `json:"plaintext,omitempty"`
+	Error     *EnclaveError `json:"error,omitempty"`
+}
+
+type GetEncryptionKeyResponse struct {
+	KeyID string        `json:"key_id,omitempty"`
+	JWK   *JWK          `json:"jwk,omitempty"`
+	Error *EnclaveError `json:"error,omitempty"`
+}
+
+type ExportAuditLogResponse struct {
+	Entries    []AuditEntry  `json:"entries"`
+	HeadHash   string        `json:"head_hash,omitempty"`
+	Checkpoint string        `json:"checkpoint,omitempty"`
+	Verified   bool          `json:"verified"`
+	Reason     string        `json:"reason,omitempty"`
+	Error      *EnclaveError `json:"error,omitempty"`
+}
+
+type VerifyAuditLogRequest struct {
+	Entries    []AuditEntry `json:"entries"`
+	Checkpoint string       `json:"checkpoint,omitempty"`
+	PublicKey  []byte       `json:"public_key,omitempty"`
+}
+
+type VerifyAuditLogResponse struct {
+	Verified bool          `json:"verified"`
+	Reason   string        `json:"reason,omitempty"`
+	Error    *EnclaveError `json:"error,omitempty"`
 }
 
 var svc *EnclaveService
@@ -79,16 +213,13 @@ func main() {
 func newOriginToken() int32 {
 	req := &NewOriginTokenRequest{}
 	if err := pdk.InputJSON(req); err != nil {
-		pdk.SetError(fmt.Errorf("failed to parse request: %w", err))
-		return 1
+		failRequest(err)
+		return 0
 	}
 
 	resp := handleNewOriginToken(svc, req)
 	pdk.OutputJSON(resp)
 
-	if resp.Error != "" {
-		return 1
-	}
 	return 0
 }
 
@@ -96,16 +227,13 @@ func newOriginToken() int32 {
 func newAttenuatedToken() int32 {
 	req := &NewAttenuatedTokenRequest{}
 	if err := pdk.InputJSON(req); err != nil {
-		pdk.SetError(fmt.Errorf("failed to parse request: %w", err))
-		return 1
+		failRequest(err)
+		return 0
 	}
 
 	resp := handleNewAttenuatedToken(svc, req)
 	pdk.OutputJSON(resp)
 
-	if resp.Error != "" {
-		return 1
-	}
 	return 0
 }
 
@@ -113,16 +241,13 @@ func newAttenuatedToken() int32 {
 func signData() int32 {
 	req := &SignDataRequest{}
 	if err := pdk.InputJSON(req); err != nil {
-		pdk.SetError(fmt.Errorf("failed to parse request: %w", err))
-		return 1
+		failRequest(err)
+		return 0
 	}
 
 	resp := handleSignData(svc, req)
 	pdk.OutputJSON(resp)
 
-	if resp.Error != "" {
-		return 1
-	}
 	return 0
 }
 
@@ -130,16 +255,13 @@ func signData() int32 {
 func verifyData() int32 {
 	req := &VerifyDataRequest{}
 	if err := pdk.InputJSON(req); err != nil {
-		pdk.SetError(fmt.Errorf("failed to parse request: %w", err))
-		return 1
+		failRequest(err)
+		return 0
 	}
 
 	resp := handleVerifyData(svc, req)
 	pdk.OutputJSON(resp)
 
-	if resp.Error != "" {
-		return 1
-	}
 	return 0
 }
 
@@ -148,8 +270,160 @@ func getIssuerDID() int32 {
 	resp := handleGetIssuerDID(svc)
 	pdk.OutputJSON(resp)
 
-	if resp.Error != "" {
-		return 1
+	return 0
+}
+
+//go:wasmexport inspect_ucan
+func inspectUCANToken() int32 {
+	req := &InspectUCANRequest{}
+	if err := pdk.InputJSON(req); err != nil {
+		failRequest(err)
+		return 0
+	}
+
+	resp := handleInspectUCAN(svc, req)
+	pdk.OutputJSON(resp)
+
+	return 0
+}
+
+//go:wasmexport bundle_ucan
+func bundleUCAN() int32 {
+	req := &BundleUCANRequest{}
+	if err := pdk.InputJSON(req); err != nil {
+		failRequest(err)
+		return 0
 	}
+
+	resp := handleBundleUCAN(svc, req)
+	pdk.OutputJSON(resp)
+
 	return 0
 }
+
+//go:wasmexport create_session_key
+func createSessionKey() int32 {
+	req := &CreateSessionKeyRequest{}
+	if err := pdk.InputJSON(req); err != nil {
+		failRequest(err)
+		return 0
+	}
+
+	resp := handleCreateSessionKey(svc, req)
+	pdk.OutputJSON(resp)
+
+	return 0
+}
+
+//go:wasmexport issue_credential
+func issueCredential() int32 {
+	req := &IssueCredentialRequest{}
+	if err := pdk.InputJSON(req); err != nil {
+		failRequest(err)
+		return 0
+	}
+
+	resp := handleIssueCredential(svc, req)
+	pdk.OutputJSON(resp)
+
+	return 0
+}
+
+//go:wasmexport verify_credential
+func verifyCredential() int32 {
+	req := &VerifyCredentialRequest{}
+	if err := pdk.InputJSON(req); err != nil {
+		failRequest(err)
+		return 0
+	}
+
+	resp := handleVerifyCredential(svc, req)
+	pdk.OutputJSON(resp)
+
+	return 0
+}
+
+//go:wasmexport create_presentation
+func createPresentation() int32 {
+	req := &CreatePresentationRequest{}
+	if err := pdk.InputJSON(req); err != nil {
+		failRequest(err)
+		return 0
+	}
+
+	resp := handleCreatePresentation(svc, req)
+	pdk.OutputJSON(resp)
+
+	return 0
+}
+
+//go:wasmexport encrypt_for
+func encryptFor() int32 {
+	req := &EncryptForRequest{}
+	if err := pdk.InputJSON(req); err != nil {
+		failRequest(err)
+		return 0
+	}
+
+	resp := handleEncryptFor(svc, req)
+	pdk.OutputJSON(resp)
+
+	return 0
+}
+
+//go:wasmexport decrypt
+func decrypt() int32 {
+	req := &DecryptRequest{}
+	if err := pdk.InputJSON(req); err != nil {
+		failRequest(err)
+		return 0
+	}
+
+	resp := handleDecrypt(svc, req)
+	pdk.OutputJSON(resp)
+
+	return 0
+}
+
+//go:wasmexport get_encryption_key
+func getEncryptionKey() int32 {
+	resp := handleGetEncryptionKey(svc)
+	pdk.OutputJSON(resp)
+
+	return 0
+}
+
+//go:wasmexport export_audit_log
+func exportAuditLog() int32 {
+	resp := handleExportAuditLog(svc)
+	pdk.OutputJSON(resp)
+
+	return 0
+}
+
+//go:wasmexport verify_audit_log
+func verifyAuditLog() int32 {
+	req := &VerifyAuditLogRequest{}
+	if err := pdk.InputJSON(req); err != nil {
+		failRequest(err)
+		return 0
+	}
+
+	resp := handleVerifyAuditLog(svc, req)
+	pdk.OutputJSON(resp)
+
+	return 0
+}
+
+// failRequest reports an unparseable request as an error envelope on the
+// output. Like every handled failure it is not a plugin error: hosts such as
+// the Extism JS SDK throw on a non-zero return and discard the output, so
+// exports return 0 and callers read the stable code from the envelope.
+func failRequest(err error) {
+	// Errors raised while decoding, such as an invalid fact, keep their code
+	encErr := toEnclaveError(err, ErrCodeInvalidRequest)
+	encErr.Message = "failed to parse request: " + encErr.Message
+	pdk.OutputJSON(map[string]any{
+		"error": encErr,
+	})
+}
@@ -0,0 +1,114 @@
+//go:build wasm
+
+package main
+
+import (
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// W3C VC Data Model 2.0 presentation constants
+const (
+	PresentationType          = "VerifiablePresentation"
+	PresentationJWTType       = "vp+jwt"
+	EnvelopedCredentialType   = "EnvelopedVerifiableCredential"
+	envelopedCredentialPrefix = "data:application/vc+jwt,"
+	DefaultPresentationTTL    = 5 * time.Minute
+)
+
+// PresentationOptions binds a presentation to a verifier
+type PresentationOptions struct {
+	Audience string
+	Nonce    string
+	TTL      time.Duration
+	// Include selects credentials by id or type; empty includes all
+	Include []string
+}
+
+// CreatePresentation wraps JWT-VCs into a VP-JWT held and signed by the
+// enclave DID and bound to the verifier's audience and nonce
+func (s *EnclaveService) CreatePresentation(credentials []string, opts PresentationOptions) (string, []string, error) {
+	if !s.enclave.IsValid() {
+		return "", nil, errNotInitialized()
+	}
+	if opts.Audience == "" {
+		return "", nil, NewEnclaveError(ErrCodeInvalidAudience, "audience is required")
+	}
+	if opts.Nonce == "" {
+		return "", nil, NewEnclaveError(ErrCodeInvalidRequest, "nonce is required")
+	}
+	if len(credentials) == 0 {
+		return "", nil, NewEnclaveError(ErrCodeInvalidRequest, "at least one credential is required")
+	}
+
+	var included []string
+	var enveloped []map[string]any
+	for i, raw := range credentials {
+		claims, err := decodeUnverifiedClaims(raw)
+		if err != nil {
+			return "", nil, NewEnclaveError(ErrCodeInvalidCredential, "credential %d is not a JWT-VC", i).WithDetail("index", i)
+		}
+		vc, err := credentialFromClaims(claims)
+		if err != nil {
+			return "", nil, NewEnclaveError(ErrCodeInvalidCredential, "credential %d: %v", i, err).WithDetail("index", i)
+		}
+		if !credentialSelected(vc, opts.Include) {
+			continue
+		}
+
+		included = append(included, raw)
+		enveloped = append(enveloped, map[string]any{
+			"@context": []string{CredentialsContextV2},
+			"id":       envelopedCredentialPrefix + raw,
+			"type":     EnvelopedCredentialType,
+		})
+	}
+	if len(included) == 0 {
+		return "", nil, NewEnclaveError(ErrCodeInvalidRequest, "no credentials matched the include filter")
+	}
+
+	ttl := opts.TTL
+	if ttl <= 0 {
+		ttl = DefaultPresentationTTL
+	}
+
+	now := time.Now()
+	jti, err := generateNonce()
+	if err != nil {
+		return "", nil, NewEnclaveError(ErrCodeOperationFailed, "failed to generate presentation id: %v", err)
+	}
+
+	claims := jwt.MapClaims{
+		"@context":             []string{CredentialsContextV2},
+		"type":                 []string{PresentationType},
+		"holder":               s.issuerDID,
+		"verifiableCredential": enveloped,
+		"iss":                  s.issuerDID,
+		"aud":                  opts.Audience,
+		"nonce":                opts.Nonce,
+		"iat":                  now.Unix(),
+		"exp":                  now.Add(ttl).Unix(),
+		"jti":                  jti,
+	}
+
+	tokenString, err := s.SignJWT(PresentationJWTType, claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return tokenString, included, nil
+}
+
+// credentialSelected reports whether vc matches any include filter entry
+func credentialSelected(vc *VerifiableCredential, include []string) bool {
+	if len(include) == 0 {
+		return true
+	}
+	for _, sel := range include {
+		if sel == vc.ID || slices.Contains(vc.Type, sel) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+//go:build wasm
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"strings"
+
+	"github.com/extism/go-pdk"
+)
+
+// KeyProofPrefix namespaces proof store entries in the plugin vars
+const KeyProofPrefix = "proof:"
+
+// CIDv1 prefix for a raw (0x55) block addressed by a sha2-256 (0x12, 32 bytes) multihash
+var cidPrefix = []byte{0x01, 0x55, 0x12, 0x20}
+
+var cidEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// ProofCID returns the CIDv1 (base32, raw codec, sha2-256) of a token
+func ProofCID(token string) string {
+	digest := sha256.Sum256([]byte(token))
+	buf := append(append([]byte{}, cidPrefix...), digest[:]...)
+	return "b" + strings.ToLower(cidEncoding.EncodeToString(buf))
+}
+
+// isProofCID reports whether a prf entry is a CID reference rather than an
+// embedded JWT
+func isProofCID(s string) bool {
+	return strings.HasPrefix(s, "b") && !strings.Contains(s, ".")
+}
+
+// ProofStore resolves proof CIDs to the tokens they address
+type ProofStore interface {
+	Put(token string) (string, error)
+	Get(cid string) (string, error)
+}
+
+// VarProofStore keeps proofs in Extism plugin vars, which are held by the
+// host and survive across calls on the same plugin instance
+type VarProofStore struct{}
+
+func (VarProofStore) Put(token string) (string, error) {
+	if token == "" {
+		return "", fmt.Errorf("empty proof")
+	}
+	cid := ProofCID(token)
+	pdk.SetVar(KeyProofPrefix+cid, []byte(token))
+	return cid, nil
+}
+
+func (VarProofStore) Get(cid string) (string, error) {
+	v := pdk.GetVar(KeyProofPrefix + cid)
+	if v == nil {
+		return "", fmt.Errorf("proof %s not found", cid)
+	}
+	return string(v), nil
+}
+
+// MapProofStore resolves proofs from a caller-supplied bundle, falling back
+// to another store for CIDs not in the bundle
+type MapProofStore struct {
+	Proofs   map[string]string
+	Fallback ProofStore
+}
+
+func (m MapProofStore) Put(token string) (string, error) {
+	if m.Fallback != nil {
+		return m.Fallback.Put(token)
+	}
+	if m.Proofs == nil {
+		return "", fmt.Errorf("proof bundle is read-only")
+	}
+	cid := ProofCID(token)
+	m.Proofs[cid] = token
+	return cid, nil
+}
+
+func (m MapProofStore) Get(cid string) (string, error) {
+	if token, ok := m.Proofs[cid]; ok {
+		return token, nil
+	}
+	if m.Fallback != nil {
+		return m.Fallback.Get(cid)
+	}
+	return "", fmt.Errorf("proof %s not found", cid)
+}
+
+// resolveProof returns the token a prf entry refers to, checking that the
+// resolved token hashes to the requested CID
+func resolveProof(store ProofStore, ref string) (string, error) {
+	if !isProofCID(ref) {
+		return ref, nil
+	}
+	if store == nil {
+		return "", fmt.Errorf("proof %s is referenced by CID but no proof store is available", ref)
+	}
+
+	token, err := store.Get(ref)
+	if err != nil {
+		return "", err
+	}
+	if ProofCID(token) != ref {
+		return "", fmt.Errorf("proof %s does not match its CID", ref)
+	}
+	return token, nil
+}
+
+// BundleProofs collects every proof reachable from token, keyed by CID
+func BundleProofs(store ProofStore, token string) (map[string]string, error) {
+	bundle := make(map[string]string)
+	if err := collectProofs(store, token, bundle, 0); err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
+
+func collectProofs(store ProofStore, token string, bundle map[string]string, depth int) error {
+	if depth > maxProofDepth {
+		return NewEnclaveError(ErrCodeInvalidToken, "proof chain exceeds maximum depth of %d", maxProofDepth)
+	}
+
+	claims, err := decodeUnverifiedClaims(token)
+	if err != nil {
+		return err
+	}
+
+	refs, _ := claims["prf"].([]any)
+	for _, r := range refs {
+		ref, ok := r.(string)
+		if !ok {
+			continue
+		}
+
+		proof, err := resolveProof(store, ref)
+		if err != nil {
+			return NewEnclaveError(ErrCodeInvalidToken, "failed to resolve proof: %v", err).WithDetail("proof", ref)
+		}
+
+		cid := ProofCID(proof)
+		if _, seen := bundle[cid]; seen {
+			continue
+		}
+		bundle[cid] = proof
+
+		if err := collectProofs(store, proof, bundle, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
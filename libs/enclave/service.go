@@ -3,7 +3,9 @@
 package main
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -19,15 +21,32 @@ const (
 	KeyEnclaveConfig = "vault_config"
 )
 
+// UCANToken is a signed UCAN together with the claims minted for it
+type UCANToken struct {
+	Raw      string
+	CID      string
+	ID       string
+	Nonce    string
+	IssuedAt int64
+}
+
 type EnclaveService struct {
 	enclave   mpc.Enclave
 	issuerDID string
 	address   string
 	chainID   string
+	proofs    ProofStore
+	sessions  *SessionKeyring
+	audit     *AuditJournal
+
+	encryption encryptionKeyState
 }
 
 func NewEnclaveService() (*EnclaveService, error) {
-	svc := &EnclaveService{}
+	svc := &EnclaveService{
+		proofs:   VarProofStore{},
+		sessions: NewSessionKeyring(),
+	}
 
 	chainID := pdk.GetVar(KeyChainID)
 	if chainID == nil {
@@ -52,6 +71,11 @@ func NewEnclaveService() (*EnclaveService, error) {
 		return nil, fmt.Errorf("failed to derive issuer DID: %w", err)
 	}
 
+	// The journal's head checkpoint is signed and verified with the enclave key
+	svc.audit = LoadAuditJournal(svc.signAuditCheckpoint, func(checkpoint string) (*AuditCheckpoint, error) {
+		return svc.parseAuditCheckpoint(checkpoint, nil)
+	})
+
 	pdk.Log(pdk.LogInfo, fmt.Sprintf("EnclaveService initialized: DID=%s, Address=%s", svc.issuerDID, svc.address))
 	return svc, nil
 }
@@ -97,32 +121,77 @@ func (s *EnclaveService) GetAddress() string {
 	return s.address
 }
 
+// GetPublicKey returns the enclave public key that verifies MPC256 signatures
+func (s *EnclaveService) GetPublicKey() []byte {
+	return s.enclave.PubKeyBytes()
+}
+
 func (s *EnclaveService) GetChainID() string {
 	return s.chainID
 }
 
+func (s *EnclaveService) GetProofStore() ProofStore {
+	return s.proofs
+}
+
+func (s *EnclaveService) GetAuditJournal() *AuditJournal {
+	return s.audit
+}
+
 func (s *EnclaveService) Sign(data []byte) ([]byte, error) {
 	if !s.enclave.IsValid() {
-		return nil, fmt.Errorf("enclave is not valid")
+		return nil, errNotInitialized()
+	}
+	if len(data) == 0 {
+		return nil, NewEnclaveError(ErrCodeInvalidRequest, "data is required")
+	}
+
+	sig, err := s.enclave.Sign(data)
+	if auditErr := s.audit.Record(AuditRecord{
+		Operation: AuditOpSignData,
+		Data:      data,
+		Signer:    s.issuerDID,
+		Err:       err,
+	}); auditErr != nil {
+		return nil, auditErr
+	}
+	if err != nil {
+		return nil, NewEnclaveError(ErrCodeSigningFailed, "failed to sign data: %v", err)
 	}
-	return s.enclave.Sign(data)
+	return sig, nil
 }
 
 func (s *EnclaveService) Verify(data, signature []byte) (bool, error) {
 	if !s.enclave.IsValid() {
-		return false, fmt.Errorf("enclave is not valid")
+		return false, errNotInitialized()
 	}
-	return s.enclave.Verify(data, signature)
+	if len(signature) == 0 {
+		return false, NewEnclaveError(ErrCodeInvalidRequest, "signature is required")
+	}
+
+	valid, err := s.enclave.Verify(data, signature)
+	if err != nil {
+		return false, NewEnclaveError(ErrCodeVerificationFailed, "failed to verify signature: %v", err)
+	}
+	return valid, nil
 }
 
 func (s *EnclaveService) GetChainCode() ([]byte, error) {
 	if !s.enclave.IsValid() {
-		return nil, fmt.Errorf("enclave is not valid")
+		return nil, errNotInitialized()
 	}
 
 	sig, err := s.enclave.Sign([]byte(s.address))
+	if auditErr := s.audit.Record(AuditRecord{
+		Operation: AuditOpChainCode,
+		Data:      []byte(s.address),
+		Signer:    s.issuerDID,
+		Err:       err,
+	}); auditErr != nil {
+		return nil, auditErr
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to sign address for chain code: %w", err)
+		return nil, NewEnclaveError(ErrCodeSigningFailed, "failed to sign address for chain code: %v", err)
 	}
 
 	hasher := sha256.New()
@@ -136,23 +205,22 @@ func (s *EnclaveService) CreateUCANToken(
 	audienceDID string,
 	proofs []string,
 	attenuations []map[string]any,
-	facts []string,
+	facts []Fact,
 	notBefore, expiresAt time.Time,
-) (string, error) {
+) (*UCANToken, error) {
 	if !s.enclave.IsValid() {
-		return "", fmt.Errorf("enclave is not valid")
+		return nil, errNotInitialized()
 	}
 
 	if audienceDID == "" {
-		return "", fmt.Errorf("audience DID is required")
+		return nil, NewEnclaveError(ErrCodeInvalidAudience, "audience DID is required")
 	}
 
-	signingMethod := &MPCSigningMethod{
-		Name:    "MPC256",
-		enclave: s.enclave,
+	if err := ValidateFacts(facts); err != nil {
+		return nil, NewEnclaveError(ErrCodeInvalidFacts, "invalid facts: %v", err)
 	}
 
-	token := jwt.New(signingMethod)
+	token := jwt.New(s.signingMethod())
 	token.Header["ucv"] = "0.9.0"
 
 	var nbfUnix, expUnix int64
@@ -163,9 +231,17 @@ func (s *EnclaveService) CreateUCANToken(
 		expUnix = expiresAt.Unix()
 	}
 
+	nonce, err := generateNonce()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	iat := time.Now().Unix()
+
 	claims := jwt.MapClaims{
 		"iss": s.issuerDID,
 		"aud": audienceDID,
+		"iat": iat,
+		"nnc": nonce,
 	}
 
 	if len(attenuations) > 0 {
@@ -187,14 +263,62 @@ func (s *EnclaveService) CreateUCANToken(
 		claims["exp"] = expUnix
 	}
 
+	tokenID, err := computeTokenID(claims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute token ID: %w", err)
+	}
+	claims["jti"] = tokenID
+
 	token.Claims = claims
 
 	tokenString, err := token.SignedString(nil)
+	if auditErr := s.audit.Record(AuditRecord{
+		Operation:    AuditOpUCAN,
+		Data:         []byte(tokenString),
+		Signer:       s.issuerDID,
+		Audience:     audienceDID,
+		Capabilities: summarizeCapabilities(attenuations),
+		Err:          err,
+	}); auditErr != nil {
+		return nil, auditErr
+	}
+	if err != nil {
+		return nil, NewEnclaveError(ErrCodeSigningFailed, "failed to sign token with MPC: %v", err)
+	}
+
+	// Keep every minted token addressable so it can be referenced as a proof
+	cid, err := s.proofs.Put(tokenString)
 	if err != nil {
-		return "", fmt.Errorf("failed to sign token with MPC: %w", err)
+		return nil, fmt.Errorf("failed to store token in proof store: %w", err)
 	}
 
-	return tokenString, nil
+	return &UCANToken{
+		Raw:      tokenString,
+		CID:      cid,
+		ID:       tokenID,
+		Nonce:    nonce,
+		IssuedAt: iat,
+	}, nil
+}
+
+// generateNonce returns a random, URL-safe nonce for the nnc claim
+func generateNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// computeTokenID derives the jti claim as the SHA-256 of the remaining claims.
+// MapClaims marshal with sorted keys, so the digest is stable for a given payload.
+func computeTokenID(claims jwt.MapClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256(payload)
+	return base64.RawURLEncoding.EncodeToString(digest[:]), nil
 }
 
 func (s *EnclaveService) deriveIssuerDID(pubKeyBytes []byte) (string, string, error) {
@@ -208,6 +332,25 @@ func (s *EnclaveService) deriveIssuerDID(pubKeyBytes []byte) (string, string, er
 	return issuerDID, address, nil
 }
 
+// MPCAlg is the JWS alg of tokens signed by the MPC enclave: ECDSA secp256k1
+// over the SHA-256 digest of the signing input (hashed again by the enclave)
+const MPCAlg = "MPC256"
+
+func init() {
+	// Register a verify-only instance so jwt.Parser can check MPC256 tokens
+	// against a public key supplied by the Keyfunc
+	jwt.RegisterSigningMethod(MPCAlg, func() jwt.SigningMethod {
+		return &MPCSigningMethod{Name: MPCAlg}
+	})
+}
+
+func (s *EnclaveService) signingMethod() *MPCSigningMethod {
+	return &MPCSigningMethod{
+		Name:    MPCAlg,
+		enclave: s.enclave,
+	}
+}
+
 type MPCSigningMethod struct {
 	Name    string
 	enclave mpc.Enclave
@@ -218,6 +361,10 @@ func (m *MPCSigningMethod) Alg() string {
 }
 
 func (m *MPCSigningMethod) Sign(signingString string, key any) ([]byte, error) {
+	if m.enclave == nil {
+		return nil, fmt.Errorf("signing method has no enclave")
+	}
+
 	hasher := sha256.New()
 	hasher.Write([]byte(signingString))
 	digest := hasher.Sum(nil)
@@ -230,12 +377,22 @@ func (m *MPCSigningMethod) Sign(signingString string, key any) ([]byte, error) {
 	return sig, nil
 }
 
+// Verify checks sig against the public key passed as key, or against the
+// enclave's own key when no public key is given
 func (m *MPCSigningMethod) Verify(signingString string, sig []byte, key any) error {
 	hasher := sha256.New()
 	hasher.Write([]byte(signingString))
 	digest := hasher.Sum(nil)
 
-	valid, err := m.enclave.Verify(digest, sig)
+	var valid bool
+	var err error
+	if pubKey, ok := key.([]byte); ok && len(pubKey) > 0 {
+		valid, err = mpc.VerifyWithPubKey(pubKey, digest, sig)
+	} else if m.enclave != nil {
+		valid, err = m.enclave.Verify(digest, sig)
+	} else {
+		return fmt.Errorf("no public key to verify against")
+	}
 	if err != nil {
 		return fmt.Errorf("failed to verify signature: %w", err)
 	}
@@ -0,0 +1,258 @@
+//go:build wasm
+
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+// KeyType identifies the curve of an ephemeral session key
+type KeyType string
+
+const (
+	KeyTypeEd25519   KeyType = "ed25519"
+	KeyTypeSecp256k1 KeyType = "secp256k1"
+)
+
+const (
+	// DefaultSessionTTL is used when a session request omits ttl_seconds
+	DefaultSessionTTL = 15 * time.Minute
+	// MaxSessionTTL caps the lifetime of a session key delegation
+	MaxSessionTTL = 24 * time.Hour
+	// SessionSignAbility must be granted to a session key before it can sign
+	SessionSignAbility = "sign"
+)
+
+// SessionKey is an ephemeral signing key delegated from the issuer DID.
+// Private key material never leaves the plugin.
+type SessionKey struct {
+	ID           string
+	DID          string
+	KeyType      KeyType
+	PublicKey    []byte
+	Token        *UCANToken
+	Capabilities []Capability
+	ExpiresAt    time.Time
+
+	ed25519Key   ed25519.PrivateKey
+	secp256k1Key *secp256k1.PrivateKey
+}
+
+// SessionKeyring holds the live session keys of a plugin instance
+type SessionKeyring struct {
+	mu       sync.Mutex
+	sessions map[string]*SessionKey
+}
+
+func NewSessionKeyring() *SessionKeyring {
+	return &SessionKeyring{sessions: make(map[string]*SessionKey)}
+}
+
+// generateSessionKey creates an ephemeral key pair of the requested type
+func generateSessionKey(keyType KeyType) (*SessionKey, error) {
+	key := &SessionKey{KeyType: keyType}
+
+	switch keyType {
+	case KeyTypeEd25519:
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		key.ed25519Key = priv
+		key.PublicKey = pub
+	case KeyTypeSecp256k1:
+		priv, err := secp256k1.GeneratePrivateKey()
+		if err != nil {
+			return nil, err
+		}
+		key.secp256k1Key = priv
+		key.PublicKey = priv.PubKey().SerializeCompressed()
+	default:
+		return nil, NewEnclaveError(ErrCodeInvalidRequest, "unsupported key type %q", keyType)
+	}
+
+	did, err := EncodeDIDKey(keyType, key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	key.DID = did
+	return key, nil
+}
+
+// Sign signs data with the session key. secp256k1 signatures are DER-encoded
+// ECDSA over the SHA-256 digest of data.
+func (k *SessionKey) Sign(data []byte) ([]byte, error) {
+	switch k.KeyType {
+	case KeyTypeEd25519:
+		return ed25519.Sign(k.ed25519Key, data), nil
+	case KeyTypeSecp256k1:
+		digest := sha256.Sum256(data)
+		return ecdsa.Sign(k.secp256k1Key, digest[:]).Serialize(), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+}
+
+// Verify checks a signature produced by Sign
+func (k *SessionKey) Verify(data, signature []byte) (bool, error) {
+	return verifyWithPublicKey(k.KeyType, k.PublicKey, data, signature)
+}
+
+// verifyWithPublicKey checks a signature made by an Ed25519 or secp256k1 key
+func verifyWithPublicKey(keyType KeyType, pubKey, data, signature []byte) (bool, error) {
+	switch keyType {
+	case KeyTypeEd25519:
+		if len(pubKey) != ed25519.PublicKeySize {
+			return false, fmt.Errorf("invalid ed25519 public key length")
+		}
+		return ed25519.Verify(pubKey, data, signature), nil
+	case KeyTypeSecp256k1:
+		pub, err := secp256k1.ParsePubKey(pubKey)
+		if err != nil {
+			return false, fmt.Errorf("invalid secp256k1 public key: %w", err)
+		}
+		sig, err := ecdsa.ParseDERSignature(signature)
+		if err != nil {
+			return false, fmt.Errorf("invalid signature encoding: %w", err)
+		}
+		digest := sha256.Sum256(data)
+		return sig.Verify(digest[:], pub), nil
+	}
+	return false, fmt.Errorf("unsupported key type %q", keyType)
+}
+
+// Grants reports whether the session delegation includes ability
+func (k *SessionKey) Grants(ability string) bool {
+	for _, c := range k.Capabilities {
+		if patternMatches(c.Ability, ability) || strings.HasSuffix(c.Ability, "/"+ability) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *SessionKeyring) Add(key *SessionKey) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sweep()
+	r.sessions[key.ID] = key
+}
+
+// Get returns a live session key, evicting it if it has expired
+func (r *SessionKeyring) Get(id string) (*SessionKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.sessions[id]
+	if !ok {
+		return nil, NewEnclaveError(ErrCodeSessionNotFound, "session key %s not found", id)
+	}
+	if time.Now().After(key.ExpiresAt) {
+		delete(r.sessions, id)
+		return nil, NewEnclaveError(ErrCodeSessionExpired, "session key %s expired", id)
+	}
+	return key, nil
+}
+
+func (r *SessionKeyring) sweep() {
+	now := time.Now()
+	for id, key := range r.sessions {
+		if now.After(key.ExpiresAt) {
+			delete(r.sessions, id)
+		}
+	}
+}
+
+// CreateSessionKey generates an ephemeral key and delegates attenuations to it
+// from the issuer DID with a UCAN that expires after ttl.
+func (s *EnclaveService) CreateSessionKey(
+	keyType KeyType,
+	attenuations []map[string]any,
+	facts []Fact,
+	ttl time.Duration,
+) (*SessionKey, error) {
+	if len(attenuations) == 0 {
+		return nil, NewEnclaveError(ErrCodeInvalidRequest, "session keys require at least one attenuation")
+	}
+	if ttl <= 0 {
+		ttl = DefaultSessionTTL
+	}
+	if ttl > MaxSessionTTL {
+		return nil, NewEnclaveError(ErrCodeInvalidRequest, "session ttl exceeds maximum of %s", MaxSessionTTL)
+	}
+	if keyType == "" {
+		keyType = KeyTypeEd25519
+	}
+
+	key, err := generateSessionKey(keyType)
+	if err != nil {
+		return nil, toEnclaveError(err, ErrCodeOperationFailed)
+	}
+
+	expiresAt := time.Now().Add(ttl)
+	token, err := s.CreateUCANToken(key.DID, nil, attenuations, facts, time.Time{}, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	key.ID = token.ID
+	key.Token = token
+	key.ExpiresAt = expiresAt
+	key.Capabilities = capabilitiesFromAttenuations(attenuations)
+
+	s.sessions.Add(key)
+	return key, nil
+}
+
+// SignWithSession signs data with a live session key that was granted the
+// sign ability
+func (s *EnclaveService) SignWithSession(sessionID string, data []byte) ([]byte, *SessionKey, error) {
+	if len(data) == 0 {
+		return nil, nil, NewEnclaveError(ErrCodeInvalidRequest, "data is required")
+	}
+
+	key, err := s.sessions.Get(sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !key.Grants(SessionSignAbility) {
+		return nil, nil, NewEnclaveError(ErrCodeCapabilityDenied, "session key %s is not delegated the %s ability", sessionID, SessionSignAbility)
+	}
+
+	sig, err := key.Sign(data)
+	if auditErr := s.audit.Record(AuditRecord{
+		Operation:    AuditOpSessionSign,
+		Data:         data,
+		Signer:       key.DID,
+		Capabilities: formatCapabilities(key.Capabilities),
+		Err:          err,
+	}); auditErr != nil {
+		return nil, nil, auditErr
+	}
+	if err != nil {
+		return nil, nil, NewEnclaveError(ErrCodeSigningFailed, "failed to sign with session key: %v", err)
+	}
+	return sig, key, nil
+}
+
+// VerifyWithSession checks a signature made by a live session key
+func (s *EnclaveService) VerifyWithSession(sessionID string, data, signature []byte) (bool, error) {
+	key, err := s.sessions.Get(sessionID)
+	if err != nil {
+		return false, err
+	}
+
+	valid, err := key.Verify(data, signature)
+	if err != nil {
+		return false, NewEnclaveError(ErrCodeVerificationFailed, "failed to verify signature: %v", err)
+	}
+	return valid, nil
+}
@@ -150,7 +150,7 @@ export class VaultClient implements VaultPlugin {
       const response = this.parsePluginOutput<UCANTokenResponse>(output);
 
       if (response.error) {
-        throw new VaultError(VaultErrorCode.OPERATION_FAILED, response.error);
+        throw VaultError.fromEnvelope(response.error);
       }
 
       // Save token if persistence is enabled
@@ -185,7 +185,7 @@ export class VaultClient implements VaultPlugin {
       const response = this.parsePluginOutput<UCANTokenResponse>(output);
 
       if (response.error) {
-        throw new VaultError(VaultErrorCode.OPERATION_FAILED, response.error);
+        throw VaultError.fromEnvelope(response.error);
       }
 
       // Save token if persistence is enabled
@@ -220,7 +220,7 @@ export class VaultClient implements VaultPlugin {
       const response = this.parsePluginOutput<any>(output);
 
       if (response.error) {
-        throw new VaultError(VaultErrorCode.OPERATION_FAILED, response.error);
+        throw VaultError.fromEnvelope(response.error);
       }
 
       return {
@@ -254,7 +254,7 @@ export class VaultClient implements VaultPlugin {
       const response = this.parsePluginOutput<VerifyDataResponse>(output);
 
       if (response.error) {
-        throw new VaultError(VaultErrorCode.OPERATION_FAILED, response.error);
+        throw VaultError.fromEnvelope(response.error);
       }
 
       return response;
@@ -284,7 +284,7 @@ export class VaultClient implements VaultPlugin {
       const response = this.parsePluginOutput<GetIssuerDIDResponse>(output);
 
       if (response.error) {
-        throw new VaultError(VaultErrorCode.OPERATION_FAILED, response.error);
+        throw VaultError.fromEnvelope(response.error);
       }
 
       return response;
@@ -22,13 +22,37 @@ export interface VaultConfig {
   [key: string]: any;
 }
 
+/**
+ * UCAN fact carried in the `fct` claim. Facts with a known `type`
+ * (`session_binding`, `device_attestation`) are schema-validated.
+ */
+export type UCANFact =
+  | SessionBindingFact
+  | DeviceAttestationFact
+  | Record<string, any>;
+
+export interface SessionBindingFact {
+  type: "session_binding";
+  session_id: string;
+  origin: string;
+  [key: string]: any;
+}
+
+export interface DeviceAttestationFact {
+  type: "device_attestation";
+  device_id: string;
+  format: string;
+  attestation: string;
+  [key: string]: any;
+}
+
 /**
  * Request for creating a new origin UCAN token
  */
 export interface NewOriginTokenRequest {
   audience_did: string;
   attenuations?: Record<string, any>[];
-  facts?: string[];
+  facts?: UCANFact[];
   not_before?: number;
   expires_at?: number;
 }
@@ -38,9 +62,13 @@ export interface NewOriginTokenRequest {
  */
 export interface NewAttenuatedTokenRequest {
   parent_token: string;
+  /** Proof set of the parent token, keyed by CID, imported into the proof store */
+  parent_proofs?: Record<string, string>;
+  /** Embed the full parent JWT in `prf` instead of referencing it by CID */
+  embed_proof?: boolean;
   audience_did: string;
   attenuations?: Record<string, any>[];
-  facts?: string[];
+  facts?: UCANFact[];
   not_before?: number;
   expires_at?: number;
 }
@@ -50,9 +78,17 @@ export interface NewAttenuatedTokenRequest {
  */
 export interface UCANTokenResponse {
   token: string;
+  /** CIDv1 (raw, sha2-256) of the token, used to reference it as a proof */
+  cid?: string;
+  /** Content hash of the token claims, also carried as the `jti` claim */
+  token_id?: string;
+  /** Random nonce carried as the `nnc` claim */
+  nonce?: string;
+  /** Unix timestamp carried as the `iat` claim */
+  issued_at?: number;
   issuer: string;
   address: string;
-  error?: string;
+  error?: EnclaveErrorEnvelope;
 }
 
 /**
@@ -60,6 +96,8 @@ export interface UCANTokenResponse {
  */
 export interface SignDataRequest {
   data: Uint8Array;
+  /** Sign with a session key from `create_session_key` instead of the MPC key */
+  session_id?: string;
 }
 
 /**
@@ -67,7 +105,9 @@ export interface SignDataRequest {
  */
 export interface SignDataResponse {
   signature: Uint8Array;
-  error?: string;
+  /** DID of the key that produced the signature */
+  signer?: string;
+  error?: EnclaveErrorEnvelope;
 }
 
 /**
@@ -76,6 +116,7 @@ export interface SignDataResponse {
 export interface VerifyDataRequest {
   data: Uint8Array;
   signature: Uint8Array;
+  session_id?: string;
 }
 
 /**
@@ -83,7 +124,7 @@ export interface VerifyDataRequest {
  */
 export interface VerifyDataResponse {
   valid: boolean;
-  error?: string;
+  error?: EnclaveErrorEnvelope;
 }
 
 /**
@@ -93,7 +134,260 @@ export interface GetIssuerDIDResponse {
   issuer_did: string;
   address: string;
   chain_code: string;
-  error?: string;
+  /** Public key used to verify credentials and presentations from this DID */
+  public_key?: Uint8Array;
+  error?: EnclaveErrorEnvelope;
+}
+
+/**
+ * Request for inspecting a UCAN token
+ */
+export interface InspectUCANRequest {
+  token: string;
+  /** Proofs referenced by CID, as returned by `bundle_ucan` */
+  proofs?: Record<string, string>;
+}
+
+/**
+ * Normalized UCAN capability
+ */
+export interface UCANCapability {
+  resource: string;
+  ability: string;
+  caveats?: Record<string, any>;
+}
+
+/**
+ * Decoded UCAN with its proof chain and effective capabilities
+ */
+export interface UCANInspection {
+  id?: string;
+  issuer: string;
+  audience: string;
+  algorithm: string;
+  version?: string;
+  nonce?: string;
+  issued_at?: number;
+  not_before?: number;
+  expires_at?: number;
+  expired: boolean;
+  remaining_seconds?: number;
+  capabilities: UCANCapability[];
+  effective_capabilities: UCANCapability[];
+  facts?: UCANFact[];
+  proofs?: UCANInspection[];
+  warnings?: string[];
+}
+
+/**
+ * Response from inspecting a UCAN token
+ */
+export interface InspectUCANResponse {
+  inspection?: UCANInspection;
+  error?: EnclaveErrorEnvelope;
+}
+
+/**
+ * Request for bundling a UCAN with its proof set
+ */
+export interface BundleUCANRequest {
+  token: string;
+}
+
+/**
+ * UCAN token together with every proof it references, keyed by CID
+ */
+export interface BundleUCANResponse {
+  token: string;
+  cid: string;
+  proofs: Record<string, string>;
+  error?: EnclaveErrorEnvelope;
+}
+
+/**
+ * Request for creating an ephemeral session key
+ */
+export interface CreateSessionKeyRequest {
+  key_type?: "ed25519" | "secp256k1";
+  attenuations: Record<string, any>[];
+  facts?: UCANFact[];
+  ttl_seconds?: number;
+}
+
+/**
+ * Session key delegated from the issuer DID
+ */
+export interface CreateSessionKeyResponse {
+  session_id: string;
+  session_did: string;
+  key_type: "ed25519" | "secp256k1";
+  public_key: Uint8Array;
+  token: string;
+  cid: string;
+  expires_at: number;
+  error?: EnclaveErrorEnvelope;
+}
+
+/**
+ * W3C VC Data Model 2.0 credential
+ */
+export interface VerifiableCredential {
+  "@context": string[];
+  id?: string;
+  type: string[];
+  issuer: string;
+  validFrom?: string;
+  validUntil?: string;
+  credentialSubject: Record<string, any>;
+  credentialStatus?: Record<string, any>;
+  credentialSchema?: Record<string, any>;
+}
+
+/**
+ * Request for issuing a JWT-VC signed by the enclave DID. Missing
+ * `@context`, `type`, `issuer` and validity entries are filled in.
+ */
+export interface IssueCredentialRequest {
+  credential: Partial<VerifiableCredential> &
+    Pick<VerifiableCredential, "credentialSubject">;
+  ttl_seconds?: number;
+}
+
+export interface IssueCredentialResponse {
+  credential?: VerifiableCredential;
+  jwt?: string;
+  error?: EnclaveErrorEnvelope;
+}
+
+/**
+ * Request for verifying a JWT-VC. `issuer_public_key` is required for
+ * credentials not issued by this enclave.
+ */
+export interface VerifyCredentialRequest {
+  jwt: string;
+  issuer_public_key?: Uint8Array;
+}
+
+export interface VerifyCredentialResponse {
+  valid: boolean;
+  reason?: string;
+  credential?: VerifiableCredential;
+  error?: EnclaveErrorEnvelope;
+}
+
+/**
+ * Request for wrapping JWT-VCs into a VP-JWT bound to a verifier
+ */
+export interface CreatePresentationRequest {
+  credentials: string[];
+  /** Verifier identifier, carried as the `aud` claim */
+  audience: string;
+  /** Verifier challenge, carried as the `nonce` claim */
+  nonce: string;
+  /** Credential ids or types to include; all credentials when omitted */
+  include?: string[];
+  ttl_seconds?: number;
+}
+
+export interface CreatePresentationResponse {
+  jwt?: string;
+  holder?: string;
+  /** The JWT-VCs that were included in the presentation */
+  credentials?: string[];
+  error?: EnclaveErrorEnvelope;
+}
+
+/**
+ * Request for encrypting data to a recipient as a compact JWE
+ * (ECDH-ES on secp256k1 with A256GCM). The recipient is a secp256k1
+ * did:key, the enclave's own DID, a raw public key, or another Motor DID
+ * together with its MPC public key. A public key is never accepted for a DID
+ * it does not derive to.
+ */
+export interface EncryptForRequest {
+  recipient?: string;
+  recipient_public_key?: Uint8Array;
+  plaintext: Uint8Array;
+}
+
+export interface EncryptForResponse {
+  jwe?: string;
+  error?: EnclaveErrorEnvelope;
+}
+
+export interface DecryptRequest {
+  jwe: string;
+}
+
+export interface DecryptResponse {
+  plaintext?: Uint8Array;
+  error?: EnclaveErrorEnvelope;
+}
+
+/**
+ * Public EC key in JSON Web Key form
+ */
+export interface ECJWK {
+  kty: "EC";
+  crv: "secp256k1";
+  x: string;
+  y: string;
+  kid?: string;
+}
+
+/**
+ * The enclave's key agreement key, which is its DID's MPC key
+ */
+export interface GetEncryptionKeyResponse {
+  key_id?: string;
+  jwk?: ECJWK;
+  error?: EnclaveErrorEnvelope;
+}
+
+/**
+ * Hash-chained record of a single enclave signing operation
+ */
+export interface AuditEntry {
+  seq: number;
+  timestamp: number;
+  operation: "sign_data" | "session_sign" | "ucan" | "jwt" | "chain_code";
+  type?: string;
+  /** Hex SHA-256 of the signed data or token */
+  digest: string;
+  signer: string;
+  audience?: string;
+  /** Comma-separated `ability@resource` pairs */
+  capabilities?: string;
+  status: "ok" | "error";
+  prev_hash: string;
+  hash: string;
+}
+
+/**
+ * The retained audit entries and the MPC-signed checkpoint of their head.
+ * Anchor the checkpoint outside the plugin to detect a rolled-back journal.
+ */
+export interface ExportAuditLogResponse {
+  entries: AuditEntry[];
+  head_hash?: string;
+  /** `audit-checkpoint+jwt` pinning the first retained and the last entry */
+  checkpoint?: string;
+  verified: boolean;
+  reason?: string;
+  error?: EnclaveErrorEnvelope;
+}
+
+export interface VerifyAuditLogRequest {
+  entries: AuditEntry[];
+  checkpoint?: string;
+  /** Enclave public key, when verifying another enclave's journal */
+  public_key?: Uint8Array;
+}
+
+export interface VerifyAuditLogResponse {
+  verified: boolean;
+  reason?: string;
+  error?: EnclaveErrorEnvelope;
 }
 
 /**
@@ -114,6 +408,20 @@ export interface VaultPlugin {
  */
 export enum VaultErrorCode {
   NOT_INITIALIZED = "VAULT_NOT_INITIALIZED",
+  INVALID_REQUEST = "INVALID_REQUEST",
+  INVALID_AUDIENCE = "INVALID_AUDIENCE",
+  INVALID_FACTS = "INVALID_FACTS",
+  INVALID_TOKEN = "INVALID_TOKEN",
+  SIGNING_FAILED = "SIGNING_FAILED",
+  VERIFICATION_FAILED = "VERIFICATION_FAILED",
+  SESSION_NOT_FOUND = "SESSION_NOT_FOUND",
+  SESSION_EXPIRED = "SESSION_EXPIRED",
+  CAPABILITY_DENIED = "CAPABILITY_DENIED",
+  INVALID_CREDENTIAL = "INVALID_CREDENTIAL",
+  UNKNOWN_ISSUER = "UNKNOWN_ISSUER",
+  INVALID_RECIPIENT = "INVALID_RECIPIENT",
+  DECRYPTION_FAILED = "DECRYPTION_FAILED",
+  AUDIT_LOG_INVALID = "AUDIT_LOG_INVALID",
   ALREADY_INITIALIZED = "VAULT_ALREADY_INITIALIZED",
   LOCKED = "VAULT_LOCKED",
   KEY_NOT_FOUND = "KEY_NOT_FOUND",
@@ -124,6 +432,16 @@ export enum VaultErrorCode {
   TIMEOUT = "TIMEOUT",
 }
 
+/**
+ * Error envelope returned by every enclave export
+ */
+export interface EnclaveErrorEnvelope {
+  code: VaultErrorCode;
+  message: string;
+  retryable: boolean;
+  details?: Record<string, any>;
+}
+
 /**
  * Vault error class
  */
@@ -132,10 +450,23 @@ export class VaultError extends Error {
     public code: VaultErrorCode,
     message: string,
     public details?: any,
+    public retryable = false,
   ) {
     super(message);
     this.name = "VaultError";
   }
+
+  /**
+   * Create a VaultError from an enclave error envelope
+   */
+  static fromEnvelope(envelope: EnclaveErrorEnvelope): VaultError {
+    return new VaultError(
+      envelope.code ?? VaultErrorCode.OPERATION_FAILED,
+      envelope.message,
+      envelope.details,
+      envelope.retryable,
+    );
+  }
 }
 
 /**
@@ -2,9 +2,14 @@ module motr
 
 go 1.24.7
 
-require github.com/nlepage/go-wasm-http-server/v2 v2.2.1
+require (
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.4.0
+	github.com/nlepage/go-js-promise v1.0.0
+	github.com/nlepage/go-wasm-http-server/v2 v2.2.1
+	golang.org/x/crypto v0.42.0
+)
 
 require (
 	github.com/hack-pad/safejs v0.1.1 // indirect
-	github.com/nlepage/go-js-promise v1.0.0 // indirect
+	golang.org/x/sys v0.36.0 // indirect
 )
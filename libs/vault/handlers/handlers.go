@@ -279,9 +279,9 @@ func HandleJWKS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	jwk := middleware.GetJWTManager().GetPublicKeyJWK()
+	w.Header().Set("Cache-Control", "public, max-age=300")
 	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"keys": []map[string]interface{}{jwk},
+		"keys": middleware.GetJWTManager().JWKS(),
 	})
 }
 
@@ -298,40 +298,152 @@ func HandleAuthorize(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Parse authorization request
-	clientID := r.FormValue("client_id")
-	redirectURI := r.FormValue("redirect_uri")
-	responseType := r.FormValue("response_type")
-	scope := r.FormValue("scope")
-	state := r.FormValue("state")
-	nonce := r.FormValue("nonce")
-	codeChallenge := r.FormValue("code_challenge")
-	codeChallengeMethod := r.FormValue("code_challenge_method")
+	req := &middleware.AuthorizationRequest{
+		ClientID:            r.FormValue("client_id"),
+		RedirectURI:         r.FormValue("redirect_uri"),
+		ResponseType:        r.FormValue("response_type"),
+		ResponseMode:        r.FormValue("response_mode"),
+		Scope:               r.FormValue("scope"),
+		State:               r.FormValue("state"),
+		Nonce:               r.FormValue("nonce"),
+		CodeChallenge:       r.FormValue("code_challenge"),
+		CodeChallengeMethod: r.FormValue("code_challenge_method"),
+		Prompt:              r.FormValue("prompt"),
+	}
+
+	outcome, err := middleware.GetOIDCProvider().Authorize(r, req)
+	writeAuthorizationOutcome(w, r, outcome, err)
+}
+
+// HandleAuthorizeLogin authenticates the user for a pending authorization
+func HandleAuthorizeLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		handleCORS(w)
+		return
+	}
+
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
 
-	// Validate request
-	if clientID == "" || redirectURI == "" || responseType == "" {
-		writeError(w, http.StatusBadRequest, "Missing required parameters")
+	outcome, err := middleware.GetOIDCProvider().Login(r, r.FormValue("interaction_id"), r.FormValue("method"))
+	writeAuthorizationOutcome(w, r, outcome, err)
+}
+
+// HandleAuthorizeConsent records the user's consent decision and redirects
+// back to the client
+func HandleAuthorizeConsent(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		handleCORS(w)
 		return
 	}
 
-	// For demo, auto-approve with test user
-	userID := "test-user"
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
 
-	// Generate authorization code
-	authCode, err := middleware.GetOIDCProvider().GenerateAuthorizationCode(
-		clientID, redirectURI, scope, state, nonce, userID,
-		codeChallenge, codeChallengeMethod,
-	)
+	approved := r.FormValue("decision") == "approve"
+	outcome, err := middleware.GetOIDCProvider().Consent(r, r.FormValue("interaction_id"), approved)
+	writeAuthorizationOutcome(w, r, outcome, err)
+}
+
+// HandleAuthorizeInteraction returns the pending step of an interaction for
+// the login and consent UI
+func HandleAuthorizeInteraction(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		handleCORS(w)
+		return
+	}
+
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	prompt, err := middleware.GetOIDCProvider().GetInteraction(r.FormValue("interaction_id"))
 	if err != nil {
-		writeError(w, http.StatusBadRequest, err.Error())
+		writeOAuthError(w, err)
 		return
 	}
+	writeJSON(w, http.StatusOK, prompt)
+}
 
-	// Return authorization code
-	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"code":         authCode.Code,
-		"state":        state,
-		"redirect_uri": redirectURI,
-	})
+// HandleConsents lets the logged-in user list their grants at /consents and
+// revoke one at /consents/{client_id}
+func HandleConsents(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		handleCORS(w)
+		return
+	}
+
+	provider := middleware.GetOIDCProvider()
+	session, err := provider.AuthenticateSession(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "Login required")
+		return
+	}
+
+	clientID := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/consents"), "/")
+	switch {
+	case clientID == "" && r.Method == "GET":
+		grants, err := provider.ListConsents(session.UserID)
+		if err != nil {
+			writeOAuthError(w, err)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, http.StatusOK, map[string]interface{}{"consents": grants})
+
+	case clientID != "" && r.Method == "DELETE":
+		if err := provider.RevokeConsent(session.UserID, clientID); err != nil {
+			writeOAuthError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// HandlePasskeys lets the logged-in user enroll a passkey: POST
+// /passkeys/challenge issues a creation challenge and POST /passkeys
+// registers the authenticator's response to it
+func HandlePasskeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		handleCORS(w)
+		return
+	}
+
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	provider := middleware.GetOIDCProvider()
+	w.Header().Set("Cache-Control", "no-store")
+	switch r.URL.Path {
+	case "/passkeys/challenge":
+		enrollment, err := provider.BeginPasskeyEnrollment(r)
+		if err != nil {
+			writeOAuthError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, enrollment)
+
+	case "/passkeys":
+		credential, err := provider.EnrollPasskey(r)
+		if err != nil {
+			writeOAuthError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string]interface{}{"credential_id": credential.ID})
+
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
 }
 
 // handleToken handles token requests
@@ -351,11 +463,19 @@ func HandleToken(w http.ResponseWriter, r *http.Request) {
 	req.GrantType = r.FormValue("grant_type")
 	req.Code = r.FormValue("code")
 	req.RedirectURI = r.FormValue("redirect_uri")
-	req.ClientID = r.FormValue("client_id")
-	req.ClientSecret = r.FormValue("client_secret")
 	req.RefreshToken = r.FormValue("refresh_token")
 	req.Scope = r.FormValue("scope")
 	req.CodeVerifier = r.FormValue("code_verifier")
+	req.Resource = r.Form["resource"]
+	req.DeviceCode = r.FormValue("device_code")
+	req.SubjectToken = r.FormValue("subject_token")
+	req.SubjectTokenType = r.FormValue("subject_token_type")
+	req.RequestedTokenType = r.FormValue("requested_token_type")
+	req.Audience = r.Form["audience"]
+	if err := parseClientAuthentication(r, &req); err != nil {
+		writeOAuthError(w, err)
+		return
+	}
 
 	// Handle based on grant type
 	var resp *middleware.TokenResponse
@@ -365,22 +485,126 @@ func HandleToken(w http.ResponseWriter, r *http.Request) {
 	case "authorization_code":
 		resp, err = middleware.GetOIDCProvider().ExchangeCode(&req)
 	case "refresh_token":
-		// TODO: Implement refresh token flow
-		writeError(w, http.StatusNotImplemented, "Refresh token not yet implemented")
+		resp, err = middleware.GetOIDCProvider().RefreshTokens(&req)
+	case "client_credentials":
+		resp, err = middleware.GetOIDCProvider().ClientCredentialsGrant(&req)
+	case middleware.GrantTypeDeviceCode:
+		resp, err = middleware.GetOIDCProvider().DeviceCodeGrant(&req)
+	case middleware.GrantTypeTokenExchange:
+		resp, err = middleware.GetOIDCProvider().ExchangeToken(&req)
+	default:
+		err = middleware.NewOAuthError(middleware.ErrCodeUnsupportedGrantType, "Unsupported grant type")
+	}
+
+	if err != nil {
+		writeOAuthError(w, err)
 		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// HandleDeviceAuthorization issues a device code and user code to a client
+// without a browser (RFC 8628)
+func HandleDeviceAuthorization(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		handleCORS(w)
+		return
+	}
+
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req middleware.TokenRequest
+	req.Scope = r.FormValue("scope")
+	if err := parseClientAuthentication(r, &req); err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	resp, err := middleware.GetOIDCProvider().AuthorizeDevice(&req)
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// HandleDevice is the verification URI: GET shows the user code form and
+// POST starts the login and consent interaction for the entered code
+func HandleDevice(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "OPTIONS":
+		handleCORS(w)
+	case "GET":
+		writeDeviceForm(w, r.FormValue("user_code"))
+	case "POST":
+		outcome, err := middleware.GetOIDCProvider().VerifyUserCode(r, r.FormValue("user_code"))
+		writeAuthorizationOutcome(w, r, outcome, err)
 	default:
-		writeError(w, http.StatusBadRequest, "Unsupported grant type")
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// HandleIntrospect describes a token to an authenticated resource server
+// (RFC 7662)
+func HandleIntrospect(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		handleCORS(w)
 		return
 	}
 
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req middleware.TokenRequest
+	if err := parseClientAuthentication(r, &req); err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	resp, err := middleware.GetOIDCProvider().IntrospectToken(&req, r.FormValue("token"), r.FormValue("token_type_hint"))
 	if err != nil {
-		writeError(w, http.StatusBadRequest, err.Error())
+		writeOAuthError(w, err)
 		return
 	}
 
+	w.Header().Set("Cache-Control", "no-store")
 	writeJSON(w, http.StatusOK, resp)
 }
 
+// HandleRevoke revokes a token issued to the authenticated client (RFC 7009)
+func HandleRevoke(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		handleCORS(w)
+		return
+	}
+
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req middleware.TokenRequest
+	if err := parseClientAuthentication(r, &req); err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	if err := middleware.GetOIDCProvider().RevokeToken(&req, r.FormValue("token"), r.FormValue("token_type_hint")); err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
 // handleUserInfo returns user information
 func HandleUserInfo(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "OPTIONS" {
@@ -418,3 +642,99 @@ func HandleUserInfo(w http.ResponseWriter, r *http.Request) {
 
 	writeJSON(w, http.StatusOK, userInfo)
 }
+
+// HandleRegister handles dynamic client registration (RFC 7591)
+func HandleRegister(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		handleCORS(w)
+		return
+	}
+
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var metadata middleware.ClientMetadata
+	if err := json.NewDecoder(r.Body).Decode(&metadata); err != nil {
+		writeOAuthError(w, middleware.NewOAuthError(middleware.ErrCodeInvalidClientMetadata, "Invalid request body"))
+		return
+	}
+
+	// The initial access token is optional when a software statement
+	// authorizes the registration
+	initialAccessToken, _ := bearerToken(r)
+	info, err := middleware.GetOIDCProvider().RegisterClient(&metadata, initialAccessToken)
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusCreated, info)
+}
+
+// HandleClientConfiguration reads, updates and deletes registered clients
+// at /register/{client_id} (RFC 7592)
+func HandleClientConfiguration(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		handleCORS(w)
+		return
+	}
+
+	clientID := strings.TrimPrefix(r.URL.Path, "/register/")
+	if clientID == "" || strings.Contains(clientID, "/") {
+		writeError(w, http.StatusNotFound, "Client not found")
+		return
+	}
+
+	token, ok := bearerToken(r)
+	if !ok {
+		writeOAuthError(w, middleware.NewOAuthError(middleware.ErrCodeInvalidToken, "Missing registration access token"))
+		return
+	}
+
+	provider := middleware.GetOIDCProvider()
+	switch r.Method {
+	case "GET":
+		info, err := provider.GetClientConfiguration(clientID, token)
+		if err != nil {
+			writeOAuthError(w, err)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, http.StatusOK, info)
+
+	case "PUT":
+		var metadata struct {
+			middleware.ClientMetadata
+			ClientID string `json:"client_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&metadata); err != nil {
+			writeOAuthError(w, middleware.NewOAuthError(middleware.ErrCodeInvalidClientMetadata, "Invalid request body"))
+			return
+		}
+		if metadata.ClientID != clientID {
+			writeOAuthError(w, middleware.NewOAuthError(middleware.ErrCodeInvalidClientMetadata, "client_id does not match"))
+			return
+		}
+
+		info, err := provider.UpdateClientConfiguration(clientID, token, &metadata.ClientMetadata)
+		if err != nil {
+			writeOAuthError(w, err)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, http.StatusOK, info)
+
+	case "DELETE":
+		if err := provider.DeleteClientConfiguration(clientID, token); err != nil {
+			writeOAuthError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
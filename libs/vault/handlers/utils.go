@@ -4,9 +4,17 @@
 package handlers
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"html/template"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
+
+	"motr/middleware"
 )
 
 // Helper Functions
@@ -36,3 +44,160 @@ func generateID() string {
 func writeError(w http.ResponseWriter, status int, message string) {
 	writeJSON(w, status, map[string]string{"error": message})
 }
+
+// writeOAuthError writes an RFC 6749 error response
+func writeOAuthError(w http.ResponseWriter, err error) {
+	var oauthErr *middleware.OAuthError
+	if !errors.As(err, &oauthErr) {
+		oauthErr = middleware.NewOAuthError(middleware.ErrCodeInvalidRequest, "%s", err.Error())
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if oauthErr.Code == middleware.ErrCodeInvalidToken {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	} else if oauthErr.Status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="motor"`)
+	}
+	writeJSON(w, oauthErr.Status, oauthErr)
+}
+
+// parseClientAuthentication reads client credentials from the form and the
+// Authorization header (client_secret_basic) into req
+func parseClientAuthentication(r *http.Request, req *middleware.TokenRequest) error {
+	req.ClientID = r.FormValue("client_id")
+	req.ClientSecret = r.FormValue("client_secret")
+	req.ClientAssertionType = r.FormValue("client_assertion_type")
+	req.ClientAssertion = r.FormValue("client_assertion")
+
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		return nil
+	}
+	if req.ClientSecret != "" {
+		return middleware.NewOAuthError(middleware.ErrCodeInvalidRequest, "multiple client authentication methods used")
+	}
+	clientID, errID := url.QueryUnescape(user)
+	secret, errSecret := url.QueryUnescape(pass)
+	if errID != nil || errSecret != nil || (req.ClientID != "" && req.ClientID != clientID) {
+		return middleware.NewOAuthError(middleware.ErrCodeInvalidClient, "invalid client credentials")
+	}
+	req.ClientID = clientID
+	req.ClientSecret = secret
+	req.AuthMethod = middleware.AuthMethodClientSecretBasic
+	return nil
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer" header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+// writeAuthorizationOutcome redirects the user agent to the client or the
+// interaction UI, or returns the pending prompt as JSON
+func writeAuthorizationOutcome(w http.ResponseWriter, r *http.Request, outcome *middleware.AuthorizationOutcome, err error) {
+	if err != nil {
+		var authErr *middleware.AuthorizationError
+		if !errors.As(err, &authErr) || authErr.RedirectURI == "" {
+			writeOAuthError(w, err)
+			return
+		}
+		outcome = authErr.Outcome()
+	}
+
+	if outcome.Session != nil {
+		http.SetCookie(w, &http.Cookie{
+			Name:     middleware.SessionCookieName,
+			Value:    outcome.Session.ID,
+			Path:     "/",
+			Expires:  outcome.Session.ExpiresAt,
+			HttpOnly: true,
+			Secure:   true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	switch {
+	case outcome.Device != nil:
+		writeJSON(w, http.StatusOK, outcome.Device)
+	case outcome.FormPost != nil:
+		writeFormPost(w, outcome.FormPost)
+	case outcome.RedirectURL != "":
+		http.Redirect(w, r, outcome.RedirectURL, http.StatusFound)
+	case outcome.PromptURL != "":
+		http.Redirect(w, r, outcome.PromptURL, http.StatusFound)
+	default:
+		writeJSON(w, http.StatusOK, outcome.Prompt)
+	}
+}
+
+// formPostTemplate auto-submits authorization response parameters to the
+// client (OAuth 2.0 Form Post Response Mode)
+var formPostTemplate = template.Must(template.New("form_post").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Submit This Form</title></head>
+<body>
+<form method="post" action="{{.Action}}">
+{{range $name, $values := .Params}}{{range $values}}<input type="hidden" name="{{$name}}" value="{{.}}">
+{{end}}{{end}}<noscript><button type="submit">Continue</button></noscript>
+</form>
+<script nonce="{{.Nonce}}">document.forms[0].submit();</script>
+</body>
+</html>
+`))
+
+// writeFormPost renders a form_post authorization response. The redirect URI
+// is left to html/template's URL escaping, so a scheme it does not trust
+// never becomes the form action; the page's script is allowed through a
+// per-response CSP nonce.
+func writeFormPost(w http.ResponseWriter, resp *middleware.FormPostResponse) {
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	scriptNonce := base64.StdEncoding.EncodeToString(nonce)
+
+	// Allow the form to submit only to the redirect URI's origin, or its
+	// scheme for native app redirect URIs
+	formAction := "'none'"
+	if u, err := url.Parse(resp.Action); err == nil {
+		formAction = u.Scheme + ":"
+		if u.Host != "" {
+			formAction = u.Scheme + "://" + u.Host
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; script-src 'nonce-"+scriptNonce+"'; form-action "+formAction)
+	w.WriteHeader(http.StatusOK)
+	formPostTemplate.Execute(w, struct {
+		Action string
+		Params map[string][]string
+		Nonce  string
+	}{resp.Action, resp.Params, scriptNonce})
+}
+
+// deviceFormTemplate asks the user for the code shown on their device
+var deviceFormTemplate = template.Must(template.New("device").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Connect a Device</title></head>
+<body>
+<form method="post">
+<label for="user_code">Enter the code shown on your device</label>
+<input id="user_code" name="user_code" value="{{.}}" autocomplete="off" autocapitalize="characters" required>
+<button type="submit">Continue</button>
+</form>
+</body>
+</html>
+`))
+
+// writeDeviceForm renders the user code form, prefilled from
+// verification_uri_complete
+func writeDeviceForm(w http.ResponseWriter, userCode string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; form-action 'self'")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	deviceFormTemplate.Execute(w, userCode)
+}
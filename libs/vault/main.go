@@ -22,7 +22,7 @@ func main() {
 	log.Println("Available endpoints:")
 	log.Println("  Health: /health, /status")
 	log.Println("  Payment API: /api/payment/*")
-	log.Println("  OIDC: /.well-known/*, /authorize, /token, /userinfo")
+	log.Println("  OIDC: /.well-known/*, /authorize, /token, /userinfo, /introspect, /revoke, /device_authorization, /device, /register, /consents, /passkeys")
 
 	wasmhttp.Serve(nil)
 }
@@ -48,6 +48,19 @@ func setupRoutes() {
 	http.HandleFunc("/.well-known/openid-configuration", handlers.HandleOIDCDiscovery) // No rate limit for discovery
 	http.HandleFunc("/.well-known/jwks.json", handlers.HandleJWKS)                     // No rate limit for JWKS
 	http.HandleFunc("/authorize", middleware.SecurityMiddleware(handlers.HandleAuthorize))
+	http.HandleFunc("/authorize/login", middleware.SecurityMiddleware(handlers.HandleAuthorizeLogin))
+	http.HandleFunc("/authorize/consent", middleware.SecurityMiddleware(handlers.HandleAuthorizeConsent))
+	http.HandleFunc("/authorize/interaction", middleware.SecurityMiddleware(handlers.HandleAuthorizeInteraction))
+	http.HandleFunc("/consents", middleware.SecurityMiddleware(handlers.HandleConsents))
+	http.HandleFunc("/consents/", middleware.SecurityMiddleware(handlers.HandleConsents))
+	http.HandleFunc("/passkeys", middleware.SecurityMiddleware(handlers.HandlePasskeys))
+	http.HandleFunc("/passkeys/challenge", middleware.SecurityMiddleware(handlers.HandlePasskeys))
 	http.HandleFunc("/token", middleware.SecurityMiddleware(handlers.HandleToken))
 	http.HandleFunc("/userinfo", middleware.SecurityMiddleware(handlers.HandleUserInfo))
+	http.HandleFunc("/introspect", middleware.SecurityMiddleware(handlers.HandleIntrospect))
+	http.HandleFunc("/revoke", middleware.SecurityMiddleware(handlers.HandleRevoke))
+	http.HandleFunc("/device_authorization", middleware.SecurityMiddleware(handlers.HandleDeviceAuthorization))
+	http.HandleFunc("/device", middleware.SecurityMiddleware(handlers.HandleDevice))
+	http.HandleFunc("/register", middleware.SecurityMiddleware(handlers.HandleRegister))
+	http.HandleFunc("/register/", middleware.SecurityMiddleware(handlers.HandleClientConfiguration))
 }
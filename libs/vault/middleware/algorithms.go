@@ -0,0 +1,347 @@
+//go:build js && wasm
+// +build js,wasm
+
+package middleware
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	k1ecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+// JWS algorithms the provider signs and verifies with
+const (
+	AlgRS256  = "RS256"
+	AlgES256  = "ES256"
+	AlgES256K = "ES256K"
+	AlgEdDSA  = "EdDSA"
+)
+
+// signingAlgorithm implements a JWS algorithm (RFC 7518, RFC 8037, RFC 8812)
+type signingAlgorithm interface {
+	generateKey() (crypto.PrivateKey, error)
+	sign(key crypto.PrivateKey, input []byte) ([]byte, error)
+	verify(key crypto.PublicKey, input, signature []byte) error
+	// hash digests values for the at_hash and c_hash ID token claims
+	hash(data []byte) []byte
+}
+
+// signingAlgorithms lists the supported algorithms by JWS alg
+var signingAlgorithms = map[string]signingAlgorithm{
+	AlgRS256:  rs256{},
+	AlgES256:  es256{},
+	AlgES256K: es256k{},
+	AlgEdDSA:  edDSA{},
+}
+
+// supportedAlgorithms lists every supported JWS alg in a stable order
+var supportedAlgorithms = []string{AlgRS256, AlgES256, AlgES256K, AlgEdDSA}
+
+type rs256 struct{}
+
+func (rs256) generateKey() (crypto.PrivateKey, error) {
+	return rsa.GenerateKey(rand.Reader, 2048)
+}
+
+func (rs256) sign(key crypto.PrivateKey, input []byte) ([]byte, error) {
+	private, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("key does not match algorithm %s", AlgRS256)
+	}
+	hash := sha256.Sum256(input)
+	return rsa.SignPKCS1v15(rand.Reader, private, crypto.SHA256, hash[:])
+}
+
+func (rs256) verify(key crypto.PublicKey, input, signature []byte) error {
+	pub, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("key does not match algorithm %s", AlgRS256)
+	}
+	hash := sha256.Sum256(input)
+	return rsa.VerifyPKCS1v15(pub, crypto.SHA256, hash[:], signature)
+}
+
+func (rs256) hash(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+type es256 struct{}
+
+func (es256) generateKey() (crypto.PrivateKey, error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+func (es256) sign(key crypto.PrivateKey, input []byte) ([]byte, error) {
+	private, ok := key.(*ecdsa.PrivateKey)
+	if !ok || private.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("key does not match algorithm %s", AlgES256)
+	}
+	hash := sha256.Sum256(input)
+	r, s, err := ecdsa.Sign(rand.Reader, private, hash[:])
+	if err != nil {
+		return nil, err
+	}
+	// JWS uses the fixed-width r || s encoding, not ASN.1
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return signature, nil
+}
+
+func (es256) verify(key crypto.PublicKey, input, signature []byte) error {
+	pub, ok := key.(*ecdsa.PublicKey)
+	if !ok || pub.Curve != elliptic.P256() || len(signature) != 64 {
+		return fmt.Errorf("key does not match algorithm %s", AlgES256)
+	}
+	hash := sha256.Sum256(input)
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	if !ecdsa.Verify(pub, hash[:], r, s) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+func (es256) hash(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+// es256k is ECDSA over secp256k1, the enclave's curve (RFC 8812)
+type es256k struct{}
+
+func (es256k) generateKey() (crypto.PrivateKey, error) {
+	return secp256k1.GeneratePrivateKey()
+}
+
+func (es256k) sign(key crypto.PrivateKey, input []byte) ([]byte, error) {
+	private, ok := key.(*secp256k1.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("key does not match algorithm %s", AlgES256K)
+	}
+	hash := sha256.Sum256(input)
+	// Drop the recovery code; JWS uses r || s
+	return k1ecdsa.SignCompact(private, hash[:], false)[1:], nil
+}
+
+func (es256k) verify(key crypto.PublicKey, input, signature []byte) error {
+	pub, ok := key.(*secp256k1.PublicKey)
+	if !ok || len(signature) != 64 {
+		return fmt.Errorf("key does not match algorithm %s", AlgES256K)
+	}
+	var r, s secp256k1.ModNScalar
+	if r.SetByteSlice(signature[:32]) || s.SetByteSlice(signature[32:]) {
+		return fmt.Errorf("invalid signature")
+	}
+	hash := sha256.Sum256(input)
+	if !k1ecdsa.NewSignature(&r, &s).Verify(hash[:], pub) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+func (es256k) hash(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+// edDSA is EdDSA with Ed25519 keys (RFC 8037)
+type edDSA struct{}
+
+func (edDSA) generateKey() (crypto.PrivateKey, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	return private, err
+}
+
+func (edDSA) sign(key crypto.PrivateKey, input []byte) ([]byte, error) {
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("key does not match algorithm %s", AlgEdDSA)
+	}
+	return ed25519.Sign(private, input), nil
+}
+
+func (edDSA) verify(key crypto.PublicKey, input, signature []byte) error {
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return fmt.Errorf("key does not match algorithm %s", AlgEdDSA)
+	}
+	if !ed25519.Verify(pub, input, signature) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+// hash is SHA-512, the hash Ed25519 is built on
+func (edDSA) hash(data []byte) []byte {
+	sum := sha512.Sum512(data)
+	return sum[:]
+}
+
+// algorithmForKey returns the JWS alg a private key signs with
+func algorithmForKey(key crypto.PrivateKey) (string, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return AlgRS256, nil
+	case *ecdsa.PrivateKey:
+		if k.Curve == elliptic.P256() {
+			return AlgES256, nil
+		}
+		return "", fmt.Errorf("unsupported curve %s", k.Curve.Params().Name)
+	case *secp256k1.PrivateKey:
+		return AlgES256K, nil
+	case ed25519.PrivateKey:
+		return AlgEdDSA, nil
+	default:
+		return "", fmt.Errorf("unsupported key type %T", key)
+	}
+}
+
+// publicKeyOf returns the public half of a private key
+func publicKeyOf(key crypto.PrivateKey) crypto.PublicKey {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return &k.PublicKey
+	case *ecdsa.PrivateKey:
+		return &k.PublicKey
+	case *secp256k1.PrivateKey:
+		return k.PubKey()
+	case ed25519.PrivateKey:
+		return k.Public()
+	default:
+		return nil
+	}
+}
+
+// publicJWKMembers returns the members that identify a public key in a JWK,
+// which are also the members its RFC 7638 thumbprint covers
+func publicJWKMembers(pub crypto.PublicKey) map[string]string {
+	b64 := base64.RawURLEncoding.EncodeToString
+	coordinate := func(v *big.Int) string {
+		return b64(v.FillBytes(make([]byte, 32)))
+	}
+
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return map[string]string{"kty": "RSA", "n": b64(k.N.Bytes()), "e": b64(big.NewInt(int64(k.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		return map[string]string{"kty": "EC", "crv": "P-256", "x": coordinate(k.X), "y": coordinate(k.Y)}
+	case *secp256k1.PublicKey:
+		return map[string]string{"kty": "EC", "crv": "secp256k1", "x": coordinate(k.X()), "y": coordinate(k.Y())}
+	case ed25519.PublicKey:
+		return map[string]string{"kty": "OKP", "crv": "Ed25519", "x": b64(k)}
+	default:
+		return nil
+	}
+}
+
+// jwkThumbprint returns the RFC 7638 SHA-256 thumbprint of a public key,
+// used as its kid so that every instance names the same key the same way
+func jwkThumbprint(pub crypto.PublicKey) string {
+	// encoding/json sorts map keys and adds no whitespace, which is the
+	// canonical form the thumbprint requires
+	canonical, _ := json.Marshal(publicJWKMembers(pub))
+	digest := sha256.Sum256(canonical)
+	return base64.RawURLEncoding.EncodeToString(digest[:])
+}
+
+// privateJWK encodes a private key as a JWK for storage
+func privateJWK(key crypto.PrivateKey) (map[string]string, error) {
+	jwk := publicJWKMembers(publicKeyOf(key))
+	if jwk == nil {
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		jwk["d"] = b64(k.D.Bytes())
+		jwk["p"] = b64(k.Primes[0].Bytes())
+		jwk["q"] = b64(k.Primes[1].Bytes())
+	case *ecdsa.PrivateKey:
+		jwk["d"] = b64(k.D.FillBytes(make([]byte, 32)))
+	case *secp256k1.PrivateKey:
+		jwk["d"] = b64(k.Serialize())
+	case ed25519.PrivateKey:
+		jwk["d"] = b64(k.Seed())
+	}
+	return jwk, nil
+}
+
+// parsePrivateJWK decodes an RSA, EC (P-256 or secp256k1) or OKP (Ed25519)
+// private JWK, checking that the private key matches the public members
+func parsePrivateJWK(encoded string) (crypto.PrivateKey, error) {
+	var jwk map[string]interface{}
+	if err := json.Unmarshal([]byte(encoded), &jwk); err != nil {
+		return nil, fmt.Errorf("invalid JWK: %w", err)
+	}
+	pub, err := publicKeyFromJWK(jwk)
+	if err != nil {
+		return nil, err
+	}
+	field := func(name string) ([]byte, error) {
+		s, _ := jwk[name].(string)
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("jwk is missing %q", name)
+		}
+		return b, nil
+	}
+	d, err := field("d")
+	if err != nil {
+		return nil, err
+	}
+
+	var private crypto.PrivateKey
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		p, err := field("p")
+		if err != nil {
+			return nil, err
+		}
+		q, err := field("q")
+		if err != nil {
+			return nil, err
+		}
+		rsaKey := &rsa.PrivateKey{
+			PublicKey: *k,
+			D:         new(big.Int).SetBytes(d),
+			Primes:    []*big.Int{new(big.Int).SetBytes(p), new(big.Int).SetBytes(q)},
+		}
+		if err := rsaKey.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid JWK: %w", err)
+		}
+		rsaKey.Precompute()
+		return rsaKey, nil
+	case *ecdsa.PublicKey:
+		private = &ecdsa.PrivateKey{PublicKey: *k, D: new(big.Int).SetBytes(d)}
+		x, y := k.Curve.ScalarBaseMult(d)
+		if x.Cmp(k.X) != 0 || y.Cmp(k.Y) != 0 {
+			return nil, fmt.Errorf("invalid JWK: private key does not match public key")
+		}
+	case *secp256k1.PublicKey:
+		private = secp256k1.PrivKeyFromBytes(d)
+	case ed25519.PublicKey:
+		if len(d) != ed25519.SeedSize {
+			return nil, fmt.Errorf("invalid JWK: Ed25519 seed must be %d bytes", ed25519.SeedSize)
+		}
+		private = ed25519.NewKeyFromSeed(d)
+	}
+
+	if jwkThumbprint(publicKeyOf(private)) != jwkThumbprint(pub) {
+		return nil, fmt.Errorf("invalid JWK: private key does not match public key")
+	}
+	return private, nil
+}
@@ -0,0 +1,434 @@
+//go:build js && wasm
+// +build js,wasm
+
+package middleware
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// Authentication methods
+const (
+	AuthenticatorSession  = "session"
+	AuthenticatorWebAuthn = "webauthn"
+)
+
+// SessionCookieName is the cookie carrying the end-user login session
+const SessionCookieName = "motor_session"
+
+// loginSessionTTL bounds how long a login session is reused by /authorize
+const loginSessionTTL = 24 * time.Hour
+
+// passkeyChallengeTTL bounds how long a passkey enrollment challenge is valid
+const passkeyChallengeTTL = 5 * time.Minute
+
+// ErrNoCredentials is returned by an Authenticator when the request carries
+// no credentials for its method
+var ErrNoCredentials = errors.New("no credentials presented")
+
+// AuthResult identifies the end user authenticated for an interaction
+type AuthResult struct {
+	UserID   string
+	AuthTime time.Time
+	// AMR lists authentication method references (RFC 8176)
+	AMR []string
+	// SessionID is set when the result came from an existing login session
+	SessionID string
+}
+
+// Authenticator verifies the end user during an authorization interaction.
+// Implementations return ErrNoCredentials when the request does not use
+// their method, so several authenticators can be tried in turn.
+type Authenticator interface {
+	Method() string
+	Authenticate(r *http.Request, interaction *Interaction, storage OIDCStorage) (*AuthResult, error)
+}
+
+// LoginSession is an authenticated end-user session referenced by the
+// session cookie
+type LoginSession struct {
+	ID        string
+	UserID    string
+	AuthTime  time.Time
+	AMR       []string
+	ExpiresAt time.Time
+	// PasskeyChallenge is the pending passkey enrollment challenge, if any
+	PasskeyChallenge          string
+	PasskeyChallengeExpiresAt time.Time
+}
+
+// SessionAuthenticator re-authenticates users holding a live login session
+// cookie
+type SessionAuthenticator struct{}
+
+func (SessionAuthenticator) Method() string {
+	return AuthenticatorSession
+}
+
+func (SessionAuthenticator) Authenticate(r *http.Request, _ *Interaction, storage OIDCStorage) (*AuthResult, error) {
+	cookie, err := r.Cookie(SessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return nil, ErrNoCredentials
+	}
+
+	session, err := storage.GetLoginSession(cookie.Value)
+	if err != nil {
+		return nil, ErrNoCredentials
+	}
+	return &AuthResult{
+		UserID:    session.UserID,
+		AuthTime:  session.AuthTime,
+		AMR:       session.AMR,
+		SessionID: session.ID,
+	}, nil
+}
+
+// WebAuthnCredential is a passkey registered to a user. The public key is
+// held as a JWK (ES256 or RS256).
+type WebAuthnCredential struct {
+	ID        string
+	PublicKey map[string]interface{}
+	SignCount uint32
+}
+
+// WebAuthnAuthenticator verifies passkey assertions over the interaction
+// challenge. The assertion is posted as base64url form fields:
+// user_handle, credential_id, client_data_json, authenticator_data and
+// signature.
+type WebAuthnAuthenticator struct {
+	RPID    string
+	Origins []string
+}
+
+// NewWebAuthnAuthenticator creates a passkey authenticator for a relying
+// party ID and the origins allowed to request assertions
+func NewWebAuthnAuthenticator(rpID string, origins []string) *WebAuthnAuthenticator {
+	return &WebAuthnAuthenticator{RPID: rpID, Origins: origins}
+}
+
+func (a *WebAuthnAuthenticator) Method() string {
+	return AuthenticatorWebAuthn
+}
+
+// WebAuthn authenticator data flags
+const (
+	webauthnFlagUserPresent        = 0x01
+	webauthnFlagUserVerified       = 0x04
+	webauthnFlagAttestedCredential = 0x40
+)
+
+// webauthnField decodes a base64url form field of a WebAuthn response
+func webauthnField(r *http.Request, name string) ([]byte, error) {
+	v, err := base64.RawURLEncoding.DecodeString(r.FormValue(name))
+	if err != nil || len(v) == 0 {
+		return nil, fmt.Errorf("invalid %s", name)
+	}
+	return v, nil
+}
+
+func (a *WebAuthnAuthenticator) Authenticate(r *http.Request, interaction *Interaction, storage OIDCStorage) (*AuthResult, error) {
+	if r.FormValue("credential_id") == "" {
+		return nil, ErrNoCredentials
+	}
+
+	userHandle, err := webauthnField(r, "user_handle")
+	if err != nil {
+		return nil, err
+	}
+	clientDataJSON, err := webauthnField(r, "client_data_json")
+	if err != nil {
+		return nil, err
+	}
+	authData, err := webauthnField(r, "authenticator_data")
+	if err != nil {
+		return nil, err
+	}
+	signature, err := webauthnField(r, "signature")
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := storage.GetUser(string(userHandle))
+	if err != nil {
+		return nil, fmt.Errorf("unknown user")
+	}
+	idx := slices.IndexFunc(user.Credentials, func(c WebAuthnCredential) bool {
+		return c.ID == r.FormValue("credential_id")
+	})
+	if idx < 0 {
+		return nil, fmt.Errorf("unknown credential")
+	}
+	cred := &user.Credentials[idx]
+
+	// Client data must be a get ceremony for this interaction's challenge
+	if err := a.checkClientData(clientDataJSON, "webauthn.get", interaction.Challenge); err != nil {
+		return nil, err
+	}
+	flags, signCount, err := a.checkAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+	if (signCount != 0 || cred.SignCount != 0) && signCount <= cred.SignCount {
+		return nil, fmt.Errorf("signature counter did not increase; credential may be cloned")
+	}
+
+	// Signature covers authenticatorData || SHA-256(clientDataJSON)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	key, err := publicKeyFromJWK(cred.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid credential key: %w", err)
+	}
+	switch pub := key.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, digest[:], signature) {
+			return nil, fmt.Errorf("invalid assertion signature")
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature); err != nil {
+			return nil, fmt.Errorf("invalid assertion signature")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported credential key")
+	}
+
+	cred.SignCount = signCount
+	if err := storage.SaveUser(user); err != nil {
+		return nil, fmt.Errorf("failed to update credential: %w", err)
+	}
+
+	amr := []string{"hwk"}
+	if flags&webauthnFlagUserVerified != 0 {
+		amr = append(amr, "mfa")
+	}
+	return &AuthResult{
+		UserID:   user.ID,
+		AuthTime: time.Now(),
+		AMR:      amr,
+	}, nil
+}
+
+// Register verifies a passkey creation response over challenge and returns
+// the new credential. The response is posted as base64url form fields:
+// client_data_json, authenticator_data, and public_key, the
+// SubjectPublicKeyInfo from AuthenticatorAttestationResponse.getPublicKey().
+// Attestation statements are not requested or checked.
+func (a *WebAuthnAuthenticator) Register(r *http.Request, challenge string) (*WebAuthnCredential, error) {
+	clientDataJSON, err := webauthnField(r, "client_data_json")
+	if err != nil {
+		return nil, err
+	}
+	authData, err := webauthnField(r, "authenticator_data")
+	if err != nil {
+		return nil, err
+	}
+	spki, err := webauthnField(r, "public_key")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.checkClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+	flags, signCount, err := a.checkAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+
+	// Attested credential data: aaguid(16) | idLength(2) | id | publicKey
+	if flags&webauthnFlagAttestedCredential == 0 || len(authData) < 55 {
+		return nil, fmt.Errorf("authenticator data carries no credential")
+	}
+	idLength := int(binary.BigEndian.Uint16(authData[53:55]))
+	if idLength == 0 || len(authData) < 55+idLength {
+		return nil, fmt.Errorf("invalid credential id")
+	}
+	credentialID := authData[55 : 55+idLength]
+
+	pub, err := x509.ParsePKIXPublicKey(spki)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public_key")
+	}
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("unsupported credential curve")
+		}
+	case *rsa.PublicKey:
+	default:
+		return nil, fmt.Errorf("unsupported credential key")
+	}
+	jwk := map[string]interface{}{}
+	for name, v := range publicJWKMembers(pub) {
+		jwk[name] = v
+	}
+
+	return &WebAuthnCredential{
+		ID:        base64.RawURLEncoding.EncodeToString(credentialID),
+		PublicKey: jwk,
+		SignCount: signCount,
+	}, nil
+}
+
+// checkClientData checks the ceremony type, challenge and origin of a
+// WebAuthn response
+func (a *WebAuthnAuthenticator) checkClientData(clientDataJSON []byte, ceremony, challenge string) error {
+	var clientData struct {
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+		Origin    string `json:"origin"`
+	}
+	if err := json.Unmarshal(clientDataJSON, &clientData); err != nil {
+		return fmt.Errorf("invalid client data")
+	}
+	if clientData.Type != ceremony {
+		return fmt.Errorf("unexpected ceremony type %q", clientData.Type)
+	}
+	if clientData.Challenge != challenge {
+		return fmt.Errorf("challenge mismatch")
+	}
+	if !slices.Contains(a.Origins, clientData.Origin) {
+		return fmt.Errorf("origin %q is not allowed", clientData.Origin)
+	}
+	return nil
+}
+
+// checkAuthenticatorData checks the RP ID hash and user presence, returning
+// the flags and signature counter.
+// Authenticator data: rpIdHash(32) | flags(1) | signCount(4) | ...
+func (a *WebAuthnAuthenticator) checkAuthenticatorData(authData []byte) (byte, uint32, error) {
+	if len(authData) < 37 {
+		return 0, 0, fmt.Errorf("authenticator data too short")
+	}
+	rpIDHash := sha256.Sum256([]byte(a.RPID))
+	if !bytes.Equal(authData[:32], rpIDHash[:]) {
+		return 0, 0, fmt.Errorf("rp id mismatch")
+	}
+	flags := authData[32]
+	if flags&webauthnFlagUserPresent == 0 {
+		return 0, 0, fmt.Errorf("user presence required")
+	}
+	return flags, binary.BigEndian.Uint32(authData[33:37]), nil
+}
+
+// PasskeyEnrollment is the challenge a logged-in user's authenticator signs
+// to register a passkey. UserHandle is the base64url user.id to create the
+// credential with; it is sent back as user_handle when signing in.
+type PasskeyEnrollment struct {
+	Challenge  string `json:"challenge"`
+	RPID       string `json:"rp_id"`
+	UserHandle string `json:"user_handle"`
+	UserName   string `json:"user_name,omitempty"`
+	ExpiresAt  int64  `json:"expires_at"`
+}
+
+// BeginPasskeyEnrollment issues a passkey creation challenge to the user
+// holding the request's login session
+func (p *OIDCProvider) BeginPasskeyEnrollment(r *http.Request) (*PasskeyEnrollment, error) {
+	session, webauthn, err := p.passkeyEnrollmentSession(r)
+	if err != nil {
+		return nil, err
+	}
+	user, err := p.storage.GetUser(session.UserID)
+	if err != nil {
+		return nil, NewOAuthError(ErrCodeServerError, "failed to load user: %v", err)
+	}
+
+	challenge, err := generateChallenge()
+	if err != nil {
+		return nil, NewOAuthError(ErrCodeServerError, "%v", err)
+	}
+	session.PasskeyChallenge = challenge
+	session.PasskeyChallengeExpiresAt = time.Now().Add(passkeyChallengeTTL)
+	if err := p.storage.SaveLoginSession(session); err != nil {
+		return nil, NewOAuthError(ErrCodeServerError, "failed to store login session: %v", err)
+	}
+
+	return &PasskeyEnrollment{
+		Challenge:  challenge,
+		RPID:       webauthn.RPID,
+		UserHandle: base64.RawURLEncoding.EncodeToString([]byte(user.ID)),
+		UserName:   user.Username,
+		ExpiresAt:  session.PasskeyChallengeExpiresAt.Unix(),
+	}, nil
+}
+
+// EnrollPasskey verifies the creation response for the session's pending
+// challenge and adds the passkey to the user's credentials. Each challenge
+// is used once, whether or not the response verifies.
+func (p *OIDCProvider) EnrollPasskey(r *http.Request) (*WebAuthnCredential, error) {
+	session, webauthn, err := p.passkeyEnrollmentSession(r)
+	if err != nil {
+		return nil, err
+	}
+	challenge := session.PasskeyChallenge
+	if challenge == "" || time.Now().After(session.PasskeyChallengeExpiresAt) {
+		return nil, NewOAuthError(ErrCodeInvalidRequest, "no pending passkey enrollment")
+	}
+	session.PasskeyChallenge = ""
+	session.PasskeyChallengeExpiresAt = time.Time{}
+	if err := p.storage.SaveLoginSession(session); err != nil {
+		return nil, NewOAuthError(ErrCodeServerError, "failed to store login session: %v", err)
+	}
+
+	credential, err := webauthn.Register(r, challenge)
+	if err != nil {
+		return nil, NewOAuthError(ErrCodeAccessDenied, "passkey registration failed: %v", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	user, err := p.storage.GetUser(session.UserID)
+	if err != nil {
+		return nil, NewOAuthError(ErrCodeServerError, "failed to load user: %v", err)
+	}
+	if slices.ContainsFunc(user.Credentials, func(c WebAuthnCredential) bool { return c.ID == credential.ID }) {
+		return nil, NewOAuthError(ErrCodeInvalidRequest, "passkey is already registered")
+	}
+	user.Credentials = append(user.Credentials, *credential)
+	if err := p.storage.SaveUser(user); err != nil {
+		return nil, NewOAuthError(ErrCodeServerError, "failed to store passkey: %v", err)
+	}
+	return credential, nil
+}
+
+// passkeyEnrollmentSession returns the request's login session and the
+// passkey authenticator that enrolls credentials for it
+func (p *OIDCProvider) passkeyEnrollmentSession(r *http.Request) (*LoginSession, *WebAuthnAuthenticator, error) {
+	p.mu.RLock()
+	var webauthn *WebAuthnAuthenticator
+	for _, a := range p.authenticators {
+		if w, ok := a.(*WebAuthnAuthenticator); ok {
+			webauthn = w
+			break
+		}
+	}
+	p.mu.RUnlock()
+	if webauthn == nil {
+		return nil, nil, NewOAuthError(ErrCodeInvalidRequest, "passkeys are not enabled")
+	}
+
+	result, err := p.AuthenticateSession(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	session, err := p.storage.GetLoginSession(result.SessionID)
+	if err != nil {
+		return nil, nil, NewOAuthError(ErrCodeLoginRequired, "no active login session")
+	}
+	return session, webauthn, nil
+}
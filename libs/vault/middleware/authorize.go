@@ -0,0 +1,534 @@
+//go:build js && wasm
+// +build js,wasm
+
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Authorization endpoint error codes (RFC 6749 section 4.1.2.1)
+const (
+	ErrCodeUnsupportedResponseType = "unsupported_response_type"
+	ErrCodeAccessDenied            = "access_denied"
+)
+
+// Interaction stages
+const (
+	InteractionStageLogin   = "login"
+	InteractionStageConsent = "consent"
+)
+
+// interactionTTL bounds how long a user has to complete login and consent
+const interactionTTL = 10 * time.Minute
+
+// AuthorizationRequest holds the parameters of an authorization request
+type AuthorizationRequest struct {
+	ClientID            string
+	RedirectURI         string
+	ResponseType        string
+	ResponseMode        string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	// Prompt is the space-separated OIDC prompt parameter
+	Prompt string
+}
+
+// Interaction tracks an authorization request while the user logs in and
+// consents
+type Interaction struct {
+	ID      string
+	Stage   string
+	Request AuthorizationRequest
+	// Challenge is the nonce signed by challenge-response authenticators
+	Challenge string
+	UserID    string
+	AuthTime  time.Time
+	AMR       []string
+	SessionID string
+	// DeviceCode is set when the interaction approves a device
+	// authorization rather than answering a redirect-based request
+	DeviceCode string
+	ExpiresAt  time.Time
+}
+
+// InteractionPrompt describes the next step of an interaction to the login
+// and consent UI
+type InteractionPrompt struct {
+	InteractionID string   `json:"interaction_id"`
+	Stage         string   `json:"stage"`
+	Challenge     string   `json:"challenge,omitempty"`
+	Methods       []string `json:"methods,omitempty"`
+	ClientID      string   `json:"client_id"`
+	ClientName    string   `json:"client_name,omitempty"`
+	Scopes        []string `json:"scopes"`
+	// GrantedScopes lists the requested scopes the user already consented
+	// to, so the consent UI can highlight only the new ones
+	GrantedScopes []string `json:"granted_scopes,omitempty"`
+	ExpiresAt     int64    `json:"expires_at"`
+}
+
+// AuthorizationOutcome is the result of an authorization step: either a
+// final response to the client or a prompt for the user
+type AuthorizationOutcome struct {
+	// RedirectURL is set when the flow completed or failed at the client
+	RedirectURL string
+	// FormPost is set instead of RedirectURL for the form_post response mode
+	FormPost *FormPostResponse
+	// Prompt is set when the user must log in or consent
+	Prompt *InteractionPrompt
+	// PromptURL is the interaction UI to send the user agent to, if configured
+	PromptURL string
+	// Session is set when a new login session was established
+	Session *LoginSession
+	// Device is set when a device authorization was approved or denied
+	Device *DeviceVerification
+}
+
+// AuthorizationError is an authorization endpoint error. When RedirectURI is
+// set the client is trusted to receive the error; otherwise it must be shown
+// to the user directly.
+type AuthorizationError struct {
+	*OAuthError
+	RedirectURI  string
+	ResponseMode string
+	State        string
+}
+
+// Outcome renders the error as a response to the client
+func (e *AuthorizationError) Outcome() *AuthorizationOutcome {
+	params := url.Values{"error": {e.Code}}
+	if e.Description != "" {
+		params.Set("error_description", e.Description)
+	}
+	if e.State != "" {
+		params.Set("state", e.State)
+	}
+	return respond(e.RedirectURI, e.ResponseMode, params)
+}
+
+// DefaultAuthenticators returns the built-in authenticators for an issuer.
+// The passkey relying party ID is the issuer host, and the sign-in message
+// domain is its authority. Passkey and sign-in responses may come from the
+// issuer origin or, when set, the interaction UI origin.
+func DefaultAuthenticators(issuer, interactionURL string) ([]Authenticator, error) {
+	u, err := url.Parse(issuer)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid issuer %q", issuer)
+	}
+	origins := []string{u.Scheme + "://" + u.Host}
+	if interactionURL != "" {
+		ui, err := url.Parse(interactionURL)
+		if err != nil || !ui.IsAbs() || ui.Host == "" {
+			return nil, fmt.Errorf("invalid interaction URL %q", interactionURL)
+		}
+		if origin := ui.Scheme + "://" + ui.Host; !slices.Contains(origins, origin) {
+			origins = append(origins, origin)
+		}
+	}
+	return []Authenticator{
+		SessionAuthenticator{},
+		NewWebAuthnAuthenticator(u.Hostname(), origins),
+		NewSIWEAuthenticator(u.Host, origins),
+	}, nil
+}
+
+// SetAuthenticators replaces the authenticators tried during authorization
+func (p *OIDCProvider) SetAuthenticators(authenticators ...Authenticator) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.authenticators = authenticators
+}
+
+// SetIssuer sets the issuer URL advertised in discovery and asserted in
+// tokens. Authenticators are not changed; see DefaultAuthenticators.
+func (p *OIDCProvider) SetIssuer(issuer string) error {
+	u, err := url.Parse(issuer)
+	if err != nil || !u.IsAbs() || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("issuer must be an absolute URL without query or fragment")
+	}
+	issuer = strings.TrimSuffix(issuer, "/")
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.issuer = issuer
+	jwtManager.SetIssuer(issuer)
+	return nil
+}
+
+// SetInteractionURL sets the login and consent UI. When empty, prompts are
+// returned to the user agent as JSON.
+func (p *OIDCProvider) SetInteractionURL(u string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.interactionURL = u
+}
+
+// Authorize starts an authorization request. Users with a live login session
+// go straight to consent, or straight back to the client when they already
+// consented to every requested scope; everyone else is asked to log in.
+// prompt=login forces a fresh login and prompt=none fails instead of
+// prompting.
+func (p *OIDCProvider) Authorize(r *http.Request, req *AuthorizationRequest) (*AuthorizationOutcome, error) {
+	p.mu.RLock()
+	client, err := p.validateAuthorizationRequest(req)
+	authenticators := p.authenticators
+	p.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, err := generateChallenge()
+	if err != nil {
+		return nil, p.authorizationError(req, NewOAuthError(ErrCodeServerError, "%v", err))
+	}
+	interaction := &Interaction{
+		ID:        generateRandomString(32),
+		Stage:     InteractionStageLogin,
+		Request:   *req,
+		Challenge: challenge,
+		ExpiresAt: time.Now().Add(interactionTTL),
+	}
+
+	if !hasPrompt(req.Prompt, PromptLogin) && !hasPrompt(req.Prompt, PromptSelectAccount) {
+		for _, a := range authenticators {
+			result, err := a.Authenticate(r, interaction, p.storage)
+			if err != nil {
+				continue
+			}
+			interaction.authenticated(result)
+			break
+		}
+	}
+
+	return p.advance(interaction, client)
+}
+
+// Login authenticates the user for an interaction with the named method and
+// establishes a login session
+func (p *OIDCProvider) Login(r *http.Request, interactionID, method string) (*AuthorizationOutcome, error) {
+	interaction, client, err := p.loadInteraction(interactionID, InteractionStageLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.RLock()
+	var authenticator Authenticator
+	for _, a := range p.authenticators {
+		if a.Method() == method {
+			authenticator = a
+			break
+		}
+	}
+	p.mu.RUnlock()
+	if authenticator == nil {
+		return nil, NewOAuthError(ErrCodeInvalidRequest, "unsupported authentication method %q", method)
+	}
+
+	result, err := authenticator.Authenticate(r, interaction, p.storage)
+	if errors.Is(err, ErrNoCredentials) {
+		return nil, NewOAuthError(ErrCodeInvalidRequest, "no %s credentials presented", method)
+	}
+	if err != nil {
+		return nil, NewOAuthError(ErrCodeAccessDenied, "authentication failed: %v", err)
+	}
+
+	session := &LoginSession{
+		ID:        generateRandomString(32),
+		UserID:    result.UserID,
+		AuthTime:  result.AuthTime,
+		AMR:       result.AMR,
+		ExpiresAt: time.Now().Add(loginSessionTTL),
+	}
+	if err := p.storage.SaveLoginSession(session); err != nil {
+		return nil, NewOAuthError(ErrCodeServerError, "failed to store login session: %v", err)
+	}
+	result.SessionID = session.ID
+
+	interaction.authenticated(result)
+	outcome, err := p.advance(interaction, client)
+	if err != nil {
+		return nil, err
+	}
+	outcome.Session = session
+	return outcome, nil
+}
+
+// Consent records the user's decision for an interaction and finishes the
+// authorization. Approved scopes are added to the user's consent for the
+// client. The request must carry the session that logged in.
+func (p *OIDCProvider) Consent(r *http.Request, interactionID string, approved bool) (*AuthorizationOutcome, error) {
+	interaction, _, err := p.loadInteraction(interactionID, InteractionStageConsent)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := SessionAuthenticator{}.Authenticate(r, interaction, p.storage)
+	if err != nil || session.UserID != interaction.UserID {
+		return nil, NewOAuthError(ErrCodeAccessDenied, "consent must come from the authenticated user")
+	}
+
+	p.storage.DeleteInteraction(interaction.ID)
+
+	req := &interaction.Request
+	if interaction.DeviceCode != "" {
+		if approved {
+			p.mu.Lock()
+			err = p.grantConsent(interaction.UserID, req.ClientID, req.Scope)
+			p.mu.Unlock()
+			if err != nil {
+				return nil, NewOAuthError(ErrCodeServerError, "failed to record consent: %v", err)
+			}
+		}
+		return p.completeDeviceAuthorization(interaction, approved)
+	}
+	if !approved {
+		denied := p.authorizationError(req, NewOAuthError(ErrCodeAccessDenied, "the user denied the request"))
+		return denied.Outcome(), nil
+	}
+
+	p.mu.Lock()
+	err = p.grantConsent(interaction.UserID, req.ClientID, req.Scope)
+	p.mu.Unlock()
+	if err != nil {
+		return nil, p.authorizationError(req, NewOAuthError(ErrCodeServerError, "failed to record consent: %v", err))
+	}
+
+	return p.completeAuthorization(interaction)
+}
+
+// advance completes an authenticated interaction when the user's consent is
+// already on record, and otherwise saves it and prompts for the next stage
+func (p *OIDCProvider) advance(interaction *Interaction, client *OIDCClient) (*AuthorizationOutcome, error) {
+	req := &interaction.Request
+	if interaction.Stage == InteractionStageConsent && !p.needsConsent(interaction) {
+		p.storage.DeleteInteraction(interaction.ID)
+		return p.completeAuthorization(interaction)
+	}
+
+	if hasPrompt(req.Prompt, PromptNone) {
+		if interaction.Stage == InteractionStageLogin {
+			return nil, p.authorizationError(req, NewOAuthError(ErrCodeLoginRequired, "the user is not logged in"))
+		}
+		return nil, p.authorizationError(req, NewOAuthError(ErrCodeConsentRequired, "the user has not consented to the requested scopes"))
+	}
+
+	if err := p.storage.SaveInteraction(interaction); err != nil {
+		return nil, p.authorizationError(req, NewOAuthError(ErrCodeServerError, "failed to store interaction: %v", err))
+	}
+	return p.promptOutcome(interaction, client), nil
+}
+
+// completeAuthorization issues the authorization response for a consented
+// interaction: a code, tokens, or both depending on the response type
+func (p *OIDCProvider) completeAuthorization(interaction *Interaction) (*AuthorizationOutcome, error) {
+	req := &interaction.Request
+	auth := &AuthResult{
+		UserID:   interaction.UserID,
+		AuthTime: interaction.AuthTime,
+		AMR:      interaction.AMR,
+	}
+
+	params := url.Values{}
+	var code string
+	if hasResponseType(req.ResponseType, "code") {
+		authCode, err := p.GenerateAuthorizationCode(req, auth)
+		if err != nil {
+			return nil, err
+		}
+		code = authCode.Code
+		params.Set("code", code)
+	}
+
+	if req.ResponseType != "code" {
+		p.mu.Lock()
+		err := p.issueFrontChannelTokens(req, auth, code, params)
+		p.mu.Unlock()
+		if err != nil {
+			return nil, p.authorizationError(req, err)
+		}
+	}
+
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	return respond(req.RedirectURI, responseMode(req), params), nil
+}
+
+// GetInteraction returns the pending prompt of an interaction for the UI
+func (p *OIDCProvider) GetInteraction(interactionID string) (*InteractionPrompt, error) {
+	interaction, client, err := p.loadInteraction(interactionID, "")
+	if err != nil {
+		return nil, err
+	}
+	return p.promptOutcome(interaction, client).Prompt, nil
+}
+
+// loadInteraction fetches a live interaction, optionally requiring a stage
+func (p *OIDCProvider) loadInteraction(id, stage string) (*Interaction, *OIDCClient, error) {
+	interaction, err := p.storage.GetInteraction(id)
+	if err != nil {
+		return nil, nil, NewOAuthError(ErrCodeInvalidRequest, "unknown or expired interaction")
+	}
+	if stage != "" && interaction.Stage != stage {
+		return nil, nil, NewOAuthError(ErrCodeInvalidRequest, "interaction is not awaiting %s", stage)
+	}
+	client, err := p.storage.GetClient(interaction.Request.ClientID)
+	if err != nil {
+		return nil, nil, NewOAuthError(ErrCodeInvalidRequest, "client no longer registered")
+	}
+	return interaction, client, nil
+}
+
+// authenticated advances the interaction to consent for the given user
+func (i *Interaction) authenticated(result *AuthResult) {
+	i.Stage = InteractionStageConsent
+	i.UserID = result.UserID
+	i.AuthTime = result.AuthTime
+	i.AMR = result.AMR
+	i.SessionID = result.SessionID
+}
+
+// promptOutcome describes the interaction's current stage to the user agent
+func (p *OIDCProvider) promptOutcome(interaction *Interaction, client *OIDCClient) *AuthorizationOutcome {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	prompt := &InteractionPrompt{
+		InteractionID: interaction.ID,
+		Stage:         interaction.Stage,
+		ClientID:      client.ClientID,
+		ClientName:    client.Name,
+		Scopes:        strings.Fields(interaction.Request.Scope),
+		ExpiresAt:     interaction.ExpiresAt.Unix(),
+	}
+	if interaction.Stage == InteractionStageLogin {
+		prompt.Challenge = interaction.Challenge
+		for _, a := range p.authenticators {
+			if a.Method() != AuthenticatorSession {
+				prompt.Methods = append(prompt.Methods, a.Method())
+			}
+		}
+	} else {
+		prompt.GrantedScopes = p.grantedScopes(interaction.UserID, client.ClientID, interaction.Request.Scope)
+	}
+
+	outcome := &AuthorizationOutcome{Prompt: prompt}
+	if p.interactionURL != "" {
+		outcome.PromptURL = appendQuery(p.interactionURL, url.Values{
+			"interaction_id": {interaction.ID},
+			"stage":          {interaction.Stage},
+		})
+	}
+	return outcome
+}
+
+// validateAuthorizationRequest checks the client, redirect URI, response type
+// and PKCE parameters. Errors found after the redirect URI is validated are
+// returned to the client. Callers must hold p.mu.
+func (p *OIDCProvider) validateAuthorizationRequest(req *AuthorizationRequest) (*OIDCClient, error) {
+	if req.ClientID == "" || req.RedirectURI == "" {
+		return nil, &AuthorizationError{OAuthError: NewOAuthError(ErrCodeInvalidRequest, "client_id and redirect_uri are required")}
+	}
+
+	// Validate client
+	client, err := p.storage.GetClient(req.ClientID)
+	if err != nil {
+		return nil, &AuthorizationError{OAuthError: NewOAuthError(ErrCodeInvalidRequest, "invalid client_id")}
+	}
+
+	// Validate redirect URI
+	if !slices.Contains(client.RedirectURIs, req.RedirectURI) {
+		return nil, &AuthorizationError{OAuthError: NewOAuthError(ErrCodeInvalidRequest, "invalid redirect_uri")}
+	}
+
+	// Validate response type
+	if req.ResponseType == "" {
+		return nil, p.authorizationError(req, NewOAuthError(ErrCodeInvalidRequest, "response_type is required"))
+	}
+	responseType, ok := normalizeResponseType(req.ResponseType)
+	if !ok {
+		return nil, p.authorizationError(req, NewOAuthError(ErrCodeUnsupportedResponseType, "unsupported response_type %q", req.ResponseType))
+	}
+	req.ResponseType = responseType
+	usesCode := hasResponseType(responseType, "code")
+	usesImplicit := responseType != "code"
+	if !client.allowsResponseType(responseType) ||
+		(usesCode && !slices.Contains(client.GrantTypes, "authorization_code")) ||
+		(usesImplicit && !slices.Contains(client.GrantTypes, "implicit")) {
+		return nil, p.authorizationError(req, NewOAuthError(ErrCodeUnauthorizedClient, "client is not allowed to use response_type %q", req.ResponseType))
+	}
+
+	// Validate response mode
+	if err := validateResponseMode(req); err != nil {
+		return nil, p.authorizationError(req, err)
+	}
+
+	// ID tokens need the openid scope, and front-channel ID tokens a nonce
+	// to bind them to the request (OIDC Core sections 3.2.2.1 and 3.3.2.11)
+	if hasResponseType(responseType, "id_token") && !slices.Contains(strings.Fields(req.Scope), "openid") {
+		return nil, p.authorizationError(req, NewOAuthError(ErrCodeInvalidRequest, "response_type %q requires the openid scope", responseType))
+	}
+	if usesImplicit && responseType != "token" && req.Nonce == "" {
+		return nil, p.authorizationError(req, NewOAuthError(ErrCodeInvalidRequest, "nonce is required for response_type %q", responseType))
+	}
+
+	// Validate prompt
+	if err := validatePrompt(req.Prompt); err != nil {
+		return nil, p.authorizationError(req, err)
+	}
+
+	// Validate PKCE for flows that issue a code
+	if usesCode {
+		method, err := p.checkCodeChallenge(client, req.CodeChallenge, req.CodeChallengeMethod)
+		if err != nil {
+			return nil, p.authorizationError(req, NewOAuthError(ErrCodeInvalidRequest, "%v", err))
+		}
+		req.CodeChallengeMethod = method
+	}
+
+	return client, nil
+}
+
+// authorizationError wraps err for delivery to the request's redirect URI
+func (p *OIDCProvider) authorizationError(req *AuthorizationRequest, err *OAuthError) *AuthorizationError {
+	return &AuthorizationError{OAuthError: err, RedirectURI: req.RedirectURI, ResponseMode: responseMode(req), State: req.State}
+}
+
+// generateChallenge returns a random challenge for challenge-response
+// authenticators. It is hex so that it is also a valid EIP-4361 nonce, which
+// must be alphanumeric.
+func generateChallenge() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate challenge: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// appendQuery adds params to a URI's query string
+func appendQuery(uri string, params url.Values) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	q := u.Query()
+	for k, vs := range params {
+		for _, v := range vs {
+			q.Add(k, v)
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
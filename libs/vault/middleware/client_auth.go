@@ -0,0 +1,367 @@
+//go:build js && wasm
+// +build js,wasm
+
+package middleware
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// Token endpoint client authentication methods
+const (
+	AuthMethodClientSecretBasic = "client_secret_basic"
+	AuthMethodClientSecretPost  = "client_secret_post"
+	AuthMethodPrivateKeyJWT     = "private_key_jwt"
+	AuthMethodNone              = "none"
+)
+
+// ClientAssertionTypeJWTBearer is the client_assertion_type for private_key_jwt
+const ClientAssertionTypeJWTBearer = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// Client secret hashing parameters
+const (
+	secretHashScheme     = "pbkdf2-sha256"
+	secretHashIterations = 10000
+	secretSaltLength     = 16
+	secretKeyLength      = 32
+)
+
+// maxAssertionLifetime bounds how far in the future a client assertion's
+// exp may be
+const maxAssertionLifetime = 10 * time.Minute
+
+// HashClientSecret derives a salted hash of a client secret for storage,
+// encoded as scheme$iterations$salt$hash
+func HashClientSecret(secret string) (string, error) {
+	salt := make([]byte, secretSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	key, err := pbkdf2.Key(sha256.New, secret, salt, secretHashIterations, secretKeyLength)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash secret: %w", err)
+	}
+
+	return strings.Join([]string{
+		secretHashScheme,
+		strconv.Itoa(secretHashIterations),
+		base64.RawURLEncoding.EncodeToString(salt),
+		base64.RawURLEncoding.EncodeToString(key),
+	}, "$"), nil
+}
+
+// VerifyClientSecret checks a secret against a hash from HashClientSecret
+func VerifyClientSecret(hash, secret string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != secretHashScheme {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false
+	}
+	salt, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	expected, err := base64.RawURLEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+
+	key, err := pbkdf2.Key(sha256.New, secret, salt, iterations, len(expected))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(key, expected) == 1
+}
+
+// IsPublic reports whether the client authenticates with PKCE alone
+func (c *OIDCClient) IsPublic() bool {
+	return c.TokenEndpointAuthMethod == AuthMethodNone
+}
+
+// authMethod returns the client's registered authentication method
+func (c *OIDCClient) authMethod() string {
+	if c.TokenEndpointAuthMethod == "" {
+		return AuthMethodClientSecretBasic
+	}
+	return c.TokenEndpointAuthMethod
+}
+
+// authenticateClient authenticates the client making a token request with
+// the method it registered. Callers must hold p.mu.
+func (p *OIDCProvider) authenticateClient(req *TokenRequest) (*OIDCClient, error) {
+	presented := req.AuthMethod
+	if req.ClientAssertionType != "" || req.ClientAssertion != "" {
+		if presented != "" {
+			return nil, NewOAuthError(ErrCodeInvalidRequest, "multiple client authentication methods used")
+		}
+		if req.ClientAssertionType != ClientAssertionTypeJWTBearer {
+			return nil, NewOAuthError(ErrCodeInvalidClient, "unsupported client_assertion_type")
+		}
+		presented = AuthMethodPrivateKeyJWT
+	} else if presented == "" && req.ClientSecret != "" {
+		presented = AuthMethodClientSecretPost
+	}
+
+	clientID := req.ClientID
+	var assertion *JWTClaims
+	if presented == AuthMethodPrivateKeyJWT {
+		claims, err := decodeJWTClaims(req.ClientAssertion)
+		if err != nil {
+			return nil, NewOAuthError(ErrCodeInvalidClient, "malformed client_assertion")
+		}
+		if clientID == "" {
+			clientID = claims.Issuer
+		}
+		assertion = claims
+	}
+	if clientID == "" {
+		return nil, NewOAuthError(ErrCodeInvalidClient, "client authentication required")
+	}
+
+	client, err := p.storage.GetClient(clientID)
+	if err != nil {
+		return nil, NewOAuthError(ErrCodeInvalidClient, "invalid client_id")
+	}
+
+	expected := client.authMethod()
+	if presented == "" {
+		presented = AuthMethodNone
+	}
+	if presented != expected {
+		return nil, NewOAuthError(ErrCodeInvalidClient, "client must authenticate with %s", expected)
+	}
+
+	switch expected {
+	case AuthMethodClientSecretBasic, AuthMethodClientSecretPost:
+		if client.ClientSecretHash == "" || !VerifyClientSecret(client.ClientSecretHash, req.ClientSecret) {
+			return nil, NewOAuthError(ErrCodeInvalidClient, "invalid client credentials")
+		}
+	case AuthMethodPrivateKeyJWT:
+		if err := p.verifyClientAssertion(client, req.ClientAssertion, assertion); err != nil {
+			return nil, err
+		}
+	case AuthMethodNone:
+	default:
+		return nil, NewOAuthError(ErrCodeInvalidClient, "unsupported client authentication method %q", expected)
+	}
+
+	return client, nil
+}
+
+// verifyClientAssertion validates a private_key_jwt assertion (RFC 7523)
+// against the client's registered keys and rejects replays
+func (p *OIDCProvider) verifyClientAssertion(client *OIDCClient, assertion string, claims *JWTClaims) error {
+	parts := strings.Split(assertion, ".")
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return NewOAuthError(ErrCodeInvalidClient, "malformed client_assertion")
+	}
+	var header JWTHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return NewOAuthError(ErrCodeInvalidClient, "malformed client_assertion")
+	}
+
+	key, err := client.assertionKey(header.Kid)
+	if err != nil {
+		return NewOAuthError(ErrCodeInvalidClient, "%v", err)
+	}
+	if err := verifyJWTSignature(header.Alg, key, parts); err != nil {
+		return NewOAuthError(ErrCodeInvalidClient, "invalid client_assertion signature")
+	}
+
+	now := time.Now()
+	if claims.Issuer != client.ClientID || claims.Subject != client.ClientID {
+		return NewOAuthError(ErrCodeInvalidClient, "client_assertion iss and sub must be the client_id")
+	}
+	if !audienceContains(claims.Audience, p.issuer, p.issuer+"/token", p.issuer+"/introspect", p.issuer+"/revoke") {
+		return NewOAuthError(ErrCodeInvalidClient, "client_assertion audience must be the issuer or the endpoint")
+	}
+	if claims.Expiration == 0 || now.Unix() >= claims.Expiration {
+		return NewOAuthError(ErrCodeInvalidClient, "client_assertion expired")
+	}
+	if claims.Expiration > now.Add(maxAssertionLifetime).Unix() {
+		return NewOAuthError(ErrCodeInvalidClient, "client_assertion lifetime too long")
+	}
+	if claims.NotBefore > 0 && now.Unix() < claims.NotBefore {
+		return NewOAuthError(ErrCodeInvalidClient, "client_assertion not yet valid")
+	}
+	if claims.JWTID == "" {
+		return NewOAuthError(ErrCodeInvalidClient, "client_assertion jti is required")
+	}
+
+	fresh, err := p.storage.UseAssertionID(client.ClientID+":"+claims.JWTID, time.Unix(claims.Expiration, 0))
+	if err != nil {
+		return NewOAuthError(ErrCodeServerError, "failed to record client_assertion: %v", err)
+	}
+	if !fresh {
+		return NewOAuthError(ErrCodeInvalidClient, "client_assertion has already been used")
+	}
+	return nil
+}
+
+// assertionKey selects a registered client key by kid, or the only key when
+// the assertion carries no kid
+func (c *OIDCClient) assertionKey(kid string) (crypto.PublicKey, error) {
+	if len(c.JWKS) == 0 {
+		return nil, fmt.Errorf("client has no registered keys")
+	}
+	for _, jwk := range c.JWKS {
+		if k, _ := jwk["kid"].(string); k == kid || (kid == "" && len(c.JWKS) == 1) {
+			return publicKeyFromJWK(jwk)
+		}
+	}
+	return nil, fmt.Errorf("no registered key matches kid %q", kid)
+}
+
+// publicKeyFromJWK parses an RSA, EC (P-256 or secp256k1) or OKP (Ed25519)
+// public JWK
+func publicKeyFromJWK(jwk map[string]interface{}) (crypto.PublicKey, error) {
+	field := func(name string) ([]byte, error) {
+		s, _ := jwk[name].(string)
+		if s == "" {
+			return nil, fmt.Errorf("jwk is missing %q", name)
+		}
+		return base64.RawURLEncoding.DecodeString(s)
+	}
+
+	switch kty, _ := jwk["kty"].(string); kty {
+	case "RSA":
+		n, err := field("n")
+		if err != nil {
+			return nil, err
+		}
+		e, err := field("e")
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		x, err := field("x")
+		if err != nil {
+			return nil, err
+		}
+		y, err := field("y")
+		if err != nil {
+			return nil, err
+		}
+		switch crv, _ := jwk["crv"].(string); crv {
+		case "P-256":
+			pub := &ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(x),
+				Y:     new(big.Int).SetBytes(y),
+			}
+			if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+				return nil, fmt.Errorf("invalid P-256 point")
+			}
+			return pub, nil
+		case "secp256k1":
+			if len(x) != 32 || len(y) != 32 {
+				return nil, fmt.Errorf("invalid secp256k1 point")
+			}
+			pub, err := secp256k1.ParsePubKey(append(append([]byte{0x04}, x...), y...))
+			if err != nil {
+				return nil, fmt.Errorf("invalid secp256k1 point")
+			}
+			return pub, nil
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", crv)
+		}
+	case "OKP":
+		if crv, _ := jwk["crv"].(string); crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", crv)
+		}
+		x, err := field("x")
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", kty)
+	}
+}
+
+// verifyJWTSignature checks the signature over a split JWT with one of the
+// supported algorithms
+func verifyJWTSignature(alg string, key crypto.PublicKey, parts []string) error {
+	if len(parts) != 3 {
+		return fmt.Errorf("invalid token format")
+	}
+	algorithm, ok := signingAlgorithms[alg]
+	if !ok {
+		return fmt.Errorf("unsupported algorithm: %s", alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return fmt.Errorf("failed to decode signature: %w", err)
+	}
+	return algorithm.verify(key, []byte(parts[0]+"."+parts[1]), signature)
+}
+
+// decodeJWTClaims reads a JWT payload without verifying its signature
+func decodeJWTClaims(token string) (*JWTClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid token format")
+	}
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode claims: %w", err)
+	}
+	var claims JWTClaims
+	if err := json.Unmarshal(claimsJSON, &claims); err != nil {
+		return nil, fmt.Errorf("failed to parse claims: %w", err)
+	}
+	return &claims, nil
+}
+
+// audienceContains reports whether a string or array aud claim includes any
+// of the accepted values
+func audienceContains(aud interface{}, accepted ...string) bool {
+	var values []string
+	switch v := aud.(type) {
+	case string:
+		values = []string{v}
+	case []interface{}:
+		for _, a := range v {
+			if s, ok := a.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	for _, v := range values {
+		for _, a := range accepted {
+			if v == a {
+				return true
+			}
+		}
+	}
+	return false
+}
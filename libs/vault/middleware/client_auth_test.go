@@ -0,0 +1,190 @@
+//go:build js && wasm
+// +build js,wasm
+
+package middleware
+
+import (
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const testIssuer = "https://motor.sonr.io"
+
+// newTestProvider returns a provider backed by in-memory storage
+func newTestProvider(t *testing.T) *OIDCProvider {
+	t.Helper()
+	return &OIDCProvider{issuer: testIssuer, storage: NewKVStorage(NewMemoryKV(time.Minute))}
+}
+
+// saveTestClient stores client, hashing secret into it when given
+func saveTestClient(t *testing.T, p *OIDCProvider, client *OIDCClient, secret string) {
+	t.Helper()
+	if secret != "" {
+		hash, err := HashClientSecret(secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.ClientSecretHash = hash
+	}
+	if err := p.storage.SaveClient(client); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// signAssertion returns a private_key_jwt client assertion signed with key
+func signAssertion(t *testing.T, alg string, key crypto.PrivateKey, kid string, claims JWTClaims) string {
+	t.Helper()
+	header, _ := json.Marshal(JWTHeader{Alg: alg, Typ: "JWT", Kid: kid})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	signature, err := signingAlgorithms[alg].sign(key, []byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// wantOAuthError fails unless err is an OAuthError with code, or nil when
+// code is empty
+func wantOAuthError(t *testing.T, err error, code string) {
+	t.Helper()
+	if code == "" {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return
+	}
+	var oauthErr *OAuthError
+	if !errors.As(err, &oauthErr) {
+		t.Fatalf("error = %v, want %s", err, code)
+	}
+	if oauthErr.Code != code {
+		t.Fatalf("error = %s (%s), want %s", oauthErr.Code, oauthErr.Description, code)
+	}
+}
+
+func TestVerifyClientSecret(t *testing.T) {
+	hash, err := HashClientSecret("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		hash   string
+		secret string
+		want   bool
+	}{
+		{"correct secret", hash, "s3cret", true},
+		{"wrong secret", hash, "s3cret!", false},
+		{"empty secret", hash, "", false},
+		{"unknown scheme", "bcrypt$10$c2FsdA$aGFzaA", "s3cret", false},
+		{"bad iteration count", "pbkdf2-sha256$0$c2FsdA$aGFzaA", "s3cret", false},
+		{"truncated", "pbkdf2-sha256$10000", "s3cret", false},
+		{"plaintext secret", "s3cret", "s3cret", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyClientSecret(tt.hash, tt.secret); got != tt.want {
+				t.Errorf("VerifyClientSecret() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticateClient(t *testing.T) {
+	p := newTestProvider(t)
+	saveTestClient(t, p, &OIDCClient{ClientID: "basic"}, "basic-secret")
+	saveTestClient(t, p, &OIDCClient{ClientID: "post", TokenEndpointAuthMethod: AuthMethodClientSecretPost}, "post-secret")
+	saveTestClient(t, p, &OIDCClient{ClientID: "public", TokenEndpointAuthMethod: AuthMethodNone}, "")
+
+	key, err := signingAlgorithms[AlgES256].generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := signingAlgorithms[AlgES256].generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk := map[string]interface{}{"kid": "k1"}
+	for name, v := range publicJWKMembers(publicKeyOf(key)) {
+		jwk[name] = v
+	}
+	saveTestClient(t, p, &OIDCClient{ClientID: "jwt", TokenEndpointAuthMethod: AuthMethodPrivateKeyJWT, JWKS: []map[string]interface{}{jwk}}, "")
+
+	now := time.Now()
+	jti := 0
+	assertion := func(modify func(*JWTClaims)) string {
+		jti++
+		claims := JWTClaims{
+			Issuer:     "jwt",
+			Subject:    "jwt",
+			Audience:   testIssuer + "/token",
+			Expiration: now.Add(time.Minute).Unix(),
+			JWTID:      "jti-" + strconv.Itoa(jti),
+		}
+		if modify != nil {
+			modify(&claims)
+		}
+		return signAssertion(t, AlgES256, key, "k1", claims)
+	}
+	jwtRequest := func(assertion string) *TokenRequest {
+		return &TokenRequest{ClientAssertionType: ClientAssertionTypeJWTBearer, ClientAssertion: assertion}
+	}
+
+	tests := []struct {
+		name     string
+		req      *TokenRequest
+		wantID   string
+		wantCode string
+	}{
+		{"client_secret_basic", &TokenRequest{ClientID: "basic", ClientSecret: "basic-secret", AuthMethod: AuthMethodClientSecretBasic}, "basic", ""},
+		{"client_secret_basic wrong secret", &TokenRequest{ClientID: "basic", ClientSecret: "nope", AuthMethod: AuthMethodClientSecretBasic}, "", ErrCodeInvalidClient},
+		{"client_secret_basic client using post", &TokenRequest{ClientID: "basic", ClientSecret: "basic-secret"}, "", ErrCodeInvalidClient},
+		{"client_secret_post", &TokenRequest{ClientID: "post", ClientSecret: "post-secret"}, "post", ""},
+		{"client_secret_post client using basic", &TokenRequest{ClientID: "post", ClientSecret: "post-secret", AuthMethod: AuthMethodClientSecretBasic}, "", ErrCodeInvalidClient},
+		{"public client", &TokenRequest{ClientID: "public"}, "public", ""},
+		{"public client with a secret", &TokenRequest{ClientID: "public", ClientSecret: "x"}, "", ErrCodeInvalidClient},
+		{"confidential client without credentials", &TokenRequest{ClientID: "basic"}, "", ErrCodeInvalidClient},
+		{"unknown client", &TokenRequest{ClientID: "nobody"}, "", ErrCodeInvalidClient},
+		{"no client_id", &TokenRequest{}, "", ErrCodeInvalidClient},
+		{"private_key_jwt", jwtRequest(assertion(nil)), "jwt", ""},
+		{"private_key_jwt with matching client_id", &TokenRequest{ClientID: "jwt", ClientAssertionType: ClientAssertionTypeJWTBearer, ClientAssertion: assertion(nil)}, "jwt", ""},
+		{"private_key_jwt issuer audience", jwtRequest(assertion(func(c *JWTClaims) { c.Audience = []interface{}{"other", testIssuer} })), "jwt", ""},
+		{"private_key_jwt wrong audience", jwtRequest(assertion(func(c *JWTClaims) { c.Audience = "https://example.com" })), "", ErrCodeInvalidClient},
+		{"private_key_jwt sub is not the client", jwtRequest(assertion(func(c *JWTClaims) { c.Subject = "basic" })), "", ErrCodeInvalidClient},
+		{"private_key_jwt expired", jwtRequest(assertion(func(c *JWTClaims) { c.Expiration = now.Add(-time.Second).Unix() })), "", ErrCodeInvalidClient},
+		{"private_key_jwt without exp", jwtRequest(assertion(func(c *JWTClaims) { c.Expiration = 0 })), "", ErrCodeInvalidClient},
+		{"private_key_jwt lifetime too long", jwtRequest(assertion(func(c *JWTClaims) { c.Expiration = now.Add(time.Hour).Unix() })), "", ErrCodeInvalidClient},
+		{"private_key_jwt not yet valid", jwtRequest(assertion(func(c *JWTClaims) { c.NotBefore = now.Add(time.Minute).Unix() })), "", ErrCodeInvalidClient},
+		{"private_key_jwt without jti", jwtRequest(assertion(func(c *JWTClaims) { c.JWTID = "" })), "", ErrCodeInvalidClient},
+		{"private_key_jwt signed by another key", jwtRequest(signAssertion(t, AlgES256, otherKey, "k1", JWTClaims{Issuer: "jwt", Subject: "jwt", Audience: testIssuer, Expiration: now.Add(time.Minute).Unix(), JWTID: "other"})), "", ErrCodeInvalidClient},
+		{"private_key_jwt unknown kid", jwtRequest(signAssertion(t, AlgES256, key, "k2", JWTClaims{Issuer: "jwt", Subject: "jwt", Audience: testIssuer, Expiration: now.Add(time.Minute).Unix(), JWTID: "kid"})), "", ErrCodeInvalidClient},
+		{"private_key_jwt malformed", jwtRequest("not-a-jwt"), "", ErrCodeInvalidClient},
+		{"unsupported assertion type", &TokenRequest{ClientAssertionType: "urn:example", ClientAssertion: assertion(nil)}, "", ErrCodeInvalidClient},
+		{"assertion with client_secret_basic", &TokenRequest{ClientID: "jwt", ClientSecret: "x", AuthMethod: AuthMethodClientSecretBasic, ClientAssertionType: ClientAssertionTypeJWTBearer, ClientAssertion: assertion(nil)}, "", ErrCodeInvalidRequest},
+		{"secret for private_key_jwt client", &TokenRequest{ClientID: "jwt", ClientSecret: "x"}, "", ErrCodeInvalidClient},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := p.authenticateClient(tt.req)
+			wantOAuthError(t, err, tt.wantCode)
+			if err == nil && client.ClientID != tt.wantID {
+				t.Errorf("authenticated %s, want %s", client.ClientID, tt.wantID)
+			}
+		})
+	}
+
+	t.Run("private_key_jwt replay", func(t *testing.T) {
+		replayed := assertion(nil)
+		if _, err := p.authenticateClient(jwtRequest(replayed)); err != nil {
+			t.Fatalf("first use: %v", err)
+		}
+		_, err := p.authenticateClient(jwtRequest(replayed))
+		wantOAuthError(t, err, ErrCodeInvalidClient)
+	})
+}
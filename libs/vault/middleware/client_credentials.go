@@ -0,0 +1,108 @@
+//go:build js && wasm
+// +build js,wasm
+
+package middleware
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrCodeInvalidTarget is the resource indicator error from RFC 8707
+const ErrCodeInvalidTarget = "invalid_target"
+
+// userOnlyScopes only make sense for tokens acting on behalf of a user
+var userOnlyScopes = []string{"openid", "offline_access"}
+
+// ClientCredentialsGrant issues an access token to a confidential client
+// acting on its own behalf (RFC 6749 section 4.4). The token's subject is the
+// client, its scope is limited to the client's registered scopes, and its
+// audience is restricted to any requested resource indicators (RFC 8707). No
+// refresh token is issued.
+func (p *OIDCProvider) ClientCredentialsGrant(req *TokenRequest) (*TokenResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Authenticate client
+	client, err := p.authenticateClient(req)
+	if err != nil {
+		return nil, err
+	}
+	if client.IsPublic() {
+		return nil, NewOAuthError(ErrCodeUnauthorizedClient, "public clients may not use client_credentials")
+	}
+	if !slices.Contains(client.GrantTypes, "client_credentials") {
+		return nil, NewOAuthError(ErrCodeUnauthorizedClient, "client is not allowed to use client_credentials")
+	}
+
+	scope, err := clientCredentialsScope(client, req.Scope)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateResources(client, req.Resource); err != nil {
+		return nil, err
+	}
+
+	accessToken, err := jwtManager.GenerateAccessToken(client.ClientID, scope, req.Resource...)
+	if err != nil {
+		return nil, NewOAuthError(ErrCodeServerError, "failed to generate access token: %v", err)
+	}
+	if err := p.storage.SaveAccessToken(&AccessToken{
+		Token:     accessToken,
+		ClientID:  client.ClientID,
+		Scope:     scope,
+		Audience:  req.Resource,
+		ExpiresAt: time.Now().Add(accessTokenTTL),
+	}); err != nil {
+		return nil, NewOAuthError(ErrCodeServerError, "failed to store access token: %v", err)
+	}
+
+	return &TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(accessTokenTTL.Seconds()),
+		Scope:       scope,
+	}, nil
+}
+
+// clientCredentialsScope checks requested scopes against the client's
+// registered scopes. Without a request, every registered scope that does not
+// require a user is granted.
+func clientCredentialsScope(client *OIDCClient, requested string) (string, error) {
+	if requested == "" {
+		var scopes []string
+		for _, s := range client.Scopes {
+			if !slices.Contains(userOnlyScopes, s) {
+				scopes = append(scopes, s)
+			}
+		}
+		return strings.Join(scopes, " "), nil
+	}
+
+	for _, s := range strings.Fields(requested) {
+		if slices.Contains(userOnlyScopes, s) {
+			return "", NewOAuthError(ErrCodeInvalidScope, "scope %q requires an end user", s)
+		}
+		if !slices.Contains(client.Scopes, s) {
+			return "", NewOAuthError(ErrCodeInvalidScope, "client is not allowed to request scope %q", s)
+		}
+	}
+	return strings.Join(strings.Fields(requested), " "), nil
+}
+
+// validateResources checks resource indicators: each must be an absolute URI
+// without a fragment and, when the client registered resources, one of them
+func validateResources(client *OIDCClient, resources []string) error {
+	for _, resource := range resources {
+		u, err := url.Parse(resource)
+		if err != nil || !u.IsAbs() || u.Fragment != "" {
+			return NewOAuthError(ErrCodeInvalidTarget, "resource %q must be an absolute URI without a fragment", resource)
+		}
+		if len(client.Resources) > 0 && !slices.Contains(client.Resources, resource) {
+			return NewOAuthError(ErrCodeInvalidTarget, "client is not allowed to request resource %q", resource)
+		}
+	}
+	return nil
+}
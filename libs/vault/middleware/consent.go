@@ -0,0 +1,218 @@
+//go:build js && wasm
+// +build js,wasm
+
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Authorization request prompt values (OIDC Core section 3.1.2.1)
+const (
+	PromptNone          = "none"
+	PromptLogin         = "login"
+	PromptConsent       = "consent"
+	PromptSelectAccount = "select_account"
+)
+
+// Authentication error codes (OIDC Core section 3.1.2.6)
+const (
+	ErrCodeLoginRequired   = "login_required"
+	ErrCodeConsentRequired = "consent_required"
+)
+
+// Consent records the scopes a user granted to a client. Later requests for
+// scopes already granted skip the consent prompt; new scopes are added to the
+// record when the user approves them.
+type Consent struct {
+	UserID    string
+	ClientID  string
+	Scopes    []string
+	GrantedAt time.Time
+	UpdatedAt time.Time
+	// FamilyIDs are the refresh token families issued under this consent;
+	// revoking the consent revokes them
+	FamilyIDs []string
+}
+
+// ConsentGrant describes a consent to the user who gave it
+type ConsentGrant struct {
+	ClientID   string    `json:"client_id"`
+	ClientName string    `json:"client_name,omitempty"`
+	Scopes     []string  `json:"scopes"`
+	GrantedAt  time.Time `json:"granted_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// AuthenticateSession returns the end user holding the request's login
+// session cookie
+func (p *OIDCProvider) AuthenticateSession(r *http.Request) (*AuthResult, error) {
+	result, err := SessionAuthenticator{}.Authenticate(r, nil, p.storage)
+	if err != nil {
+		return nil, NewOAuthError(ErrCodeLoginRequired, "no active login session")
+	}
+	return result, nil
+}
+
+// ListConsents returns the grants a user has given to clients
+func (p *OIDCProvider) ListConsents(userID string) ([]*ConsentGrant, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	consents, err := p.storage.ListConsents(userID)
+	if err != nil {
+		return nil, NewOAuthError(ErrCodeServerError, "failed to list consents: %v", err)
+	}
+
+	grants := make([]*ConsentGrant, 0, len(consents))
+	for _, c := range consents {
+		grant := &ConsentGrant{
+			ClientID:  c.ClientID,
+			Scopes:    c.Scopes,
+			GrantedAt: c.GrantedAt,
+			UpdatedAt: c.UpdatedAt,
+		}
+		if client, err := p.storage.GetClient(c.ClientID); err == nil {
+			grant.ClientName = client.Name
+		}
+		grants = append(grants, grant)
+	}
+	return grants, nil
+}
+
+// RevokeConsent withdraws a user's grant to a client and revokes every
+// refresh token family issued under it
+func (p *OIDCProvider) RevokeConsent(userID, clientID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	consent, err := p.storage.GetConsent(userID, clientID)
+	if errors.Is(err, ErrNotFound) {
+		return NewOAuthError(ErrCodeInvalidRequest, "no consent recorded for client %q", clientID)
+	}
+	if err != nil {
+		return NewOAuthError(ErrCodeServerError, "failed to load consent: %v", err)
+	}
+
+	for _, id := range consent.FamilyIDs {
+		family, err := p.storage.GetRefreshFamily(id)
+		if err != nil || family.Revoked {
+			continue
+		}
+		if err := p.revokeFamily(family); err != nil {
+			return NewOAuthError(ErrCodeServerError, "failed to revoke refresh token family: %v", err)
+		}
+	}
+
+	if err := p.storage.DeleteConsent(userID, clientID); err != nil {
+		return NewOAuthError(ErrCodeServerError, "failed to delete consent: %v", err)
+	}
+	return nil
+}
+
+// grantConsent merges the requested scopes into the user's consent for the
+// client. Callers must hold p.mu.
+func (p *OIDCProvider) grantConsent(userID, clientID, scope string) error {
+	now := time.Now()
+	consent, err := p.storage.GetConsent(userID, clientID)
+	if errors.Is(err, ErrNotFound) {
+		consent = &Consent{UserID: userID, ClientID: clientID, GrantedAt: now}
+	} else if err != nil {
+		return err
+	}
+
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(consent.Scopes, s) {
+			consent.Scopes = append(consent.Scopes, s)
+		}
+	}
+	consent.UpdatedAt = now
+	return p.storage.SaveConsent(consent)
+}
+
+// grantedScopes returns the requested scopes the user has already granted
+// to the client
+func (p *OIDCProvider) grantedScopes(userID, clientID, scope string) []string {
+	consent, err := p.storage.GetConsent(userID, clientID)
+	if err != nil {
+		return nil
+	}
+
+	var granted []string
+	for _, s := range strings.Fields(scope) {
+		if slices.Contains(consent.Scopes, s) {
+			granted = append(granted, s)
+		}
+	}
+	return granted
+}
+
+// needsConsent reports whether an authenticated interaction must prompt the
+// user: the client asked for prompt=consent, the interaction approves a
+// device, or the user has not yet granted every requested scope
+func (p *OIDCProvider) needsConsent(interaction *Interaction) bool {
+	req := &interaction.Request
+	if hasPrompt(req.Prompt, PromptConsent) || interaction.DeviceCode != "" {
+		return true
+	}
+
+	consent, err := p.storage.GetConsent(interaction.UserID, req.ClientID)
+	if err != nil {
+		return true
+	}
+	for _, s := range strings.Fields(req.Scope) {
+		if !slices.Contains(consent.Scopes, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordConsentFamily links a new refresh token family to the consent it
+// was issued under. Grants without a recorded consent are left alone.
+// Callers must hold p.mu.
+func (p *OIDCProvider) recordConsentFamily(userID, clientID, familyID string) error {
+	consent, err := p.storage.GetConsent(userID, clientID)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Drop families that have since expired
+	live := consent.FamilyIDs[:0]
+	for _, id := range consent.FamilyIDs {
+		if _, err := p.storage.GetRefreshFamily(id); err == nil {
+			live = append(live, id)
+		}
+	}
+	consent.FamilyIDs = append(live, familyID)
+	return p.storage.SaveConsent(consent)
+}
+
+// validatePrompt checks the prompt parameter. none may not be combined with
+// other values.
+func validatePrompt(prompt string) *OAuthError {
+	values := strings.Fields(prompt)
+	for _, v := range values {
+		switch v {
+		case PromptNone, PromptLogin, PromptConsent, PromptSelectAccount:
+		default:
+			return NewOAuthError(ErrCodeInvalidRequest, "unsupported prompt value %q", v)
+		}
+	}
+	if slices.Contains(values, PromptNone) && len(values) > 1 {
+		return NewOAuthError(ErrCodeInvalidRequest, "prompt=none cannot be combined with other values")
+	}
+	return nil
+}
+
+// hasPrompt reports whether prompt contains value
+func hasPrompt(prompt, value string) bool {
+	return slices.Contains(strings.Fields(prompt), value)
+}
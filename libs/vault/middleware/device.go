@@ -0,0 +1,330 @@
+//go:build js && wasm
+// +build js,wasm
+
+package middleware
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// GrantTypeDeviceCode is the device authorization grant (RFC 8628)
+const GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+// Device access token error codes (RFC 8628 section 3.5)
+const (
+	ErrCodeAuthorizationPending = "authorization_pending"
+	ErrCodeSlowDown             = "slow_down"
+	ErrCodeExpiredToken         = "expired_token"
+)
+
+// Device authorization states
+const (
+	DeviceStatusPending  = "pending"
+	DeviceStatusApproved = "approved"
+	DeviceStatusDenied   = "denied"
+)
+
+const (
+	// deviceCodeTTL bounds how long the user has to enter the user code
+	deviceCodeTTL = 10 * time.Minute
+	// deviceCodeGrace keeps expired device codes long enough to answer
+	// polls with expired_token instead of invalid_grant
+	deviceCodeGrace = 10 * time.Minute
+	// devicePollInterval is the minimum polling interval, in seconds
+	devicePollInterval = 5
+	// deviceSlowDownStep is added to the interval on every slow_down
+	deviceSlowDownStep = 5
+	// userCodeAttempts is how many unknown user codes a source may enter
+	// per userCodeAttemptWindow (RFC 8628 section 5.1)
+	userCodeAttempts      = 5
+	userCodeAttemptWindow = 15 * time.Minute
+)
+
+// userCodeFailures counts unknown user codes entered by each source, so the
+// user code space cannot be searched through the verification URI
+var userCodeFailures = NewRateLimiter(userCodeAttempts, userCodeAttemptWindow)
+
+// userCodeAlphabet avoids vowels, so codes never spell words, and
+// characters that are easily confused
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+// DeviceAuthorization tracks a device authorization request from issue
+// until the device redeems it
+type DeviceAuthorization struct {
+	DeviceCode string
+	UserCode   string
+	ClientID   string
+	Scope      string
+	Status     string
+	UserID     string
+	AuthTime   time.Time
+	AMR        []string
+	// Interval is the current minimum polling interval in seconds
+	Interval     int
+	LastPolledAt time.Time
+	ExpiresAt    time.Time
+}
+
+// DeviceAuthorizationResponse is returned to the device (RFC 8628
+// section 3.2)
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// DeviceVerification reports the outcome of a device verification to the
+// user
+type DeviceVerification struct {
+	UserCode   string `json:"user_code"`
+	ClientID   string `json:"client_id"`
+	ClientName string `json:"client_name,omitempty"`
+	Approved   bool   `json:"approved"`
+}
+
+// AuthorizeDevice starts a device authorization for a client that cannot
+// receive redirects. The user completes it by entering the user code at the
+// verification URI while the device polls the token endpoint.
+func (p *OIDCProvider) AuthorizeDevice(req *TokenRequest) (*DeviceAuthorizationResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Authenticate client
+	client, err := p.authenticateClient(req)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(client.GrantTypes, GrantTypeDeviceCode) {
+		return nil, NewOAuthError(ErrCodeUnauthorizedClient, "client is not allowed to use the device authorization grant")
+	}
+	for _, s := range strings.Fields(req.Scope) {
+		if !slices.Contains(client.Scopes, s) {
+			return nil, NewOAuthError(ErrCodeInvalidScope, "client is not allowed to request scope %q", s)
+		}
+	}
+
+	userCode, err := generateUserCode()
+	if err != nil {
+		return nil, NewOAuthError(ErrCodeServerError, "%v", err)
+	}
+	auth := &DeviceAuthorization{
+		DeviceCode: generateRandomString(43),
+		UserCode:   userCode,
+		ClientID:   client.ClientID,
+		Scope:      strings.Join(strings.Fields(req.Scope), " "),
+		Status:     DeviceStatusPending,
+		Interval:   devicePollInterval,
+		ExpiresAt:  time.Now().Add(deviceCodeTTL),
+	}
+	if err := p.storage.SaveDeviceAuthorization(auth); err != nil {
+		return nil, NewOAuthError(ErrCodeServerError, "failed to store device authorization: %v", err)
+	}
+
+	verificationURI := p.issuer + "/device"
+	return &DeviceAuthorizationResponse{
+		DeviceCode:              auth.DeviceCode,
+		UserCode:                auth.UserCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + auth.UserCode,
+		ExpiresIn:               int(deviceCodeTTL.Seconds()),
+		Interval:                auth.Interval,
+	}, nil
+}
+
+// VerifyUserCode starts the login and consent interaction for the device
+// authorization identified by a user code. The user always confirms device
+// authorizations explicitly, even for scopes granted before, since the
+// device that displayed the code may not be the user's. Sources that enter
+// too many unknown codes are refused until the attempt window passes.
+func (p *OIDCProvider) VerifyUserCode(r *http.Request, userCode string) (*AuthorizationOutcome, error) {
+	source := getClientIdentifier(r)
+	if userCodeFailures.Exceeded(source) {
+		err := NewOAuthError(ErrCodeInvalidRequest, "too many invalid user codes; try again later")
+		err.Status = http.StatusTooManyRequests
+		return nil, err
+	}
+
+	auth, err := p.storage.GetDeviceAuthorizationByUserCode(normalizeUserCode(userCode))
+	if err != nil || auth.Status != DeviceStatusPending || time.Now().After(auth.ExpiresAt) {
+		userCodeFailures.Allow(source)
+		return nil, NewOAuthError(ErrCodeInvalidRequest, "unknown or expired user code")
+	}
+	client, err := p.storage.GetClient(auth.ClientID)
+	if err != nil {
+		return nil, NewOAuthError(ErrCodeInvalidRequest, "client no longer registered")
+	}
+
+	challenge, err := generateChallenge()
+	if err != nil {
+		return nil, NewOAuthError(ErrCodeServerError, "%v", err)
+	}
+	expiresAt := time.Now().Add(interactionTTL)
+	if auth.ExpiresAt.Before(expiresAt) {
+		expiresAt = auth.ExpiresAt
+	}
+	interaction := &Interaction{
+		ID:    generateRandomString(32),
+		Stage: InteractionStageLogin,
+		Request: AuthorizationRequest{
+			ClientID: auth.ClientID,
+			Scope:    auth.Scope,
+		},
+		Challenge:  challenge,
+		DeviceCode: auth.DeviceCode,
+		ExpiresAt:  expiresAt,
+	}
+
+	p.mu.RLock()
+	authenticators := p.authenticators
+	p.mu.RUnlock()
+	for _, a := range authenticators {
+		result, err := a.Authenticate(r, interaction, p.storage)
+		if err != nil {
+			continue
+		}
+		interaction.authenticated(result)
+		break
+	}
+
+	return p.advance(interaction, client)
+}
+
+// completeDeviceAuthorization records the user's decision on a device
+// authorization so the device's next poll receives tokens or access_denied
+func (p *OIDCProvider) completeDeviceAuthorization(interaction *Interaction, approved bool) (*AuthorizationOutcome, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	auth, err := p.storage.GetDeviceAuthorization(interaction.DeviceCode)
+	if err != nil || auth.Status != DeviceStatusPending || time.Now().After(auth.ExpiresAt) {
+		return nil, NewOAuthError(ErrCodeInvalidRequest, "device authorization expired")
+	}
+
+	auth.Status = DeviceStatusDenied
+	if approved {
+		auth.Status = DeviceStatusApproved
+		auth.UserID = interaction.UserID
+		auth.AuthTime = interaction.AuthTime
+		auth.AMR = interaction.AMR
+	}
+	if err := p.storage.SaveDeviceAuthorization(auth); err != nil {
+		return nil, NewOAuthError(ErrCodeServerError, "failed to store device authorization: %v", err)
+	}
+
+	verification := &DeviceVerification{
+		UserCode: auth.UserCode,
+		ClientID: auth.ClientID,
+		Approved: approved,
+	}
+	if client, err := p.storage.GetClient(auth.ClientID); err == nil {
+		verification.ClientName = client.Name
+	}
+	return &AuthorizationOutcome{Device: verification}, nil
+}
+
+// DeviceCodeGrant answers a device's poll of the token endpoint. Devices
+// polling faster than the interval are told to slow down, and the interval
+// grows with each violation.
+func (p *OIDCProvider) DeviceCodeGrant(req *TokenRequest) (*TokenResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if req.DeviceCode == "" {
+		return nil, NewOAuthError(ErrCodeInvalidRequest, "device_code is required")
+	}
+
+	// Authenticate client
+	client, err := p.authenticateClient(req)
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err := p.storage.GetDeviceAuthorization(req.DeviceCode)
+	if err != nil || auth.ClientID != client.ClientID {
+		return nil, NewOAuthError(ErrCodeInvalidGrant, "invalid device code")
+	}
+
+	now := time.Now()
+	if now.After(auth.ExpiresAt) {
+		p.storage.DeleteDeviceAuthorization(auth.DeviceCode)
+		return nil, NewOAuthError(ErrCodeExpiredToken, "device code expired")
+	}
+
+	tooFast := !auth.LastPolledAt.IsZero() && now.Sub(auth.LastPolledAt) < time.Duration(auth.Interval)*time.Second
+	auth.LastPolledAt = now
+	if tooFast {
+		auth.Interval += deviceSlowDownStep
+	}
+	if err := p.storage.SaveDeviceAuthorization(auth); err != nil {
+		return nil, NewOAuthError(ErrCodeServerError, "failed to store device authorization: %v", err)
+	}
+	if tooFast {
+		return nil, NewOAuthError(ErrCodeSlowDown, "polling too frequently; wait %d seconds between requests", auth.Interval)
+	}
+
+	switch auth.Status {
+	case DeviceStatusPending:
+		return nil, NewOAuthError(ErrCodeAuthorizationPending, "the user has not yet completed authorization")
+	case DeviceStatusDenied:
+		p.storage.DeleteDeviceAuthorization(auth.DeviceCode)
+		return nil, NewOAuthError(ErrCodeAccessDenied, "the user denied the request")
+	}
+
+	// Approved: device codes are single-use
+	if err := p.storage.DeleteDeviceAuthorization(auth.DeviceCode); err != nil {
+		return nil, NewOAuthError(ErrCodeServerError, "failed to consume device code: %v", err)
+	}
+	return p.issueTokens(tokenGrant{
+		ClientID:     auth.ClientID,
+		UserID:       auth.UserID,
+		Scope:        auth.Scope,
+		AuthTime:     auth.AuthTime,
+		AMR:          auth.AMR,
+		IssueIDToken: hasScope(auth.Scope, "openid"),
+	})
+}
+
+// generateUserCode returns a random XXXX-XXXX user code. Bytes beyond the
+// largest multiple of the alphabet size are rejected to avoid modulo bias.
+func generateUserCode() (string, error) {
+	const limit = 256 - 256%len(userCodeAlphabet)
+	code := make([]byte, 0, 9)
+	b := make([]byte, 1)
+	for len(code) < 9 {
+		if len(code) == 4 {
+			code = append(code, '-')
+			continue
+		}
+		if _, err := rand.Read(b); err != nil {
+			return "", fmt.Errorf("failed to generate user code: %w", err)
+		}
+		if int(b[0]) >= limit {
+			continue
+		}
+		code = append(code, userCodeAlphabet[int(b[0])%len(userCodeAlphabet)])
+	}
+	return string(code), nil
+}
+
+// normalizeUserCode accepts user codes typed in any case, with or without
+// the separator
+func normalizeUserCode(userCode string) string {
+	var letters []byte
+	for _, c := range []byte(strings.ToUpper(userCode)) {
+		if c >= 'A' && c <= 'Z' {
+			letters = append(letters, c)
+		}
+	}
+	if len(letters) != 8 {
+		return string(letters)
+	}
+	return string(letters[:4]) + "-" + string(letters[4:])
+}
@@ -0,0 +1,210 @@
+//go:build js && wasm
+// +build js,wasm
+
+package middleware
+
+import (
+	"time"
+)
+
+// Token type hints (RFC 7009 section 2.1)
+const (
+	TokenTypeHintAccessToken  = "access_token"
+	TokenTypeHintRefreshToken = "refresh_token"
+)
+
+// IntrospectionResponse describes a token to a protected resource
+// (RFC 7662 section 2.2). Inactive tokens carry only Active.
+type IntrospectionResponse struct {
+	Active    bool        `json:"active"`
+	Scope     string      `json:"scope,omitempty"`
+	ClientID  string      `json:"client_id,omitempty"`
+	Username  string      `json:"username,omitempty"`
+	TokenType string      `json:"token_type,omitempty"`
+	ExpiresAt int64       `json:"exp,omitempty"`
+	IssuedAt  int64       `json:"iat,omitempty"`
+	NotBefore int64       `json:"nbf,omitempty"`
+	Subject   string      `json:"sub,omitempty"`
+	Audience  interface{} `json:"aud,omitempty"`
+	Issuer    string      `json:"iss,omitempty"`
+	JWTID     string      `json:"jti,omitempty"`
+}
+
+// IntrospectToken reports whether a token is active and what it grants.
+// Only confidential clients may introspect; any token they present is
+// described, so resource servers can validate tokens issued to others.
+func (p *OIDCProvider) IntrospectToken(req *TokenRequest, token, hint string) (*IntrospectionResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	client, err := p.authenticateClient(req)
+	if err != nil {
+		return nil, err
+	}
+	if client.IsPublic() {
+		return nil, NewOAuthError(ErrCodeUnauthorizedClient, "public clients may not introspect tokens")
+	}
+
+	inactive := &IntrospectionResponse{Active: false}
+	if token == "" {
+		return inactive, nil
+	}
+
+	if hint == TokenTypeHintRefreshToken {
+		if resp := p.introspectRefreshToken(token); resp != nil {
+			return resp, nil
+		}
+		if resp := p.introspectAccessToken(token); resp != nil {
+			return resp, nil
+		}
+		return inactive, nil
+	}
+	if resp := p.introspectAccessToken(token); resp != nil {
+		return resp, nil
+	}
+	if resp := p.introspectRefreshToken(token); resp != nil {
+		return resp, nil
+	}
+	return inactive, nil
+}
+
+// introspectAccessToken describes an active access token, or returns nil.
+// Callers must hold p.mu.
+func (p *OIDCProvider) introspectAccessToken(token string) *IntrospectionResponse {
+	stored, err := p.storage.GetAccessToken(token)
+	if err != nil || time.Now().After(stored.ExpiresAt) || p.familyRevoked(stored.FamilyID) {
+		return nil
+	}
+	claims, err := jwtManager.ValidateToken(token)
+	if err != nil {
+		return nil
+	}
+
+	return &IntrospectionResponse{
+		Active:    true,
+		Scope:     stored.Scope,
+		ClientID:  stored.ClientID,
+		Username:  p.username(stored.UserID),
+		TokenType: "Bearer",
+		ExpiresAt: stored.ExpiresAt.Unix(),
+		IssuedAt:  claims.IssuedAt,
+		NotBefore: claims.NotBefore,
+		Subject:   claims.Subject,
+		Audience:  claims.Audience,
+		Issuer:    claims.Issuer,
+		JWTID:     claims.JWTID,
+	}
+}
+
+// introspectRefreshToken describes an active refresh token, or returns nil.
+// Rotated tokens are inactive. Callers must hold p.mu.
+func (p *OIDCProvider) introspectRefreshToken(token string) *IntrospectionResponse {
+	stored, err := p.storage.GetRefreshToken(token)
+	if err != nil || stored.Used || time.Now().After(stored.ExpiresAt) || p.familyRevoked(stored.FamilyID) {
+		return nil
+	}
+	claims, err := jwtManager.ValidateToken(token)
+	if err != nil {
+		return nil
+	}
+
+	return &IntrospectionResponse{
+		Active:    true,
+		Scope:     stored.Scope,
+		ClientID:  stored.ClientID,
+		Username:  p.username(stored.UserID),
+		TokenType: TokenTypeHintRefreshToken,
+		ExpiresAt: stored.ExpiresAt.Unix(),
+		IssuedAt:  claims.IssuedAt,
+		Subject:   claims.Subject,
+		Issuer:    claims.Issuer,
+		JWTID:     claims.JWTID,
+	}
+}
+
+// username returns a user's username, if the user is known
+func (p *OIDCProvider) username(userID string) string {
+	user, err := p.storage.GetUser(userID)
+	if err != nil {
+		return ""
+	}
+	return user.Username
+}
+
+// RevokeToken revokes a token issued to the authenticated client
+// (RFC 7009). Revoking a refresh token or an access token revokes its whole
+// family, including the other tokens minted from the same grant. Unknown and already invalid tokens are
+// ignored, as the spec requires.
+func (p *OIDCProvider) RevokeToken(req *TokenRequest, token, hint string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	client, err := p.authenticateClient(req)
+	if err != nil {
+		return err
+	}
+	if token == "" {
+		return NewOAuthError(ErrCodeInvalidRequest, "token is required")
+	}
+
+	if hint == TokenTypeHintAccessToken {
+		if found, err := p.revokeAccessToken(client, token); found || err != nil {
+			return err
+		}
+		_, err := p.revokeRefreshToken(client, token)
+		return err
+	}
+	if found, err := p.revokeRefreshToken(client, token); found || err != nil {
+		return err
+	}
+	_, err = p.revokeAccessToken(client, token)
+	return err
+}
+
+// revokeRefreshToken revokes the family of a refresh token issued to client,
+// reporting whether the token was found. Callers must hold p.mu.
+func (p *OIDCProvider) revokeRefreshToken(client *OIDCClient, token string) (bool, error) {
+	stored, err := p.storage.GetRefreshToken(token)
+	if err != nil {
+		return false, nil
+	}
+	if stored.ClientID != client.ClientID {
+		return true, NewOAuthError(ErrCodeUnauthorizedClient, "token was not issued to this client")
+	}
+
+	family, err := p.storage.GetRefreshFamily(stored.FamilyID)
+	if err == nil && !family.Revoked {
+		if err := p.revokeFamily(family); err != nil {
+			return true, NewOAuthError(ErrCodeServerError, "failed to revoke refresh token family: %v", err)
+		}
+	}
+	if err := p.storage.DeleteRefreshToken(token); err != nil {
+		return true, NewOAuthError(ErrCodeServerError, "failed to revoke refresh token: %v", err)
+	}
+	return true, nil
+}
+
+// revokeAccessToken deletes an access token issued to client along with its
+// family, reporting whether the token was found. Callers must hold p.mu.
+func (p *OIDCProvider) revokeAccessToken(client *OIDCClient, token string) (bool, error) {
+	stored, err := p.storage.GetAccessToken(token)
+	if err != nil {
+		return false, nil
+	}
+	if stored.ClientID != client.ClientID {
+		return true, NewOAuthError(ErrCodeUnauthorizedClient, "token was not issued to this client")
+	}
+
+	if stored.FamilyID != "" {
+		family, err := p.storage.GetRefreshFamily(stored.FamilyID)
+		if err == nil && !family.Revoked {
+			if err := p.revokeFamily(family); err != nil {
+				return true, NewOAuthError(ErrCodeServerError, "failed to revoke refresh token family: %v", err)
+			}
+		}
+	}
+	if err := p.storage.DeleteAccessToken(token); err != nil {
+		return true, NewOAuthError(ErrCodeServerError, "failed to revoke access token: %v", err)
+	}
+	return true, nil
+}
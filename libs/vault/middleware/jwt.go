@@ -5,25 +5,35 @@
 package middleware
 
 import (
-	"crypto"
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 )
 
-// JWTManager handles JWT token operations
+// JWTManager handles JWT token operations. Each enabled algorithm signs
+// with the current key of its own rotating key chain; every published key of
+// an enabled algorithm validates.
 type JWTManager struct {
-	privateKey *rsa.PrivateKey
-	publicKey  *rsa.PublicKey
-	kid        string
-	issuer     string
+	mu     sync.Mutex
+	issuer string
+	// algorithms are the enabled JWS algorithms, the default first
+	algorithms []string
+	// keys are ordered by activation
+	keys []*signingKey
+	// configured is set when keys came from configuration
+	configured bool
+	store      SigningKeyStore
+	loadedAt   time.Time
+	// missReloadAt is when an unknown kid last triggered a reload
+	missReloadAt time.Time
+	// disabled is set when the key configuration could not be applied; the
+	// manager then neither signs nor validates
+	disabled error
 }
 
 // JWTHeader represents JWT header
@@ -31,6 +41,8 @@ type JWTHeader struct {
 	Alg string `json:"alg"`
 	Typ string `json:"typ"`
 	Kid string `json:"kid,omitempty"`
+	// UCV is the UCAN spec version, set only on UCANs
+	UCV string `json:"ucv,omitempty"`
 }
 
 // JWTClaims represents standard JWT claims
@@ -46,6 +58,29 @@ type JWTClaims struct {
 	Extra      map[string]interface{} `json:"-"`
 }
 
+// MarshalJSON serializes the standard claims together with Extra. Extra
+// entries never override standard claims.
+func (c JWTClaims) MarshalJSON() ([]byte, error) {
+	type standardClaims JWTClaims
+	data, err := json.Marshal(standardClaims(c))
+	if err != nil || len(c.Extra) == 0 {
+		return data, err
+	}
+
+	merged := make(map[string]interface{}, len(c.Extra))
+	for k, v := range c.Extra {
+		merged[k] = v
+	}
+	var standard map[string]interface{}
+	if err := json.Unmarshal(data, &standard); err != nil {
+		return nil, err
+	}
+	for k, v := range standard {
+		merged[k] = v
+	}
+	return json.Marshal(merged)
+}
+
 // IDToken represents an OpenID Connect ID token
 type IDToken struct {
 	JWTClaims
@@ -64,24 +99,30 @@ type IDToken struct {
 // Global JWT manager instance
 var jwtManager *JWTManager
 
-// InitJWTManager initializes the JWT manager
+// InitJWTManager initializes the JWT manager with the keys and algorithms
+// configured by the host. Without configured keys, a key for each enabled
+// algorithm is generated on first use and rotated on schedule. RS256 alone is
+// enabled unless the host configures otherwise.
 func InitJWTManager() error {
-	// Generate RSA key pair
-	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
-	if err != nil {
-		return fmt.Errorf("failed to generate RSA key: %w", err)
+	jwtManager = &JWTManager{issuer: "https://motor.sonr.io", algorithms: []string{AlgRS256}}
+	if keys := configuredSigningKeys(); len(keys) > 0 {
+		if err := jwtManager.LoadKeys(keys...); err != nil {
+			return err
+		}
 	}
-
-	jwtManager = &JWTManager{
-		privateKey: privateKey,
-		publicKey:  &privateKey.PublicKey,
-		kid:        "motor-key-1",
-		issuer:     "https://motor.sonr.io",
+	if algorithms := configuredSigningAlgorithms(); len(algorithms) > 0 {
+		return jwtManager.SetAlgorithms(algorithms...)
 	}
-
 	return nil
 }
 
+// SetIssuer sets the iss of the tokens the manager signs
+func (m *JWTManager) SetIssuer(issuer string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.issuer = issuer
+}
+
 // GenerateToken generates a JWT token
 func (m *JWTManager) GenerateToken(claims JWTClaims) (string, error) {
 	// Set standard claims
@@ -95,12 +136,27 @@ func (m *JWTManager) GenerateToken(claims JWTClaims) (string, error) {
 		claims.Expiration = time.Now().Add(1 * time.Hour).Unix()
 	}
 
-	// Create header
-	header := JWTHeader{
-		Alg: "RS256",
-		Typ: "JWT",
-		Kid: m.kid,
+	return m.sign(m.defaultAlgorithm(), JWTHeader{Typ: "JWT"}, claims)
+}
+
+// GenerateUCAN signs a UCAN delegation. The claims must carry the UCAN
+// issuer, audience and attenuations; the issuer is not defaulted.
+func (m *JWTManager) GenerateUCAN(claims JWTClaims) (string, error) {
+	if claims.IssuedAt == 0 {
+		claims.IssuedAt = time.Now().Unix()
+	}
+	return m.sign(m.defaultAlgorithm(), JWTHeader{Typ: "JWT", UCV: UCANVersion}, claims)
+}
+
+// sign completes header with the current key for alg and returns the
+// compact JWS
+func (m *JWTManager) sign(alg string, header JWTHeader, claims JWTClaims) (string, error) {
+	key, err := m.currentKey(alg)
+	if err != nil {
+		return "", err
 	}
+	header.Alg = key.alg
+	header.Kid = key.kid
 
 	// Encode header
 	headerJSON, _ := json.Marshal(header)
@@ -112,8 +168,7 @@ func (m *JWTManager) GenerateToken(claims JWTClaims) (string, error) {
 
 	// Create signature
 	message := headerEncoded + "." + claimsEncoded
-	hash := sha256.Sum256([]byte(message))
-	signature, err := rsa.SignPKCS1v15(rand.Reader, m.privateKey, crypto.SHA256, hash[:])
+	signature, err := signingAlgorithms[key.alg].sign(key.private, []byte(message))
 	if err != nil {
 		return "", err
 	}
@@ -124,8 +179,12 @@ func (m *JWTManager) GenerateToken(claims JWTClaims) (string, error) {
 	return token, nil
 }
 
-// GenerateIDToken generates an OpenID Connect ID token
-func (m *JWTManager) GenerateIDToken(subject, audience, nonce string, extra map[string]interface{}) (string, error) {
+// GenerateIDToken generates an OpenID Connect ID token signed with alg, or
+// with the default algorithm when alg is empty
+func (m *JWTManager) GenerateIDToken(alg, subject, audience, nonce string, extra map[string]interface{}) (string, error) {
+	if alg == "" {
+		alg = m.defaultAlgorithm()
+	}
 	idToken := IDToken{
 		JWTClaims: JWTClaims{
 			Issuer:     m.issuer,
@@ -135,9 +194,7 @@ func (m *JWTManager) GenerateIDToken(subject, audience, nonce string, extra map[
 			Expiration: time.Now().Add(1 * time.Hour).Unix(),
 			Nonce:      nonce,
 		},
-		AuthTime:      time.Now().Unix(),
-		Email:         fmt.Sprintf("%s@motor.sonr.io", subject),
-		EmailVerified: true,
+		AuthTime: time.Now().Unix(),
 	}
 
 	// Convert to claims
@@ -149,9 +206,7 @@ func (m *JWTManager) GenerateIDToken(subject, audience, nonce string, extra map[
 		Expiration: idToken.Expiration,
 		Nonce:      idToken.Nonce,
 		Extra: map[string]interface{}{
-			"auth_time":      idToken.AuthTime,
-			"email":          idToken.Email,
-			"email_verified": idToken.EmailVerified,
+			"auth_time": idToken.AuthTime,
 		},
 	}
 
@@ -160,7 +215,7 @@ func (m *JWTManager) GenerateIDToken(subject, audience, nonce string, extra map[
 		claims.Extra[k] = v
 	}
 
-	return m.GenerateToken(claims)
+	return m.sign(alg, JWTHeader{Typ: "JWT"}, claims)
 }
 
 // ValidateToken validates a JWT token
@@ -182,10 +237,17 @@ func (m *JWTManager) ValidateToken(tokenString string) (*JWTClaims, error) {
 		return nil, fmt.Errorf("failed to parse header: %w", err)
 	}
 
-	// Verify algorithm
-	if header.Alg != "RS256" {
+	// Verify algorithm against the allow-list and the key's own algorithm
+	if !m.SupportsAlgorithm(header.Alg) {
 		return nil, fmt.Errorf("unsupported algorithm: %s", header.Alg)
 	}
+	key, ok := m.keyByID(header.Kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", header.Kid)
+	}
+	if key.alg != header.Alg {
+		return nil, fmt.Errorf("signing key %q does not use %s", header.Kid, header.Alg)
+	}
 
 	// Decode claims
 	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
@@ -205,8 +267,7 @@ func (m *JWTManager) ValidateToken(tokenString string) (*JWTClaims, error) {
 		return nil, fmt.Errorf("failed to decode signature: %w", err)
 	}
 
-	hash := sha256.Sum256([]byte(message))
-	if err := rsa.VerifyPKCS1v15(m.publicKey, crypto.SHA256, hash[:], signature); err != nil {
+	if err := signingAlgorithms[key.alg].verify(publicKeyOf(key.private), []byte(message), signature); err != nil {
 		return nil, fmt.Errorf("invalid signature: %w", err)
 	}
 
@@ -223,25 +284,28 @@ func (m *JWTManager) ValidateToken(tokenString string) (*JWTClaims, error) {
 	return &claims, nil
 }
 
-// GetPublicKeyJWK returns the public key in JWK format
+// GetPublicKeyJWK returns the current signing key of the default algorithm
+// in JWK format. Use JWKS to publish every key that may have signed a live
+// token.
 func (m *JWTManager) GetPublicKeyJWK() map[string]interface{} {
-	// Get modulus and exponent
-	n := base64.RawURLEncoding.EncodeToString(m.publicKey.N.Bytes())
-	e := base64.RawURLEncoding.EncodeToString([]byte{1, 0, 1}) // 65537
-
-	return map[string]interface{}{
-		"kty": "RSA",
-		"use": "sig",
-		"kid": m.kid,
-		"alg": "RS256",
-		"n":   n,
-		"e":   e,
+	key, err := m.currentKey(m.defaultAlgorithm())
+	if err != nil {
+		return nil
 	}
+	return key.publicJWK()
 }
 
-// GetPublicKeyPEM returns the public key in PEM format
+// GetPublicKeyPEM returns the current signing key of the default algorithm
+// in PEM format. secp256k1 keys have no PKIX encoding and return "".
 func (m *JWTManager) GetPublicKeyPEM() string {
-	pubKeyBytes, _ := x509.MarshalPKIXPublicKey(m.publicKey)
+	key, err := m.currentKey(m.defaultAlgorithm())
+	if err != nil {
+		return ""
+	}
+	pubKeyBytes, err := x509.MarshalPKIXPublicKey(publicKeyOf(key.private))
+	if err != nil {
+		return ""
+	}
 	pubKeyPEM := pem.EncodeToMemory(&pem.Block{
 		Type:  "PUBLIC KEY",
 		Bytes: pubKeyBytes,
@@ -249,16 +313,31 @@ func (m *JWTManager) GetPublicKeyPEM() string {
 	return string(pubKeyPEM)
 }
 
-// GenerateAccessToken generates an access token
-func (m *JWTManager) GenerateAccessToken(subject, scope string) (string, error) {
+// GenerateAccessToken generates an access token, optionally restricted to
+// the given audiences
+func (m *JWTManager) GenerateAccessToken(subject, scope string, audience ...string) (string, error) {
+	return m.GenerateToken(accessTokenClaims(subject, scope, audience))
+}
+
+// accessTokenClaims returns the claims of an access token with the default
+// lifetime
+func accessTokenClaims(subject, scope string, audience []string) JWTClaims {
 	claims := JWTClaims{
 		Subject: subject,
+		JWTID:   generateRandomString(16),
 		Extra: map[string]interface{}{
 			"scope":      scope,
 			"token_type": "Bearer",
 		},
 	}
-	return m.GenerateToken(claims)
+	switch len(audience) {
+	case 0:
+	case 1:
+		claims.Audience = audience[0]
+	default:
+		claims.Audience = audience
+	}
+	return claims
 }
 
 // GenerateRefreshToken generates a refresh token
@@ -266,6 +345,7 @@ func (m *JWTManager) GenerateRefreshToken(subject string) (string, error) {
 	claims := JWTClaims{
 		Subject:    subject,
 		Expiration: time.Now().Add(30 * 24 * time.Hour).Unix(), // 30 days
+		JWTID:      generateRandomString(16),
 		Extra: map[string]interface{}{
 			"token_type": "refresh",
 		},
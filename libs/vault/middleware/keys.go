@@ -0,0 +1,558 @@
+//go:build js && wasm
+// +build js,wasm
+
+package middleware
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"syscall/js"
+	"time"
+)
+
+const (
+	// keyRotationPeriod is how long a generated key signs before its
+	// successor takes over
+	keyRotationPeriod = 30 * 24 * time.Hour
+	// keyPrePublish publishes a successor this long before it signs, so
+	// relying parties with a cached JWKS already know it
+	keyPrePublish = 24 * time.Hour
+	// keyRetention keeps a retired key for validation and in the JWKS until
+	// every token it signed has expired
+	keyRetention = refreshTokenTTL
+	// keyReloadInterval bounds how long key changes made by other instances
+	// go unnoticed
+	keyReloadInterval = 5 * time.Minute
+	// keyMissReloadInterval limits reloads triggered by unknown kids, which
+	// any caller can present
+	keyMissReloadInterval = time.Minute
+)
+
+// signingKeysGlobal names the JavaScript global read for configured signing
+// keys: a PEM or JWK string, or an array of them. For each algorithm, the
+// first key signs; the others are published for validation only.
+const signingKeysGlobal = "vaultOIDCSigningKeys"
+
+// signingAlgsGlobal names the JavaScript global read for the enabled signing
+// algorithms: a JWS alg or an array of them, the first being the default
+const signingAlgsGlobal = "vaultOIDCSigningAlgs"
+
+// SigningKey is a persisted token signing key. A key signs from ActivatesAt
+// until the next key of its algorithm activates.
+type SigningKey struct {
+	KID string
+	Alg string
+	// PrivateKey is the private JWK
+	PrivateKey  string
+	CreatedAt   time.Time
+	ActivatesAt time.Time
+}
+
+// SigningKeyStore persists generated signing keys, so restarts and other
+// instances sign with the same keys
+type SigningKeyStore interface {
+	SaveSigningKey(key *SigningKey) error
+	ListSigningKeys() ([]*SigningKey, error)
+	DeleteSigningKey(kid string) error
+}
+
+// signingKey is a parsed signing key
+type signingKey struct {
+	kid         string
+	alg         string
+	private     crypto.PrivateKey
+	createdAt   time.Time
+	activatesAt time.Time
+}
+
+// LoadKeys replaces the manager's keys with keys from configuration, each a
+// PEM private key (PKCS #8, PKCS #1 or SEC 1) or a private JWK. The key's
+// type selects its algorithm, and the algorithms are enabled in the order
+// their first key appears. For each algorithm the first key signs and the
+// rest are published for validation only. Configured keys are never rotated
+// or persisted; rotating them is left to the operator.
+func (m *JWTManager) LoadKeys(encoded ...string) error {
+	if len(encoded) == 0 {
+		return fmt.Errorf("no signing keys given")
+	}
+	keys := make([]*signingKey, 0, len(encoded))
+	var algorithms []string
+	for i, e := range encoded {
+		k, err := newSigningKey(e)
+		if err != nil {
+			return fmt.Errorf("signing key %d: %w", i, err)
+		}
+		keys = append(keys, k)
+		if !slices.Contains(algorithms, k.alg) {
+			algorithms = append(algorithms, k.alg)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys = keys
+	m.algorithms = algorithms
+	m.configured = true
+	return nil
+}
+
+// SetAlgorithms enables the given JWS algorithms for signing and validation.
+// The first is the default, used for access tokens and for ID tokens of
+// clients that registered no id_token_signed_response_alg. With configured
+// keys, every algorithm needs a configured key.
+func (m *JWTManager) SetAlgorithms(algorithms ...string) error {
+	if len(algorithms) == 0 {
+		return fmt.Errorf("no signing algorithms given")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, alg := range algorithms {
+		if _, ok := signingAlgorithms[alg]; !ok {
+			return fmt.Errorf("unsupported signing algorithm %q", alg)
+		}
+		if m.configured && !slices.ContainsFunc(m.keys, func(k *signingKey) bool { return k.alg == alg }) {
+			return fmt.Errorf("no signing key configured for %s", alg)
+		}
+	}
+	m.algorithms = slices.Clone(algorithms)
+	return nil
+}
+
+// Algorithms returns the enabled JWS algorithms, the default first
+func (m *JWTManager) Algorithms() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.algorithms)
+}
+
+// SupportsAlgorithm reports whether alg is enabled
+func (m *JWTManager) SupportsAlgorithm(alg string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Contains(m.algorithms, alg)
+}
+
+// defaultAlgorithm returns the algorithm used when none is requested
+func (m *JWTManager) defaultAlgorithm() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.algorithms[0]
+}
+
+// SetKeyStore persists generated keys in store. Keys already in the store
+// replace the manager's; otherwise the manager's keys are saved to it.
+func (m *JWTManager) SetKeyStore(store SigningKeyStore) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.store = store
+	if m.configured || m.disabled != nil {
+		return nil
+	}
+	return m.reload(time.Now())
+}
+
+// Rotate adds a key for alg that takes over signing at activatesAt, which
+// should leave relying parties time to refresh their cached JWKS
+func (m *JWTManager) Rotate(alg string, activatesAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.configured {
+		return fmt.Errorf("configured signing keys are rotated through configuration")
+	}
+	if !slices.Contains(m.algorithms, alg) {
+		return fmt.Errorf("signing algorithm %q is not enabled", alg)
+	}
+	return m.addKey(time.Now(), activatesAt, alg)
+}
+
+// JWKS returns the public JWKs of every published key of the enabled
+// algorithms: the signing keys, successors awaiting activation and retired
+// keys still in use
+func (m *JWTManager) JWKS() []map[string]interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.disabled != nil {
+		return []map[string]interface{}{}
+	}
+	now := time.Now()
+	m.refresh(now)
+	if !m.configured {
+		m.rotate(now)
+	}
+
+	jwks := make([]map[string]interface{}, 0, len(m.keys))
+	for _, k := range m.keys {
+		if slices.Contains(m.algorithms, k.alg) {
+			jwks = append(jwks, k.publicJWK())
+		}
+	}
+	return jwks
+}
+
+// Disable stops the manager from signing and validating, so a broken key
+// configuration fails closed instead of falling back to generated keys
+func (m *JWTManager) Disable(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.disabled = err
+	m.keys = nil
+}
+
+// currentKey returns the key that signs with alg now, rotating first when
+// due
+func (m *JWTManager) currentKey(alg string) (*signingKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.disabled != nil {
+		return nil, fmt.Errorf("token signing is disabled: %w", m.disabled)
+	}
+	if !slices.Contains(m.algorithms, alg) {
+		return nil, fmt.Errorf("signing algorithm %q is not enabled", alg)
+	}
+	now := time.Now()
+	m.refresh(now)
+	if !m.configured {
+		if err := m.rotate(now); err != nil {
+			return nil, err
+		}
+	}
+
+	var current *signingKey
+	for _, k := range m.keys {
+		if k.alg != alg {
+			continue
+		}
+		if m.configured {
+			return k, nil
+		}
+		if current == nil || !k.activatesAt.After(now) {
+			current = k
+		}
+	}
+	if current == nil {
+		return nil, fmt.Errorf("no signing key for %s", alg)
+	}
+	return current, nil
+}
+
+// keyByID returns the published key with kid. An unknown kid reloads the
+// store in case another instance added it, at most once per
+// keyMissReloadInterval.
+func (m *JWTManager) keyByID(kid string) (*signingKey, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.disabled != nil {
+		return nil, false
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		for _, k := range m.keys {
+			if k.kid == kid {
+				return k, true
+			}
+		}
+		now := time.Now()
+		if attempt == 0 && m.store != nil && !m.configured && now.Sub(m.missReloadAt) >= keyMissReloadInterval {
+			m.missReloadAt = now
+			if err := m.reload(now); err != nil {
+				log.Printf("OIDC: failed to reload signing keys: %v", err)
+			}
+		}
+	}
+	return nil, false
+}
+
+// refresh reloads keys from the store when they may be stale. Callers must
+// hold m.mu.
+func (m *JWTManager) refresh(now time.Time) {
+	if m.store != nil && !m.configured && now.Sub(m.loadedAt) > keyReloadInterval {
+		if err := m.reload(now); err != nil {
+			log.Printf("OIDC: failed to reload signing keys: %v", err)
+		}
+	}
+}
+
+// reload replaces the manager's keys with the store's, or seeds an empty
+// store with them. A stored key that does not parse is logged and skipped;
+// when none parse, the current keys are kept. Callers must hold m.mu.
+func (m *JWTManager) reload(now time.Time) error {
+	stored, err := m.store.ListSigningKeys()
+	if err != nil {
+		return fmt.Errorf("failed to load signing keys: %w", err)
+	}
+	m.loadedAt = now
+
+	if len(stored) == 0 {
+		for _, k := range m.keys {
+			if err := m.saveKey(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	keys := make([]*signingKey, 0, len(stored))
+	for _, s := range stored {
+		k, err := newStoredSigningKey(s)
+		if err != nil {
+			log.Printf("OIDC: skipping stored signing key %s: %v", s.KID, err)
+			continue
+		}
+		keys = append(keys, k)
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("none of the %d stored signing keys could be parsed", len(stored))
+	}
+	sortKeys(keys)
+	m.keys = keys
+	return nil
+}
+
+// rotate keeps a key chain for each enabled algorithm. Callers must hold
+// m.mu.
+func (m *JWTManager) rotate(now time.Time) error {
+	for _, alg := range m.algorithms {
+		if err := m.rotateAlgorithm(now, alg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rotateAlgorithm generates the first key for alg, pre-publishes a
+// successor once the newest nears the end of its period, and drops keys
+// retired longer than keyRetention. Keys of other algorithms are left alone.
+// Callers must hold m.mu.
+func (m *JWTManager) rotateAlgorithm(now time.Time, alg string) error {
+	var chain []*signingKey
+	for _, k := range m.keys {
+		if k.alg == alg {
+			chain = append(chain, k)
+		}
+	}
+	if len(chain) == 0 {
+		return m.addKey(now, now, alg)
+	}
+
+	latest := chain[len(chain)-1]
+	if !now.Before(latest.activatesAt.Add(keyRotationPeriod - keyPrePublish)) {
+		activatesAt := latest.activatesAt.Add(keyRotationPeriod)
+		if activatesAt.Before(now) {
+			activatesAt = now
+		}
+		if err := m.addKey(now, activatesAt, alg); err != nil {
+			return err
+		}
+	}
+
+	// A key retires when its successor activates
+	for len(chain) > 1 && now.After(chain[1].activatesAt.Add(keyRetention)) {
+		retired := chain[0]
+		if m.store != nil {
+			if err := m.store.DeleteSigningKey(retired.kid); err != nil {
+				return fmt.Errorf("failed to delete signing key: %w", err)
+			}
+		}
+		m.keys = slices.DeleteFunc(m.keys, func(k *signingKey) bool { return k == retired })
+		chain = chain[1:]
+	}
+	return nil
+}
+
+// addKey generates and persists a key for alg that signs from activatesAt.
+// Callers must hold m.mu.
+func (m *JWTManager) addKey(now, activatesAt time.Time, alg string) error {
+	private, err := signingAlgorithms[alg].generateKey()
+	if err != nil {
+		return fmt.Errorf("failed to generate %s key: %w", alg, err)
+	}
+	k := &signingKey{
+		kid:         jwkThumbprint(publicKeyOf(private)),
+		alg:         alg,
+		private:     private,
+		createdAt:   now,
+		activatesAt: activatesAt,
+	}
+	if err := m.saveKey(k); err != nil {
+		return err
+	}
+	m.keys = append(m.keys, k)
+	sortKeys(m.keys)
+	return nil
+}
+
+// saveKey persists k when the manager has a store. Callers must hold m.mu.
+func (m *JWTManager) saveKey(k *signingKey) error {
+	if m.store == nil {
+		return nil
+	}
+	jwk, err := privateJWK(k.private)
+	if err != nil {
+		return fmt.Errorf("failed to encode signing key: %w", err)
+	}
+	encoded, err := json.Marshal(jwk)
+	if err != nil {
+		return fmt.Errorf("failed to encode signing key: %w", err)
+	}
+	err = m.store.SaveSigningKey(&SigningKey{
+		KID:         k.kid,
+		Alg:         k.alg,
+		PrivateKey:  string(encoded),
+		CreatedAt:   k.createdAt,
+		ActivatesAt: k.activatesAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store signing key: %w", err)
+	}
+	return nil
+}
+
+// sortKeys orders keys by activation, breaking ties by kid so that every
+// instance picks the same signing key
+func sortKeys(keys []*signingKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].activatesAt.Equal(keys[j].activatesAt) {
+			return keys[i].activatesAt.Before(keys[j].activatesAt)
+		}
+		return keys[i].kid < keys[j].kid
+	})
+}
+
+// publicJWK returns the key's public half as a JWK
+func (k *signingKey) publicJWK() map[string]interface{} {
+	jwk := map[string]interface{}{
+		"use": "sig",
+		"kid": k.kid,
+		"alg": k.alg,
+	}
+	for name, v := range publicJWKMembers(publicKeyOf(k.private)) {
+		jwk[name] = v
+	}
+	return jwk
+}
+
+// newSigningKey parses an encoded private key, naming it by its thumbprint
+func newSigningKey(encoded string) (*signingKey, error) {
+	private, err := parseSigningKey(encoded)
+	if err != nil {
+		return nil, err
+	}
+	alg, err := algorithmForKey(private)
+	if err != nil {
+		return nil, err
+	}
+	return &signingKey{kid: jwkThumbprint(publicKeyOf(private)), alg: alg, private: private}, nil
+}
+
+// newStoredSigningKey parses a persisted key, whose private key is always a
+// JWK
+func newStoredSigningKey(s *SigningKey) (*signingKey, error) {
+	private, err := parsePrivateJWK(s.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	alg, err := algorithmForKey(private)
+	if err != nil {
+		return nil, err
+	}
+	return &signingKey{kid: s.KID, alg: alg, private: private, createdAt: s.CreatedAt, activatesAt: s.ActivatesAt}, nil
+}
+
+// parseSigningKey decodes a PEM (PKCS #8, PKCS #1 or SEC 1) or JWK private
+// key
+func parseSigningKey(encoded string) (crypto.PrivateKey, error) {
+	encoded = strings.TrimSpace(encoded)
+	if strings.HasPrefix(encoded, "{") {
+		return parsePrivateJWK(encoded)
+	}
+
+	block, _ := pem.Decode([]byte(encoded))
+	if block == nil {
+		return nil, fmt.Errorf("key is neither PEM nor JWK")
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
+
+// configuredSigningKeys reads signing keys from the signingKeysGlobal
+// JavaScript global, if the host set one
+func configuredSigningKeys() []string {
+	return configuredStrings(signingKeysGlobal)
+}
+
+// configuredSigningAlgorithms reads the enabled algorithms from the
+// signingAlgsGlobal JavaScript global, if the host set one
+func configuredSigningAlgorithms() []string {
+	return configuredStrings(signingAlgsGlobal)
+}
+
+// configuredStrings reads a JavaScript global holding a string or an array
+// of them. Objects are JSON encoded, so JWKs can be given as objects.
+func configuredStrings(name string) []string {
+	v := js.Global().Get(name)
+	if !v.Truthy() {
+		return nil
+	}
+	if v.Type() == js.TypeString {
+		return []string{v.String()}
+	}
+
+	stringify := js.Global().Get("JSON").Get("stringify")
+	encode := func(v js.Value) string {
+		if v.Type() == js.TypeString {
+			return v.String()
+		}
+		return stringify.Invoke(v).String()
+	}
+	if !js.Global().Get("Array").Call("isArray", v).Bool() {
+		return []string{encode(v)}
+	}
+	values := make([]string, v.Length())
+	for i := range values {
+		values[i] = encode(v.Index(i))
+	}
+	return values
+}
+
+// configuredBool reads a JavaScript global holding a boolean, reporting
+// whether it is set
+func configuredBool(name string) (value, ok bool) {
+	v := js.Global().Get(name)
+	if v.Type() != js.TypeBoolean {
+		return false, false
+	}
+	return v.Bool(), true
+}
+
+// configuredObject decodes a JavaScript global holding an object, or its
+// JSON encoding, into v. v is left alone when the global is not set.
+func configuredObject(name string, v interface{}) error {
+	values := configuredStrings(name)
+	if len(values) == 0 {
+		return nil
+	}
+	if len(values) > 1 {
+		return fmt.Errorf("%s must be an object", name)
+	}
+	if err := json.Unmarshal([]byte(values[0]), v); err != nil {
+		return fmt.Errorf("%s must be an object: %w", name, err)
+	}
+	return nil
+}
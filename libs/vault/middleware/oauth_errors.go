@@ -0,0 +1,49 @@
+//go:build js && wasm
+// +build js,wasm
+
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// OAuth 2.0 error codes (RFC 6749 section 5.2)
+const (
+	ErrCodeInvalidRequest       = "invalid_request"
+	ErrCodeInvalidClient        = "invalid_client"
+	ErrCodeInvalidGrant         = "invalid_grant"
+	ErrCodeInvalidScope         = "invalid_scope"
+	ErrCodeUnauthorizedClient   = "unauthorized_client"
+	ErrCodeUnsupportedGrantType = "unsupported_grant_type"
+	ErrCodeServerError          = "server_error"
+	// ErrCodeInvalidToken is the bearer token error from RFC 6750
+	ErrCodeInvalidToken = "invalid_token"
+)
+
+// OAuthError is a protocol error returned to OAuth clients
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	Status      int    `json:"-"`
+}
+
+func (e *OAuthError) Error() string {
+	return e.Description
+}
+
+// NewOAuthError creates an OAuthError with the HTTP status for its code
+func NewOAuthError(code, format string, args ...interface{}) *OAuthError {
+	status := http.StatusBadRequest
+	switch code {
+	case ErrCodeInvalidClient, ErrCodeInvalidToken:
+		status = http.StatusUnauthorized
+	case ErrCodeServerError:
+		status = http.StatusInternalServerError
+	}
+	return &OAuthError{
+		Code:        code,
+		Description: fmt.Sprintf(format, args...),
+		Status:      status,
+	}
+}
@@ -6,7 +6,10 @@ package middleware
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"log"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -14,13 +17,25 @@ import (
 
 // OIDCProvider manages OpenID Connect operations
 type OIDCProvider struct {
-	mu            sync.RWMutex
-	issuer        string
-	authCodes     map[string]*AuthorizationCode
-	accessTokens  map[string]*AccessToken
-	refreshTokens map[string]*RefreshToken
-	clients       map[string]*OIDCClient
-	users         map[string]*User
+	mu      sync.RWMutex
+	issuer  string
+	storage OIDCStorage
+
+	// disallowPlainPKCE restricts code challenges to S256
+	disallowPlainPKCE bool
+	// softwareStatementIssuers maps trusted software statement issuers to
+	// their public JWKs
+	softwareStatementIssuers map[string]map[string]interface{}
+	// registrationTokens are SHA-256 digests of the initial access tokens
+	// that authorize registration
+	registrationTokens [][32]byte
+	// authenticators verify end users at the authorization endpoint
+	authenticators []Authenticator
+	// interactionURL is the login and consent UI, if any
+	interactionURL string
+	// scopeCapabilities maps scopes to the UCAN capabilities that stand for
+	// them in token exchange
+	scopeCapabilities map[string]UCANCapability
 }
 
 // AuthorizationCode represents an authorization code
@@ -35,35 +50,64 @@ type AuthorizationCode struct {
 	ExpiresAt           time.Time
 	CodeChallenge       string
 	CodeChallengeMethod string
+	AuthTime            time.Time
+	AMR                 []string
 }
 
-// AccessToken represents an access token
+// AccessToken represents an access token. Audience lists the resource
+// indicators the token is restricted to.
 type AccessToken struct {
-	Token     string
-	ClientID  string
-	UserID    string
-	Scope     string
-	ExpiresAt time.Time
+	Token    string
+	ClientID string
+	UserID   string
+	Scope    string
+	FamilyID string
+	Audience []string
+	// Delegation is the UCAN the token was exchanged for, if any
+	Delegation string
+	ExpiresAt  time.Time
 }
 
-// RefreshToken represents a refresh token
+// RefreshToken represents a refresh token. Rotated tokens are kept, marked
+// Used, until they expire so that replays can be detected.
 type RefreshToken struct {
 	Token     string
 	ClientID  string
 	UserID    string
 	Scope     string
+	FamilyID  string
+	Used      bool
 	ExpiresAt time.Time
 }
 
-// OIDCClient represents an OIDC client application
+// OIDCClient represents an OIDC client application. Only a salted hash of
+// the client secret is stored.
 type OIDCClient struct {
-	ClientID      string
-	ClientSecret  string
-	RedirectURIs  []string
-	GrantTypes    []string
-	ResponseTypes []string
-	Scopes        []string
-	Name          string
+	ClientID                string
+	ClientSecretHash        string
+	TokenEndpointAuthMethod string
+	JWKS                    []map[string]interface{}
+	RedirectURIs            []string
+	GrantTypes              []string
+	ResponseTypes           []string
+	Scopes                  []string
+	Name                    string
+	// RequirePKCE rejects authorization requests without a code challenge.
+	// Public clients always require PKCE.
+	RequirePKCE bool
+	// Resources restricts the resource indicators the client may request
+	// tokens for; empty allows any
+	Resources []string
+	// IDTokenSignedResponseAlg is the JWS alg of the client's ID tokens;
+	// empty uses the default algorithm
+	IDTokenSignedResponseAlg string
+
+	// Dynamic registration (RFC 7591/7592)
+	RegistrationTokenHash string
+	IssuedAt              int64
+	SoftwareID            string
+	SoftwareVersion       string
+	SoftwareStatement     string
 }
 
 // User represents a user
@@ -75,6 +119,8 @@ type User struct {
 	Name          string
 	GivenName     string
 	FamilyName    string
+	// Credentials are the user's registered passkeys
+	Credentials []WebAuthnCredential
 }
 
 // OIDCDiscovery represents OIDC discovery document
@@ -85,6 +131,9 @@ type OIDCDiscovery struct {
 	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
 	JWKSUri                           string   `json:"jwks_uri"`
 	RegistrationEndpoint              string   `json:"registration_endpoint,omitempty"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint,omitempty"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint,omitempty"`
+	RevocationEndpoint                string   `json:"revocation_endpoint,omitempty"`
 	ScopesSupported                   []string `json:"scopes_supported"`
 	ResponseTypesSupported            []string `json:"response_types_supported"`
 	ResponseModesSupported            []string `json:"response_modes_supported,omitempty"`
@@ -93,8 +142,12 @@ type OIDCDiscovery struct {
 	SubjectTypesSupported             []string `json:"subject_types_supported"`
 	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
 	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	TokenEndpointAuthSigningAlgValues []string `json:"token_endpoint_auth_signing_alg_values_supported,omitempty"`
 	ClaimsSupported                   []string `json:"claims_supported"`
 	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+
+	IntrospectionEndpointAuthMethodsSupported []string `json:"introspection_endpoint_auth_methods_supported,omitempty"`
+	RevocationEndpointAuthMethodsSupported    []string `json:"revocation_endpoint_auth_methods_supported,omitempty"`
 }
 
 // TokenRequest represents a token request
@@ -107,6 +160,20 @@ type TokenRequest struct {
 	RefreshToken string `json:"refresh_token,omitempty"`
 	Scope        string `json:"scope,omitempty"`
 	CodeVerifier string `json:"code_verifier,omitempty"`
+	// Resource holds RFC 8707 resource indicators
+	Resource   []string `json:"resource,omitempty"`
+	DeviceCode string   `json:"device_code,omitempty"`
+	// Token exchange parameters (RFC 8693)
+	SubjectToken       string   `json:"subject_token,omitempty"`
+	SubjectTokenType   string   `json:"subject_token_type,omitempty"`
+	RequestedTokenType string   `json:"requested_token_type,omitempty"`
+	Audience           []string `json:"audience,omitempty"`
+
+	ClientAssertionType string `json:"client_assertion_type,omitempty"`
+	ClientAssertion     string `json:"client_assertion,omitempty"`
+	// AuthMethod is set to client_secret_basic when credentials arrived in
+	// the Authorization header
+	AuthMethod string `json:"-"`
 }
 
 // TokenResponse represents a token response
@@ -117,36 +184,90 @@ type TokenResponse struct {
 	RefreshToken string `json:"refresh_token,omitempty"`
 	IDToken      string `json:"id_token,omitempty"`
 	Scope        string `json:"scope,omitempty"`
+	// IssuedTokenType is set by token exchange (RFC 8693)
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
 }
 
+// defaultIssuer is the issuer used unless vaultOIDCIssuer is set
+const defaultIssuer = "https://motor.sonr.io"
+
+// issuerGlobal names the JavaScript global read for the issuer URL, which
+// also sets the passkey relying party ID and the sign-in message domain
+const issuerGlobal = "vaultOIDCIssuer"
+
+// interactionURLGlobal names the JavaScript global read for the login and
+// consent UI. Its origin is also allowed for passkey and sign-in messages.
+const interactionURLGlobal = "vaultOIDCInteractionURL"
+
+// allowPlainPKCEGlobal names the JavaScript global read for whether the
+// plain code challenge method is accepted: a boolean, true when unset
+const allowPlainPKCEGlobal = "vaultOIDCAllowPlainPKCE"
+
+// softwareStatementIssuersGlobal names the JavaScript global read for the
+// trusted software statement issuers: an object mapping each iss to its
+// public JWK
+const softwareStatementIssuersGlobal = "vaultOIDCSoftwareStatementIssuers"
+
+// scopeCapabilitiesGlobal names the JavaScript global read for the UCAN
+// capabilities standing for scopes in token exchange: an object mapping each
+// scope to a {"with", "can"} capability
+const scopeCapabilitiesGlobal = "vaultOIDCScopeCapabilities"
+
 // Global OIDC provider instance
 var oidcProvider = &OIDCProvider{
-	issuer:        "https://motor.sonr.io",
-	authCodes:     make(map[string]*AuthorizationCode),
-	accessTokens:  make(map[string]*AccessToken),
-	refreshTokens: make(map[string]*RefreshToken),
-	clients:       make(map[string]*OIDCClient),
-	users:         make(map[string]*User),
+	issuer: defaultIssuer,
 }
 
 // Initialize OIDC provider
 func init() {
-	// Initialize JWT manager
-	InitJWTManager()
+	// Initialize JWT manager. A key configuration that cannot be applied
+	// disables signing rather than falling back to generated keys.
+	if err := InitJWTManager(); err != nil {
+		log.Printf("OIDC: invalid signing key configuration, token signing disabled: %v", err)
+		jwtManager.Disable(err)
+	}
 
-	// Add default client for testing
-	oidcProvider.clients["motor-client"] = &OIDCClient{
-		ClientID:      "motor-client",
-		ClientSecret:  "motor-secret",
-		RedirectURIs:  []string{"https://localhost:3000/callback", "http://localhost:3000/callback"},
-		GrantTypes:    []string{"authorization_code", "refresh_token"},
-		ResponseTypes: []string{"code", "token", "id_token"},
-		Scopes:        []string{"openid", "profile", "email"},
-		Name:          "Motor Test Client",
+	// Use host-provided storage when available
+	oidcProvider.storage = defaultOIDCStorage()
+	if err := jwtManager.SetKeyStore(oidcProvider.storage); err != nil {
+		log.Printf("OIDC: failed to load signing keys, token signing disabled: %v", err)
+		jwtManager.Disable(err)
 	}
+	oidcProvider.SetRegistrationTokens(configuredStrings(registrationTokensGlobal)...)
+	configureProviderPolicy(oidcProvider)
+
+	if issuer := configuredStrings(issuerGlobal); len(issuer) > 0 {
+		if err := oidcProvider.SetIssuer(issuer[0]); err != nil {
+			log.Printf("OIDC: ignoring %s: %v", issuerGlobal, err)
+		}
+	}
+	var interactionURL string
+	if u := configuredStrings(interactionURLGlobal); len(u) > 0 {
+		interactionURL = u[0]
+		oidcProvider.SetInteractionURL(interactionURL)
+	}
+	authenticators, err := DefaultAuthenticators(oidcProvider.issuer, interactionURL)
+	if err != nil {
+		log.Printf("OIDC: ignoring %s: %v", interactionURLGlobal, err)
+		authenticators, _ = DefaultAuthenticators(oidcProvider.issuer, "")
+	}
+	oidcProvider.SetAuthenticators(authenticators...)
+
+	// Add default client for testing
+	secretHash, _ := HashClientSecret("motor-secret")
+	oidcProvider.seedClient(&OIDCClient{
+		ClientID:                "motor-client",
+		ClientSecretHash:        secretHash,
+		TokenEndpointAuthMethod: AuthMethodClientSecretBasic,
+		RedirectURIs:            []string{"https://localhost:3000/callback", "http://localhost:3000/callback"},
+		GrantTypes:              []string{"authorization_code", "implicit", "refresh_token"},
+		ResponseTypes:           []string{"code", "token", "id_token", "code id_token"},
+		Scopes:                  []string{"openid", "profile", "email"},
+		Name:                    "Motor Test Client",
+	})
 
 	// Add default user for testing
-	oidcProvider.users["test-user"] = &User{
+	oidcProvider.seedUser(&User{
 		ID:            "test-user",
 		Username:      "testuser",
 		Email:         "test@motor.sonr.io",
@@ -154,59 +275,110 @@ func init() {
 		Name:          "Test User",
 		GivenName:     "Test",
 		FamilyName:    "User",
+	})
+}
+
+// configureProviderPolicy applies the PKCE, software statement and token
+// exchange settings from the JavaScript globals. Invalid entries are logged
+// and left out, so an issuer that cannot be parsed is not trusted.
+func configureProviderPolicy(p *OIDCProvider) {
+	if allow, ok := configuredBool(allowPlainPKCEGlobal); ok {
+		p.SetAllowPlainPKCE(allow)
+	}
+
+	var issuers map[string]map[string]interface{}
+	if err := configuredObject(softwareStatementIssuersGlobal, &issuers); err != nil {
+		log.Printf("OIDC: ignoring %v", err)
+	}
+	for iss, jwk := range issuers {
+		if err := p.TrustSoftwareStatementIssuer(iss, jwk); err != nil {
+			log.Printf("OIDC: not trusting software statement issuer %q: %v", iss, err)
+		}
+	}
+
+	var capabilities map[string]UCANCapability
+	if err := configuredObject(scopeCapabilitiesGlobal, &capabilities); err != nil {
+		log.Printf("OIDC: ignoring %v", err)
+	}
+	for scope, c := range capabilities {
+		if c.Resource == "" || c.Ability == "" {
+			log.Printf("OIDC: ignoring capability for scope %q: with and can are required", scope)
+			continue
+		}
+		p.SetScopeCapability(scope, c.Resource, c.Ability)
+	}
+}
+
+// SetStorage replaces the provider's storage backend, which also persists
+// generated signing keys
+func (p *OIDCProvider) SetStorage(storage OIDCStorage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.storage = storage
+	return jwtManager.SetKeyStore(storage)
+}
+
+// seedClient registers a client unless persistent storage already holds it
+func (p *OIDCProvider) seedClient(client *OIDCClient) {
+	if _, err := p.storage.GetClient(client.ClientID); errors.Is(err, ErrNotFound) {
+		p.storage.SaveClient(client)
+	}
+}
+
+// seedUser registers a user unless persistent storage already holds it
+func (p *OIDCProvider) seedUser(user *User) {
+	if _, err := p.storage.GetUser(user.ID); errors.Is(err, ErrNotFound) {
+		p.storage.SaveUser(user)
 	}
 }
 
 // GetDiscovery returns OIDC discovery document
 func (p *OIDCProvider) GetDiscovery() *OIDCDiscovery {
 	return &OIDCDiscovery{
-		Issuer:                p.issuer,
-		AuthorizationEndpoint: "/authorize",
-		TokenEndpoint:         "/token",
-		UserInfoEndpoint:      "/userinfo",
-		JWKSUri:               "/.well-known/jwks.json",
+		Issuer:                      p.issuer,
+		AuthorizationEndpoint:       "/authorize",
+		TokenEndpoint:               "/token",
+		UserInfoEndpoint:            "/userinfo",
+		JWKSUri:                     "/.well-known/jwks.json",
+		RegistrationEndpoint:        "/register",
+		IntrospectionEndpoint:       "/introspect",
+		DeviceAuthorizationEndpoint: "/device_authorization",
+		RevocationEndpoint:          "/revoke",
 		ScopesSupported: []string{
 			"openid", "profile", "email", "offline_access",
 		},
-		ResponseTypesSupported: []string{
-			"code", "token", "id_token", "code token", "code id_token", "token id_token", "code token id_token",
-		},
+		ResponseTypesSupported: supportedResponseTypes,
+		ResponseModesSupported: supportedResponseModes,
 		GrantTypesSupported: []string{
-			"authorization_code", "implicit", "refresh_token",
+			"authorization_code", "implicit", "refresh_token", "client_credentials", GrantTypeDeviceCode, GrantTypeTokenExchange,
 		},
 		SubjectTypesSupported:            []string{"public"},
-		IDTokenSigningAlgValuesSupported: []string{"RS256"},
+		IDTokenSigningAlgValuesSupported: jwtManager.Algorithms(),
 		TokenEndpointAuthMethodsSupported: []string{
-			"client_secret_basic", "client_secret_post",
+			AuthMethodClientSecretBasic, AuthMethodClientSecretPost, AuthMethodPrivateKeyJWT, AuthMethodNone,
 		},
+		TokenEndpointAuthSigningAlgValues: supportedAlgorithms,
 		ClaimsSupported: []string{
 			"sub", "name", "given_name", "family_name", "email", "email_verified",
 		},
-		CodeChallengeMethodsSupported: []string{"plain", "S256"},
+		CodeChallengeMethodsSupported: p.pkceMethods(),
+		IntrospectionEndpointAuthMethodsSupported: []string{
+			AuthMethodClientSecretBasic, AuthMethodClientSecretPost, AuthMethodPrivateKeyJWT,
+		},
+		RevocationEndpointAuthMethodsSupported: []string{
+			AuthMethodClientSecretBasic, AuthMethodClientSecretPost, AuthMethodPrivateKeyJWT, AuthMethodNone,
+		},
 	}
 }
 
-// GenerateAuthorizationCode generates an authorization code
-func (p *OIDCProvider) GenerateAuthorizationCode(clientID, redirectURI, scope, state, nonce, userID string, codeChallenge, codeChallengeMethod string) (*AuthorizationCode, error) {
+// GenerateAuthorizationCode issues an authorization code for a validated
+// request on behalf of an authenticated user
+func (p *OIDCProvider) GenerateAuthorizationCode(req *AuthorizationRequest, auth *AuthResult) (*AuthorizationCode, error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	// Validate client
-	client, exists := p.clients[clientID]
-	if !exists {
-		return nil, fmt.Errorf("invalid client_id")
-	}
-
-	// Validate redirect URI
-	validRedirect := false
-	for _, uri := range client.RedirectURIs {
-		if uri == redirectURI {
-			validRedirect = true
-			break
-		}
-	}
-	if !validRedirect {
-		return nil, fmt.Errorf("invalid redirect_uri")
+	if _, err := p.validateAuthorizationRequest(req); err != nil {
+		return nil, err
 	}
 
 	// Generate code
@@ -214,18 +386,22 @@ func (p *OIDCProvider) GenerateAuthorizationCode(clientID, redirectURI, scope, s
 
 	authCode := &AuthorizationCode{
 		Code:                code,
-		ClientID:            clientID,
-		RedirectURI:         redirectURI,
-		Scope:               scope,
-		State:               state,
-		Nonce:               nonce,
-		UserID:              userID,
+		ClientID:            req.ClientID,
+		RedirectURI:         req.RedirectURI,
+		Scope:               req.Scope,
+		State:               req.State,
+		Nonce:               req.Nonce,
+		UserID:              auth.UserID,
 		ExpiresAt:           time.Now().Add(10 * time.Minute),
-		CodeChallenge:       codeChallenge,
-		CodeChallengeMethod: codeChallengeMethod,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		AuthTime:            auth.AuthTime,
+		AMR:                 auth.AMR,
 	}
 
-	p.authCodes[code] = authCode
+	if err := p.storage.SaveAuthCode(authCode); err != nil {
+		return nil, p.authorizationError(req, NewOAuthError(ErrCodeServerError, "failed to store authorization code: %v", err))
+	}
 
 	return authCode, nil
 }
@@ -235,67 +411,160 @@ func (p *OIDCProvider) ExchangeCode(req *TokenRequest) (*TokenResponse, error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	// Authenticate client
+	client, err := p.authenticateClient(req)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get authorization code
-	authCode, exists := p.authCodes[req.Code]
-	if !exists {
-		return nil, fmt.Errorf("invalid authorization code")
+	authCode, err := p.storage.GetAuthCode(req.Code)
+	if err != nil {
+		return nil, NewOAuthError(ErrCodeInvalidGrant, "invalid authorization code")
 	}
 
 	// Validate code hasn't expired
 	if time.Now().After(authCode.ExpiresAt) {
-		delete(p.authCodes, req.Code)
-		return nil, fmt.Errorf("authorization code expired")
+		p.storage.DeleteAuthCode(req.Code)
+		return nil, NewOAuthError(ErrCodeInvalidGrant, "authorization code expired")
 	}
 
 	// Validate client
-	if authCode.ClientID != req.ClientID {
-		return nil, fmt.Errorf("client_id mismatch")
+	if authCode.ClientID != client.ClientID {
+		return nil, NewOAuthError(ErrCodeInvalidGrant, "client_id mismatch")
 	}
 
 	// Validate redirect URI
 	if authCode.RedirectURI != req.RedirectURI {
-		return nil, fmt.Errorf("redirect_uri mismatch")
+		return nil, NewOAuthError(ErrCodeInvalidGrant, "redirect_uri mismatch")
 	}
 
-	// Validate PKCE if present
-	if authCode.CodeChallenge != "" {
-		if !validatePKCE(authCode.CodeChallenge, authCode.CodeChallengeMethod, req.CodeVerifier) {
-			return nil, fmt.Errorf("invalid code_verifier")
+	// Validate PKCE. Clients that must use PKCE, including public clients
+	// which are only authenticated by it, cannot redeem codes without it.
+	if authCode.CodeChallenge == "" {
+		if client.RequiresPKCE() {
+			return nil, NewOAuthError(ErrCodeInvalidGrant, "PKCE is required for this client")
+		}
+		if req.CodeVerifier != "" {
+			return nil, NewOAuthError(ErrCodeInvalidGrant, "code_verifier sent for a code issued without PKCE")
 		}
+	} else if !validatePKCE(authCode.CodeChallenge, authCode.CodeChallengeMethod, req.CodeVerifier) {
+		return nil, NewOAuthError(ErrCodeInvalidGrant, "invalid code_verifier")
 	}
 
 	// Delete used code
-	delete(p.authCodes, req.Code)
+	if err := p.storage.DeleteAuthCode(req.Code); err != nil {
+		return nil, NewOAuthError(ErrCodeServerError, "failed to consume authorization code: %v", err)
+	}
+
+	return p.issueTokens(tokenGrant{
+		ClientID:     authCode.ClientID,
+		UserID:       authCode.UserID,
+		Scope:        authCode.Scope,
+		Nonce:        authCode.Nonce,
+		AuthTime:     authCode.AuthTime,
+		AMR:          authCode.AMR,
+		IssueIDToken: true,
+	})
+}
+
+// tokenGrant describes the tokens to mint for an authorized client
+type tokenGrant struct {
+	ClientID string
+	UserID   string
+	// Scope is granted to the access token
+	Scope string
+	// GrantScope is the full scope of the grant, carried by the refresh
+	// token. Defaults to Scope.
+	GrantScope string
+	Nonce      string
+	// FamilyID continues an existing refresh token family; a new family is
+	// started when empty
+	FamilyID string
+	// AuthTime and AMR describe the end-user authentication behind the grant
+	AuthTime     time.Time
+	AMR          []string
+	IssueIDToken bool
+}
+
+// issueTokens mints and stores an access token, a rotated refresh token and
+// optionally an ID token. Callers must hold p.mu.
+func (p *OIDCProvider) issueTokens(grant tokenGrant) (*TokenResponse, error) {
+	now := time.Now()
+	if grant.GrantScope == "" {
+		grant.GrantScope = grant.Scope
+	}
+
+	family := &RefreshFamily{
+		ID:       grant.FamilyID,
+		ClientID: grant.ClientID,
+		UserID:   grant.UserID,
+		AuthTime: grant.AuthTime,
+		AMR:      grant.AMR,
+	}
+	if family.ID == "" {
+		family.ID = generateRandomString(32)
+	}
+	family.ExpiresAt = now.Add(refreshTokenTTL)
 
 	// Generate tokens
-	accessToken, _ := jwtManager.GenerateAccessToken(authCode.UserID, authCode.Scope)
-	refreshToken, _ := jwtManager.GenerateRefreshToken(authCode.UserID)
-	idToken, _ := jwtManager.GenerateIDToken(authCode.UserID, authCode.ClientID, authCode.Nonce, nil)
+	accessToken, err := jwtManager.GenerateAccessToken(grant.UserID, grant.Scope)
+	if err != nil {
+		return nil, NewOAuthError(ErrCodeServerError, "failed to generate access token: %v", err)
+	}
+	refreshToken, err := jwtManager.GenerateRefreshToken(grant.UserID)
+	if err != nil {
+		return nil, NewOAuthError(ErrCodeServerError, "failed to generate refresh token: %v", err)
+	}
+	var idToken string
+	if grant.IssueIDToken {
+		extra := authenticationClaims(grant.AuthTime, grant.AMR)
+		p.emailClaims(grant.UserID, grant.Scope, extra)
+		idToken, err = jwtManager.GenerateIDToken(p.idTokenAlg(grant.ClientID), grant.UserID, grant.ClientID, grant.Nonce, extra)
+		if err != nil {
+			return nil, NewOAuthError(ErrCodeServerError, "failed to generate ID token: %v", err)
+		}
+	}
 
 	// Store tokens
-	p.accessTokens[accessToken] = &AccessToken{
+	if err := p.storage.SaveRefreshFamily(family); err != nil {
+		return nil, NewOAuthError(ErrCodeServerError, "failed to store refresh token family: %v", err)
+	}
+	if grant.FamilyID == "" {
+		if err := p.recordConsentFamily(grant.UserID, grant.ClientID, family.ID); err != nil {
+			return nil, NewOAuthError(ErrCodeServerError, "failed to record refresh token family: %v", err)
+		}
+	}
+
+	if err := p.storage.SaveAccessToken(&AccessToken{
 		Token:     accessToken,
-		ClientID:  authCode.ClientID,
-		UserID:    authCode.UserID,
-		Scope:     authCode.Scope,
-		ExpiresAt: time.Now().Add(1 * time.Hour),
+		ClientID:  grant.ClientID,
+		UserID:    grant.UserID,
+		Scope:     grant.Scope,
+		FamilyID:  family.ID,
+		ExpiresAt: now.Add(accessTokenTTL),
+	}); err != nil {
+		return nil, NewOAuthError(ErrCodeServerError, "failed to store access token: %v", err)
 	}
 
-	p.refreshTokens[refreshToken] = &RefreshToken{
+	if err := p.storage.SaveRefreshToken(&RefreshToken{
 		Token:     refreshToken,
-		ClientID:  authCode.ClientID,
-		UserID:    authCode.UserID,
-		Scope:     authCode.Scope,
-		ExpiresAt: time.Now().Add(30 * 24 * time.Hour),
+		ClientID:  grant.ClientID,
+		UserID:    grant.UserID,
+		Scope:     grant.GrantScope,
+		FamilyID:  family.ID,
+		ExpiresAt: family.ExpiresAt,
+	}); err != nil {
+		return nil, NewOAuthError(ErrCodeServerError, "failed to store refresh token: %v", err)
 	}
 
 	return &TokenResponse{
 		AccessToken:  accessToken,
 		TokenType:    "Bearer",
-		ExpiresIn:    3600,
+		ExpiresIn:    int(accessTokenTTL.Seconds()),
 		RefreshToken: refreshToken,
 		IDToken:      idToken,
-		Scope:        authCode.Scope,
+		Scope:        grant.Scope,
 	}, nil
 }
 
@@ -305,8 +574,8 @@ func (p *OIDCProvider) GetUserInfo(accessToken string) (map[string]interface{},
 	defer p.mu.RUnlock()
 
 	// Validate access token
-	token, exists := p.accessTokens[accessToken]
-	if !exists {
+	token, err := p.storage.GetAccessToken(accessToken)
+	if err != nil {
 		return nil, fmt.Errorf("invalid access token")
 	}
 
@@ -315,9 +584,14 @@ func (p *OIDCProvider) GetUserInfo(accessToken string) (map[string]interface{},
 		return nil, fmt.Errorf("access token expired")
 	}
 
+	// Tokens from a revoked refresh token family are no longer valid
+	if p.familyRevoked(token.FamilyID) {
+		return nil, fmt.Errorf("access token revoked")
+	}
+
 	// Get user
-	user, exists := p.users[token.UserID]
-	if !exists {
+	user, err := p.storage.GetUser(token.UserID)
+	if err != nil {
 		return nil, fmt.Errorf("user not found")
 	}
 
@@ -346,6 +620,32 @@ func (p *OIDCProvider) GetUserInfo(accessToken string) (map[string]interface{},
 
 // Helper functions
 
+// authenticationClaims returns the auth_time and amr ID token claims
+func authenticationClaims(authTime time.Time, amr []string) map[string]interface{} {
+	claims := map[string]interface{}{}
+	if !authTime.IsZero() {
+		claims["auth_time"] = authTime.Unix()
+	}
+	if len(amr) > 0 {
+		claims["amr"] = amr
+	}
+	return claims
+}
+
+// emailClaims adds the user's email to ID token claims when scope requests
+// it and the user has an email address on record
+func (p *OIDCProvider) emailClaims(userID, scope string, claims map[string]interface{}) {
+	if !slices.Contains(strings.Fields(scope), "email") {
+		return
+	}
+	user, err := p.storage.GetUser(userID)
+	if err != nil || user.Email == "" {
+		return
+	}
+	claims["email"] = user.Email
+	claims["email_verified"] = user.EmailVerified
+}
+
 // generateRandomString generates a random string
 func generateRandomString(length int) string {
 	bytes := make([]byte, length)
@@ -353,16 +653,6 @@ func generateRandomString(length int) string {
 	return base64.RawURLEncoding.EncodeToString(bytes)[:length]
 }
 
-// validatePKCE validates PKCE code challenge
-func validatePKCE(codeChallenge, method, verifier string) bool {
-	if method == "plain" {
-		return codeChallenge == verifier
-	}
-	// For S256, would need to implement SHA256 hashing
-	// For simplicity, returning true for now
-	return true
-}
-
 func GetOIDCProvider() *OIDCProvider {
 	return oidcProvider
 }
@@ -0,0 +1,116 @@
+//go:build js && wasm
+// +build js,wasm
+
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+)
+
+// PKCE code challenge methods (RFC 7636)
+const (
+	PKCEMethodPlain = "plain"
+	PKCEMethodS256  = "S256"
+)
+
+// Code verifier length bounds from RFC 7636 section 4.1. S256 challenges are
+// always 43 characters, so challenges share the same bounds.
+const (
+	minPKCELength = 43
+	maxPKCELength = 128
+)
+
+// SetAllowPlainPKCE controls whether the plain code challenge method is
+// accepted. When disabled, only S256 is accepted and advertised.
+func (p *OIDCProvider) SetAllowPlainPKCE(allow bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.disallowPlainPKCE = !allow
+}
+
+// pkceMethods lists the code challenge methods the provider accepts
+func (p *OIDCProvider) pkceMethods() []string {
+	if p.disallowPlainPKCE {
+		return []string{PKCEMethodS256}
+	}
+	return []string{PKCEMethodPlain, PKCEMethodS256}
+}
+
+// RequiresPKCE reports whether authorization requests from the client must
+// carry a code challenge
+func (c *OIDCClient) RequiresPKCE() bool {
+	return c.RequirePKCE || c.IsPublic()
+}
+
+// checkCodeChallenge validates the PKCE parameters of an authorization
+// request against the client and provider policy, returning the effective
+// challenge method. Callers must hold p.mu.
+func (p *OIDCProvider) checkCodeChallenge(client *OIDCClient, challenge, method string) (string, error) {
+	if challenge == "" {
+		if method != "" {
+			return "", fmt.Errorf("code_challenge_method without code_challenge")
+		}
+		if client.RequiresPKCE() {
+			return "", fmt.Errorf("code_challenge required")
+		}
+		return "", nil
+	}
+
+	// RFC 7636 section 4.3: the method defaults to plain
+	if method == "" {
+		method = PKCEMethodPlain
+	}
+	switch method {
+	case PKCEMethodS256:
+	case PKCEMethodPlain:
+		if p.disallowPlainPKCE {
+			return "", fmt.Errorf("code_challenge_method plain is not allowed")
+		}
+	default:
+		return "", fmt.Errorf("unsupported code_challenge_method %q", method)
+	}
+
+	if !validPKCEString(challenge) {
+		return "", fmt.Errorf("invalid code_challenge")
+	}
+	return method, nil
+}
+
+// validatePKCE checks a code verifier against the stored challenge
+func validatePKCE(codeChallenge, method, verifier string) bool {
+	if !validPKCEString(verifier) {
+		return false
+	}
+
+	var computed string
+	switch method {
+	case PKCEMethodS256:
+		sum := sha256.Sum256([]byte(verifier))
+		computed = base64.RawURLEncoding.EncodeToString(sum[:])
+	case PKCEMethodPlain:
+		computed = verifier
+	default:
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(codeChallenge)) == 1
+}
+
+// validPKCEString checks the length and unreserved character set required
+// of code verifiers
+func validPKCEString(s string) bool {
+	if len(s) < minPKCELength || len(s) > maxPKCELength {
+		return false
+	}
+	for _, c := range s {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case c == '-', c == '.', c == '_', c == '~':
+		default:
+			return false
+		}
+	}
+	return true
+}
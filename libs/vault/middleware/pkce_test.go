@@ -0,0 +1,108 @@
+//go:build js && wasm
+// +build js,wasm
+
+package middleware
+
+import (
+	"strings"
+	"testing"
+)
+
+// Code verifier and S256 challenge from RFC 7636 appendix B
+const (
+	testVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+func TestValidatePKCE(t *testing.T) {
+	tests := []struct {
+		name      string
+		challenge string
+		method    string
+		verifier  string
+		want      bool
+	}{
+		{"S256", testChallenge, PKCEMethodS256, testVerifier, true},
+		{"S256 wrong verifier", testChallenge, PKCEMethodS256, strings.Repeat("a", 43), false},
+		{"plain", testVerifier, PKCEMethodPlain, testVerifier, true},
+		{"plain mismatch", testVerifier, PKCEMethodPlain, testVerifier + "x", false},
+		{"plain verifier against S256 challenge", testChallenge, PKCEMethodPlain, testVerifier, false},
+		{"unknown method", testChallenge, "S512", testVerifier, false},
+		{"empty method", testChallenge, "", testVerifier, false},
+		{"verifier too short", "abc", PKCEMethodPlain, "abc", false},
+		{"verifier too long", strings.Repeat("a", 129), PKCEMethodPlain, strings.Repeat("a", 129), false},
+		{"verifier with reserved characters", strings.Repeat("a", 42) + "+", PKCEMethodPlain, strings.Repeat("a", 42) + "+", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validatePKCE(tt.challenge, tt.method, tt.verifier); got != tt.want {
+				t.Errorf("validatePKCE() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidPKCEString(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want bool
+	}{
+		{"minimum length", strings.Repeat("a", 43), true},
+		{"maximum length", strings.Repeat("a", 128), true},
+		{"below minimum", strings.Repeat("a", 42), false},
+		{"above maximum", strings.Repeat("a", 129), false},
+		{"unreserved characters", strings.Repeat("Az09-._~", 6), true},
+		{"space", strings.Repeat("a", 42) + " ", false},
+		{"percent", strings.Repeat("a", 42) + "%", false},
+		{"non-ASCII", strings.Repeat("a", 41) + "é", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validPKCEString(tt.s); got != tt.want {
+				t.Errorf("validPKCEString(%q) = %v, want %v", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckCodeChallenge(t *testing.T) {
+	confidential := &OIDCClient{ClientID: "web", TokenEndpointAuthMethod: AuthMethodClientSecretBasic}
+	strict := &OIDCClient{ClientID: "strict", TokenEndpointAuthMethod: AuthMethodClientSecretBasic, RequirePKCE: true}
+	public := &OIDCClient{ClientID: "spa", TokenEndpointAuthMethod: AuthMethodNone}
+
+	tests := []struct {
+		name       string
+		client     *OIDCClient
+		plainOff   bool
+		challenge  string
+		method     string
+		wantMethod string
+		wantErr    bool
+	}{
+		{"confidential without PKCE", confidential, false, "", "", "", false},
+		{"public without PKCE", public, false, "", "", "", true},
+		{"RequirePKCE without PKCE", strict, false, "", "", "", true},
+		{"method without challenge", confidential, false, "", PKCEMethodS256, "", true},
+		{"S256", public, false, testChallenge, PKCEMethodS256, PKCEMethodS256, false},
+		{"method defaults to plain", public, false, testVerifier, "", PKCEMethodPlain, false},
+		{"plain allowed", public, false, testVerifier, PKCEMethodPlain, PKCEMethodPlain, false},
+		{"plain disallowed", public, true, testVerifier, PKCEMethodPlain, "", true},
+		{"default plain disallowed", public, true, testVerifier, "", "", true},
+		{"S256 with plain disallowed", public, true, testChallenge, PKCEMethodS256, PKCEMethodS256, false},
+		{"unsupported method", public, false, testChallenge, "S512", "", true},
+		{"challenge too short", public, false, "abc", PKCEMethodS256, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &OIDCProvider{disallowPlainPKCE: tt.plainOff}
+			method, err := p.checkCodeChallenge(tt.client, tt.challenge, tt.method)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkCodeChallenge() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if method != tt.wantMethod {
+				t.Errorf("checkCodeChallenge() method = %q, want %q", method, tt.wantMethod)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+//go:build js && wasm
+// +build js,wasm
+
+package middleware
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// Token lifetimes
+const (
+	accessTokenTTL  = 1 * time.Hour
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// RefreshFamily links every refresh token rotated from a single
+// authorization. Revoking the family invalidates all of its tokens.
+type RefreshFamily struct {
+	ID        string
+	ClientID  string
+	UserID    string
+	AuthTime  time.Time
+	AMR       []string
+	Revoked   bool
+	RevokedAt time.Time
+	ExpiresAt time.Time
+}
+
+// RefreshTokens redeems a refresh token for new tokens. The presented token is
+// rotated; presenting an already rotated token revokes its whole family.
+func (p *OIDCProvider) RefreshTokens(req *TokenRequest) (*TokenResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if req.RefreshToken == "" {
+		return nil, NewOAuthError(ErrCodeInvalidRequest, "refresh_token is required")
+	}
+
+	// Authenticate client
+	client, err := p.authenticateClient(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get refresh token
+	stored, err := p.storage.GetRefreshToken(req.RefreshToken)
+	if err != nil {
+		return nil, NewOAuthError(ErrCodeInvalidGrant, "invalid refresh token")
+	}
+
+	// Validate client binding
+	if stored.ClientID != client.ClientID {
+		return nil, NewOAuthError(ErrCodeInvalidGrant, "refresh token was not issued to this client")
+	}
+	if !slices.Contains(client.GrantTypes, "refresh_token") {
+		return nil, NewOAuthError(ErrCodeUnauthorizedClient, "client is not allowed to use refresh tokens")
+	}
+
+	// Validate family
+	family, err := p.storage.GetRefreshFamily(stored.FamilyID)
+	if err != nil || family.Revoked {
+		return nil, NewOAuthError(ErrCodeInvalidGrant, "refresh token has been revoked")
+	}
+
+	// Reuse of a rotated token means it leaked; revoke everything issued from it
+	if stored.Used {
+		if err := p.revokeFamily(family); err != nil {
+			return nil, NewOAuthError(ErrCodeServerError, "failed to revoke refresh token family: %v", err)
+		}
+		return nil, NewOAuthError(ErrCodeInvalidGrant, "refresh token reuse detected")
+	}
+
+	// Requested scope may only narrow the original grant
+	scope, err := narrowScope(stored.Scope, req.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := p.storage.GetUser(stored.UserID); err != nil {
+		return nil, NewOAuthError(ErrCodeInvalidGrant, "user not found")
+	}
+
+	// Rotate
+	stored.Used = true
+	if err := p.storage.SaveRefreshToken(stored); err != nil {
+		return nil, NewOAuthError(ErrCodeServerError, "failed to rotate refresh token: %v", err)
+	}
+
+	return p.issueTokens(tokenGrant{
+		ClientID:     stored.ClientID,
+		UserID:       stored.UserID,
+		Scope:        scope,
+		GrantScope:   stored.Scope,
+		FamilyID:     family.ID,
+		AuthTime:     family.AuthTime,
+		AMR:          family.AMR,
+		IssueIDToken: hasScope(scope, "openid"),
+	})
+}
+
+// revokeFamily marks a refresh token family revoked. Callers must hold p.mu.
+func (p *OIDCProvider) revokeFamily(family *RefreshFamily) error {
+	family.Revoked = true
+	family.RevokedAt = time.Now()
+	return p.storage.SaveRefreshFamily(family)
+}
+
+// familyRevoked reports whether tokens from the given family were revoked
+func (p *OIDCProvider) familyRevoked(familyID string) bool {
+	if familyID == "" {
+		return false
+	}
+	family, err := p.storage.GetRefreshFamily(familyID)
+	return err == nil && family.Revoked
+}
+
+// narrowScope returns requested when it is a subset of granted, or granted
+// when nothing was requested
+func narrowScope(granted, requested string) (string, error) {
+	if requested == "" {
+		return granted, nil
+	}
+	allowed := strings.Fields(granted)
+	for _, s := range strings.Fields(requested) {
+		if !slices.Contains(allowed, s) {
+			return "", NewOAuthError(ErrCodeInvalidScope, "scope %q exceeds the original grant", s)
+		}
+	}
+	return strings.Join(strings.Fields(requested), " "), nil
+}
+
+// hasScope reports whether a space-delimited scope string includes s
+func hasScope(scope, s string) bool {
+	return slices.Contains(strings.Fields(scope), s)
+}
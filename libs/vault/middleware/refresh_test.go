@@ -0,0 +1,96 @@
+//go:build js && wasm
+// +build js,wasm
+
+package middleware
+
+import (
+	"testing"
+	"time"
+)
+
+// newRefreshTestProvider returns a provider holding a user, a public client
+// allowed to refresh, and one refresh token issued to it for "openid profile"
+func newRefreshTestProvider(t *testing.T) (*OIDCProvider, string) {
+	t.Helper()
+	p := newTestProvider(t)
+	saveTestClient(t, p, &OIDCClient{ClientID: "app", TokenEndpointAuthMethod: AuthMethodNone, GrantTypes: []string{"authorization_code", "refresh_token"}}, "")
+	saveTestClient(t, p, &OIDCClient{ClientID: "other", TokenEndpointAuthMethod: AuthMethodNone, GrantTypes: []string{"refresh_token"}}, "")
+	saveTestClient(t, p, &OIDCClient{ClientID: "norefresh", TokenEndpointAuthMethod: AuthMethodNone, GrantTypes: []string{"authorization_code"}}, "")
+	if err := p.storage.SaveUser(&User{ID: "did:sonr:alice", Username: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	family := &RefreshFamily{ID: "family", ClientID: "app", UserID: "did:sonr:alice", AuthTime: now, ExpiresAt: now.Add(refreshTokenTTL)}
+	if err := p.storage.SaveRefreshFamily(family); err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []*RefreshToken{
+		{Token: "rt", ClientID: "app", UserID: "did:sonr:alice", Scope: "openid profile", FamilyID: family.ID, ExpiresAt: now.Add(refreshTokenTTL)},
+		{Token: "rt-norefresh", ClientID: "norefresh", UserID: "did:sonr:alice", Scope: "openid", FamilyID: family.ID, ExpiresAt: now.Add(refreshTokenTTL)},
+	} {
+		if err := p.storage.SaveRefreshToken(token); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return p, "rt"
+}
+
+func TestRefreshTokensValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		req      TokenRequest
+		wantCode string
+	}{
+		{"missing token", TokenRequest{ClientID: "app"}, ErrCodeInvalidRequest},
+		{"unknown token", TokenRequest{ClientID: "app", RefreshToken: "nope"}, ErrCodeInvalidGrant},
+		{"another client's token", TokenRequest{ClientID: "other", RefreshToken: "rt"}, ErrCodeInvalidGrant},
+		{"client without the refresh grant", TokenRequest{ClientID: "norefresh", RefreshToken: "rt-norefresh"}, ErrCodeUnauthorizedClient},
+		{"scope beyond the grant", TokenRequest{ClientID: "app", RefreshToken: "rt", Scope: "openid email"}, ErrCodeInvalidScope},
+		{"narrowed scope", TokenRequest{ClientID: "app", RefreshToken: "rt", Scope: "openid"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := newRefreshTestProvider(t)
+			resp, err := p.RefreshTokens(&tt.req)
+			wantOAuthError(t, err, tt.wantCode)
+			if err == nil && resp.Scope != tt.req.Scope {
+				t.Errorf("scope = %q, want %q", resp.Scope, tt.req.Scope)
+			}
+		})
+	}
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+	p, original := newRefreshTestProvider(t)
+
+	first, err := p.RefreshTokens(&TokenRequest{ClientID: "app", RefreshToken: original})
+	if err != nil {
+		t.Fatalf("first refresh: %v", err)
+	}
+	if first.RefreshToken == "" || first.RefreshToken == original {
+		t.Fatalf("refresh token was not rotated")
+	}
+	if p.familyRevoked("family") {
+		t.Fatal("family revoked by an ordinary rotation")
+	}
+
+	// Each step presents a token in order; replaying the rotated original
+	// revokes the family, which invalidates the token that replaced it
+	steps := []struct {
+		name     string
+		token    string
+		wantCode string
+	}{
+		{"replayed original", original, ErrCodeInvalidGrant},
+		{"rotated token after reuse", first.RefreshToken, ErrCodeInvalidGrant},
+		{"original again", original, ErrCodeInvalidGrant},
+	}
+	for _, step := range steps {
+		_, err := p.RefreshTokens(&TokenRequest{ClientID: "app", RefreshToken: step.token})
+		wantOAuthError(t, err, step.wantCode)
+		if !p.familyRevoked("family") {
+			t.Fatalf("%s: family not revoked", step.name)
+		}
+	}
+}
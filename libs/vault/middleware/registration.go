@@ -0,0 +1,571 @@
+//go:build js && wasm
+// +build js,wasm
+
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Dynamic client registration error codes (RFC 7591 section 3.2.2)
+const (
+	ErrCodeInvalidRedirectURI          = "invalid_redirect_uri"
+	ErrCodeInvalidClientMetadata       = "invalid_client_metadata"
+	ErrCodeInvalidSoftwareStatement    = "invalid_software_statement"
+	ErrCodeUnapprovedSoftwareStatement = "unapproved_software_statement"
+)
+
+// Registration defaults and credential sizes
+const (
+	defaultRegistrationAuthMethod   = AuthMethodClientSecretBasic
+	defaultRegistrationGrantType    = "authorization_code"
+	defaultRegistrationResponseType = "code"
+	defaultRegistrationScope        = "openid"
+	registrationClientIDLength      = 24
+	registrationSecretLength        = 43
+	registrationAccessTokenLength   = 43
+	// softwareStatementClockSkew is tolerated on software statement exp/nbf
+	softwareStatementClockSkew = 60
+)
+
+// registrationTokensGlobal names the JavaScript global read for initial
+// access tokens authorizing /register: a string or an array of them
+const registrationTokensGlobal = "vaultOIDCRegistrationTokens"
+
+// registrableGrantTypes lists grant types clients may register for
+var registrableGrantTypes = []string{"authorization_code", "implicit", "refresh_token", "client_credentials", GrantTypeDeviceCode, GrantTypeTokenExchange}
+
+// privilegedGrantTypes obtain tokens without a user. Only a trusted software
+// statement can register them, and it must name the resources the client may
+// request tokens for.
+var privilegedGrantTypes = []string{"client_credentials", GrantTypeTokenExchange}
+
+// ClientMetadata is the client metadata accepted at the registration
+// endpoint (RFC 7591 section 2)
+type ClientMetadata struct {
+	RedirectURIs            []string       `json:"redirect_uris,omitempty"`
+	TokenEndpointAuthMethod string         `json:"token_endpoint_auth_method,omitempty"`
+	GrantTypes              []string       `json:"grant_types,omitempty"`
+	ResponseTypes           []string       `json:"response_types,omitempty"`
+	ClientName              string         `json:"client_name,omitempty"`
+	Scope                   string         `json:"scope,omitempty"`
+	JWKS                    *JSONWebKeySet `json:"jwks,omitempty"`
+	JWKSURI                 string         `json:"jwks_uri,omitempty"`
+	SoftwareID              string         `json:"software_id,omitempty"`
+	SoftwareVersion         string         `json:"software_version,omitempty"`
+	SoftwareStatement       string         `json:"software_statement,omitempty"`
+	// IDTokenSignedResponseAlg is the JWS alg of the client's ID tokens
+	// (OpenID Connect Dynamic Client Registration section 2)
+	IDTokenSignedResponseAlg string `json:"id_token_signed_response_alg,omitempty"`
+	// Resources restricts the resource indicators (RFC 8707) the client may
+	// request tokens for
+	Resources []string `json:"resources,omitempty"`
+}
+
+// JSONWebKeySet is a JWK Set document
+type JSONWebKeySet struct {
+	Keys []map[string]interface{} `json:"keys"`
+}
+
+// ClientInformation is the registration response (RFC 7591 section 3.2.1)
+type ClientInformation struct {
+	ClientMetadata
+	ClientID                string `json:"client_id"`
+	ClientSecret            string `json:"client_secret,omitempty"`
+	ClientIDIssuedAt        int64  `json:"client_id_issued_at"`
+	ClientSecretExpiresAt   *int64 `json:"client_secret_expires_at,omitempty"`
+	RegistrationAccessToken string `json:"registration_access_token,omitempty"`
+	RegistrationClientURI   string `json:"registration_client_uri"`
+}
+
+// TrustSoftwareStatementIssuer accepts software statements signed by the
+// given public JWK under iss
+func (p *OIDCProvider) TrustSoftwareStatementIssuer(iss string, jwk map[string]interface{}) error {
+	if _, err := publicKeyFromJWK(jwk); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.softwareStatementIssuers == nil {
+		p.softwareStatementIssuers = make(map[string]map[string]interface{})
+	}
+	p.softwareStatementIssuers[iss] = jwk
+	return nil
+}
+
+// SetRegistrationTokens replaces the initial access tokens (RFC 7591
+// section 3) that authorize registration. Without a valid token, only
+// requests carrying a software statement from a trusted issuer can register.
+func (p *OIDCProvider) SetRegistrationTokens(tokens ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.registrationTokens = p.registrationTokens[:0]
+	for _, t := range tokens {
+		if t != "" {
+			p.registrationTokens = append(p.registrationTokens, sha256.Sum256([]byte(t)))
+		}
+	}
+}
+
+// RegisterClient registers a new client from its metadata, returning its
+// credentials and a registration access token for later management. The
+// request must present an initial access token or a trusted software
+// statement.
+func (p *OIDCProvider) RegisterClient(metadata *ClientMetadata, initialAccessToken string) (*ClientInformation, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if initialAccessToken != "" && !p.validRegistrationToken(initialAccessToken) {
+		return nil, NewOAuthError(ErrCodeInvalidToken, "invalid initial access token")
+	}
+	if initialAccessToken == "" && (metadata == nil || metadata.SoftwareStatement == "") {
+		return nil, NewOAuthError(ErrCodeInvalidToken, "an initial access token or a software statement is required")
+	}
+
+	client := &OIDCClient{
+		ClientID: generateRandomString(registrationClientIDLength),
+		IssuedAt: time.Now().Unix(),
+	}
+	if err := p.applyClientMetadata(client, metadata); err != nil {
+		return nil, err
+	}
+
+	info := p.clientInformation(client)
+	if client.usesSecret() {
+		if err := issueClientSecret(client, info); err != nil {
+			return nil, err
+		}
+	}
+
+	token := generateRandomString(registrationAccessTokenLength)
+	hash, err := HashClientSecret(token)
+	if err != nil {
+		return nil, NewOAuthError(ErrCodeServerError, "%v", err)
+	}
+	client.RegistrationTokenHash = hash
+	info.RegistrationAccessToken = token
+
+	if err := p.storage.SaveClient(client); err != nil {
+		return nil, NewOAuthError(ErrCodeServerError, "failed to store client: %v", err)
+	}
+	return info, nil
+}
+
+// GetClientConfiguration returns a dynamically registered client's metadata
+// (RFC 7592 section 2.1)
+func (p *OIDCProvider) GetClientConfiguration(clientID, registrationToken string) (*ClientInformation, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	client, err := p.authorizeRegistration(clientID, registrationToken)
+	if err != nil {
+		return nil, err
+	}
+	return p.clientInformation(client), nil
+}
+
+// UpdateClientConfiguration replaces a dynamically registered client's
+// metadata. Credentials are kept. (RFC 7592 section 2.2)
+func (p *OIDCProvider) UpdateClientConfiguration(clientID, registrationToken string, metadata *ClientMetadata) (*ClientInformation, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	client, err := p.authorizeRegistration(clientID, registrationToken)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := &OIDCClient{
+		ClientID:              client.ClientID,
+		ClientSecretHash:      client.ClientSecretHash,
+		RegistrationTokenHash: client.RegistrationTokenHash,
+		IssuedAt:              client.IssuedAt,
+		RequirePKCE:           client.RequirePKCE,
+	}
+	if err := p.applyClientMetadata(updated, metadata); err != nil {
+		return nil, err
+	}
+
+	// A client switching to a secret-based method needs a new secret
+	info := p.clientInformation(updated)
+	if !updated.usesSecret() {
+		updated.ClientSecretHash = ""
+	} else if updated.ClientSecretHash == "" {
+		if err := issueClientSecret(updated, info); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.storage.SaveClient(updated); err != nil {
+		return nil, NewOAuthError(ErrCodeServerError, "failed to store client: %v", err)
+	}
+	return info, nil
+}
+
+// DeleteClientConfiguration deregisters a dynamically registered client
+// (RFC 7592 section 2.3)
+func (p *OIDCProvider) DeleteClientConfiguration(clientID, registrationToken string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, err := p.authorizeRegistration(clientID, registrationToken); err != nil {
+		return err
+	}
+	if err := p.storage.DeleteClient(clientID); err != nil {
+		return NewOAuthError(ErrCodeServerError, "failed to delete client: %v", err)
+	}
+	return nil
+}
+
+// usesSecret reports whether the client authenticates with a client secret
+func (c *OIDCClient) usesSecret() bool {
+	method := c.authMethod()
+	return method == AuthMethodClientSecretBasic || method == AuthMethodClientSecretPost
+}
+
+// issueClientSecret generates a non-expiring secret for client, storing its
+// hash and returning the plaintext once in info
+func issueClientSecret(client *OIDCClient, info *ClientInformation) error {
+	secret := generateRandomString(registrationSecretLength)
+	hash, err := HashClientSecret(secret)
+	if err != nil {
+		return NewOAuthError(ErrCodeServerError, "%v", err)
+	}
+	client.ClientSecretHash = hash
+	info.ClientSecret = secret
+	neverExpires := int64(0)
+	info.ClientSecretExpiresAt = &neverExpires
+	return nil
+}
+
+// validRegistrationToken reports whether token is a configured initial
+// access token. Callers must hold p.mu.
+func (p *OIDCProvider) validRegistrationToken(token string) bool {
+	digest := sha256.Sum256([]byte(token))
+	valid := false
+	for _, t := range p.registrationTokens {
+		if subtle.ConstantTimeCompare(t[:], digest[:]) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// authorizeRegistration checks a registration access token. Unknown clients
+// and bad tokens are indistinguishable. Callers must hold p.mu.
+func (p *OIDCProvider) authorizeRegistration(clientID, token string) (*OIDCClient, error) {
+	client, err := p.storage.GetClient(clientID)
+	if err != nil || client.RegistrationTokenHash == "" || !VerifyClientSecret(client.RegistrationTokenHash, token) {
+		return nil, NewOAuthError(ErrCodeInvalidToken, "invalid registration access token")
+	}
+	return client, nil
+}
+
+// applyClientMetadata validates metadata, after merging in any software
+// statement, and copies it onto client. Callers must hold p.mu.
+func (p *OIDCProvider) applyClientMetadata(client *OIDCClient, metadata *ClientMetadata) error {
+	if metadata == nil {
+		return NewOAuthError(ErrCodeInvalidClientMetadata, "client metadata is required")
+	}
+	md := *metadata
+
+	var statement map[string]json.RawMessage
+	if md.SoftwareStatement != "" {
+		var err error
+		if statement, err = p.applySoftwareStatement(&md); err != nil {
+			return err
+		}
+	}
+
+	if md.TokenEndpointAuthMethod == "" {
+		md.TokenEndpointAuthMethod = defaultRegistrationAuthMethod
+	}
+	if len(md.GrantTypes) == 0 {
+		md.GrantTypes = []string{defaultRegistrationGrantType}
+	}
+	if len(md.ResponseTypes) == 0 && slices.Contains(md.GrantTypes, "authorization_code") {
+		md.ResponseTypes = []string{defaultRegistrationResponseType}
+	}
+
+	// Authentication method and keys
+	switch md.TokenEndpointAuthMethod {
+	case AuthMethodClientSecretBasic, AuthMethodClientSecretPost, AuthMethodNone:
+	case AuthMethodPrivateKeyJWT:
+		if md.JWKS == nil || len(md.JWKS.Keys) == 0 {
+			return NewOAuthError(ErrCodeInvalidClientMetadata, "private_key_jwt requires jwks")
+		}
+	default:
+		return NewOAuthError(ErrCodeInvalidClientMetadata, "unsupported token_endpoint_auth_method %q", md.TokenEndpointAuthMethod)
+	}
+	if md.JWKSURI != "" {
+		return NewOAuthError(ErrCodeInvalidClientMetadata, "jwks_uri is not supported; register keys with jwks")
+	}
+	if md.JWKS != nil {
+		for i, jwk := range md.JWKS.Keys {
+			if _, err := publicKeyFromJWK(jwk); err != nil {
+				return NewOAuthError(ErrCodeInvalidClientMetadata, "jwks key %d: %v", i, err)
+			}
+			if d, ok := jwk["d"]; ok && d != nil {
+				return NewOAuthError(ErrCodeInvalidClientMetadata, "jwks key %d contains private key material", i)
+			}
+		}
+	}
+
+	// Grant and response types must agree (RFC 7591 section 2.1)
+	for _, gt := range md.GrantTypes {
+		if !slices.Contains(registrableGrantTypes, gt) {
+			return NewOAuthError(ErrCodeInvalidClientMetadata, "unsupported grant_type %q", gt)
+		}
+	}
+	for _, gt := range privilegedGrantTypes {
+		if !slices.Contains(md.GrantTypes, gt) {
+			continue
+		}
+		if md.TokenEndpointAuthMethod == AuthMethodNone {
+			return NewOAuthError(ErrCodeInvalidClientMetadata, "%s requires a confidential client", gt)
+		}
+		if statement["grant_types"] == nil {
+			return NewOAuthError(ErrCodeInvalidClientMetadata, "%s must be granted by a trusted software_statement", gt)
+		}
+		if statement["resources"] == nil || len(md.Resources) == 0 {
+			return NewOAuthError(ErrCodeInvalidClientMetadata, "%s requires resources from the software_statement", gt)
+		}
+	}
+	for _, resource := range md.Resources {
+		if u, err := url.Parse(resource); err != nil || !u.IsAbs() || u.Fragment != "" {
+			return NewOAuthError(ErrCodeInvalidClientMetadata, "resource %q must be an absolute URI without a fragment", resource)
+		}
+	}
+	for _, rt := range md.ResponseTypes {
+		for _, part := range strings.Fields(rt) {
+			switch part {
+			case "code":
+				if !slices.Contains(md.GrantTypes, "authorization_code") {
+					return NewOAuthError(ErrCodeInvalidClientMetadata, "response_type %q requires the authorization_code grant", rt)
+				}
+			case "token", "id_token":
+				if !slices.Contains(md.GrantTypes, "implicit") {
+					return NewOAuthError(ErrCodeInvalidClientMetadata, "response_type %q requires the implicit grant", rt)
+				}
+			default:
+				return NewOAuthError(ErrCodeInvalidClientMetadata, "unsupported response_type %q", rt)
+			}
+		}
+	}
+
+	// Redirect URIs are required for redirect-based flows
+	usesRedirects := slices.Contains(md.GrantTypes, "authorization_code") || slices.Contains(md.GrantTypes, "implicit")
+	if usesRedirects && len(md.RedirectURIs) == 0 {
+		return NewOAuthError(ErrCodeInvalidRedirectURI, "redirect_uris is required")
+	}
+	for _, uri := range md.RedirectURIs {
+		if err := validateRedirectURI(uri); err != nil {
+			return err
+		}
+	}
+
+	// ID token signing algorithm; unsecured ID tokens are never issued
+	if md.IDTokenSignedResponseAlg != "" && !jwtManager.SupportsAlgorithm(md.IDTokenSignedResponseAlg) {
+		return NewOAuthError(ErrCodeInvalidClientMetadata, "unsupported id_token_signed_response_alg %q", md.IDTokenSignedResponseAlg)
+	}
+
+	// Scopes
+	scopes := strings.Fields(md.Scope)
+	supported := p.GetDiscovery().ScopesSupported
+	for _, s := range scopes {
+		if !slices.Contains(supported, s) {
+			return NewOAuthError(ErrCodeInvalidClientMetadata, "unsupported scope %q", s)
+		}
+	}
+	if len(scopes) == 0 {
+		scopes = []string{defaultRegistrationScope}
+	}
+
+	client.TokenEndpointAuthMethod = md.TokenEndpointAuthMethod
+	client.RedirectURIs = md.RedirectURIs
+	client.GrantTypes = md.GrantTypes
+	client.ResponseTypes = md.ResponseTypes
+	client.Scopes = scopes
+	client.Name = md.ClientName
+	client.SoftwareID = md.SoftwareID
+	client.SoftwareVersion = md.SoftwareVersion
+	client.SoftwareStatement = md.SoftwareStatement
+	client.IDTokenSignedResponseAlg = md.IDTokenSignedResponseAlg
+	client.Resources = md.Resources
+	client.JWKS = nil
+	if md.JWKS != nil {
+		client.JWKS = md.JWKS.Keys
+	}
+	return nil
+}
+
+// applySoftwareStatement verifies a software statement from a trusted issuer
+// and lets its claims override the plain metadata (RFC 7591 section 2.3).
+// It returns the statement's claims, so callers can tell which metadata the
+// issuer vouched for. Callers must hold p.mu.
+func (p *OIDCProvider) applySoftwareStatement(md *ClientMetadata) (map[string]json.RawMessage, error) {
+	parts := strings.Split(md.SoftwareStatement, ".")
+	if len(parts) != 3 {
+		return nil, NewOAuthError(ErrCodeInvalidSoftwareStatement, "software_statement is not a JWT")
+	}
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, NewOAuthError(ErrCodeInvalidSoftwareStatement, "malformed software_statement header")
+	}
+	var header JWTHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, NewOAuthError(ErrCodeInvalidSoftwareStatement, "malformed software_statement header")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, NewOAuthError(ErrCodeInvalidSoftwareStatement, "malformed software_statement claims")
+	}
+	var claims JWTClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, NewOAuthError(ErrCodeInvalidSoftwareStatement, "malformed software_statement claims")
+	}
+
+	jwk, trusted := p.softwareStatementIssuers[claims.Issuer]
+	if !trusted {
+		return nil, NewOAuthError(ErrCodeUnapprovedSoftwareStatement, "software_statement issuer %q is not trusted", claims.Issuer)
+	}
+	key, err := publicKeyFromJWK(jwk)
+	if err != nil {
+		return nil, NewOAuthError(ErrCodeServerError, "invalid key for software_statement issuer: %v", err)
+	}
+	if err := verifyJWTSignature(header.Alg, key, parts); err != nil {
+		return nil, NewOAuthError(ErrCodeInvalidSoftwareStatement, "invalid software_statement signature")
+	}
+
+	now := time.Now().Unix()
+	if claims.Expiration > 0 && now > claims.Expiration+softwareStatementClockSkew {
+		return nil, NewOAuthError(ErrCodeInvalidSoftwareStatement, "software_statement expired")
+	}
+	if claims.NotBefore > 0 && now+softwareStatementClockSkew < claims.NotBefore {
+		return nil, NewOAuthError(ErrCodeInvalidSoftwareStatement, "software_statement not yet valid")
+	}
+
+	var statement ClientMetadata
+	if err := json.Unmarshal(payload, &statement); err != nil {
+		return nil, NewOAuthError(ErrCodeInvalidSoftwareStatement, "malformed software_statement claims")
+	}
+	var present map[string]json.RawMessage
+	json.Unmarshal(payload, &present)
+
+	if _, ok := present["redirect_uris"]; ok {
+		md.RedirectURIs = statement.RedirectURIs
+	}
+	if _, ok := present["token_endpoint_auth_method"]; ok {
+		md.TokenEndpointAuthMethod = statement.TokenEndpointAuthMethod
+	}
+	if _, ok := present["grant_types"]; ok {
+		md.GrantTypes = statement.GrantTypes
+	}
+	if _, ok := present["response_types"]; ok {
+		md.ResponseTypes = statement.ResponseTypes
+	}
+	if _, ok := present["client_name"]; ok {
+		md.ClientName = statement.ClientName
+	}
+	if _, ok := present["scope"]; ok {
+		md.Scope = statement.Scope
+	}
+	if _, ok := present["jwks"]; ok {
+		md.JWKS = statement.JWKS
+	}
+	if _, ok := present["software_id"]; ok {
+		md.SoftwareID = statement.SoftwareID
+	}
+	if _, ok := present["software_version"]; ok {
+		md.SoftwareVersion = statement.SoftwareVersion
+	}
+	if _, ok := present["id_token_signed_response_alg"]; ok {
+		md.IDTokenSignedResponseAlg = statement.IDTokenSignedResponseAlg
+	}
+	if _, ok := present["resources"]; ok {
+		md.Resources = statement.Resources
+	}
+	return present, nil
+}
+
+// validateRedirectURI requires absolute URIs without fragments. Plain http
+// is only allowed for loopback hosts. Native apps may use private-use
+// schemes in the reverse domain form of RFC 8252 section 7.1, such as
+// com.example.app, which rules out javascript:, data: and file: URIs.
+func validateRedirectURI(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() {
+		return NewOAuthError(ErrCodeInvalidRedirectURI, "redirect_uri %q must be an absolute URI", raw)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" && !reverseDomainScheme(u.Scheme) {
+		return NewOAuthError(ErrCodeInvalidRedirectURI, "redirect_uri %q must use https or a reverse domain private-use scheme", raw)
+	}
+	if u.Fragment != "" || strings.Contains(raw, "#") {
+		return NewOAuthError(ErrCodeInvalidRedirectURI, "redirect_uri %q must not contain a fragment", raw)
+	}
+	if u.Scheme == "http" {
+		switch u.Hostname() {
+		case "localhost", "127.0.0.1", "::1":
+		default:
+			return NewOAuthError(ErrCodeInvalidRedirectURI, "redirect_uri %q must use https", raw)
+		}
+	}
+	if (u.Scheme == "http" || u.Scheme == "https") && u.Host == "" {
+		return NewOAuthError(ErrCodeInvalidRedirectURI, "redirect_uri %q has no host", raw)
+	}
+	return nil
+}
+
+// reverseDomainScheme reports whether scheme is a reverse domain name with
+// at least two labels, such as com.example.app
+func reverseDomainScheme(scheme string) bool {
+	labels := strings.Split(strings.ToLower(scheme), ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if label == "" || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c == '-' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// clientInformation renders a client's registered metadata
+func (p *OIDCProvider) clientInformation(client *OIDCClient) *ClientInformation {
+	info := &ClientInformation{
+		ClientMetadata: ClientMetadata{
+			RedirectURIs:             client.RedirectURIs,
+			TokenEndpointAuthMethod:  client.authMethod(),
+			GrantTypes:               client.GrantTypes,
+			ResponseTypes:            client.ResponseTypes,
+			ClientName:               client.Name,
+			Scope:                    strings.Join(client.Scopes, " "),
+			SoftwareID:               client.SoftwareID,
+			SoftwareVersion:          client.SoftwareVersion,
+			SoftwareStatement:        client.SoftwareStatement,
+			IDTokenSignedResponseAlg: client.IDTokenSignedResponseAlg,
+			Resources:                client.Resources,
+		},
+		ClientID:              client.ClientID,
+		ClientIDIssuedAt:      client.IssuedAt,
+		RegistrationClientURI: p.issuer + "/register/" + client.ClientID,
+	}
+	if len(client.JWKS) > 0 {
+		info.JWKS = &JSONWebKeySet{Keys: client.JWKS}
+	}
+	return info
+}
@@ -0,0 +1,211 @@
+//go:build js && wasm
+// +build js,wasm
+
+package middleware
+
+import (
+	"encoding/base64"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Response modes (OAuth 2.0 Multiple Response Type Encoding Practices and
+// Form Post Response Mode)
+const (
+	ResponseModeQuery    = "query"
+	ResponseModeFragment = "fragment"
+	ResponseModeFormPost = "form_post"
+)
+
+// supportedResponseTypes lists the response types the authorization endpoint
+// implements, in canonical form
+var supportedResponseTypes = []string{
+	"code", "token", "id_token", "code id_token", "code token", "id_token token", "code id_token token",
+}
+
+// supportedResponseModes lists the response modes the authorization
+// endpoint implements
+var supportedResponseModes = []string{ResponseModeQuery, ResponseModeFragment, ResponseModeFormPost}
+
+// FormPostResponse is an authorization response delivered by auto-submitting
+// an HTML form to the client's redirect URI
+type FormPostResponse struct {
+	Action string
+	Params url.Values
+}
+
+// normalizeResponseType returns the canonical form of a response type, whose
+// values may be given in any order
+func normalizeResponseType(responseType string) (string, bool) {
+	parts := strings.Fields(responseType)
+	sort.Strings(parts)
+	normalized := strings.Join(parts, " ")
+	return normalized, slices.Contains(supportedResponseTypes, normalized)
+}
+
+// allowsResponseType reports whether the client registered a response type
+func (c *OIDCClient) allowsResponseType(responseType string) bool {
+	for _, rt := range c.ResponseTypes {
+		if normalized, _ := normalizeResponseType(rt); normalized == responseType {
+			return true
+		}
+	}
+	return false
+}
+
+// hasResponseType reports whether a response type includes value
+func hasResponseType(responseType, value string) bool {
+	return slices.Contains(strings.Fields(responseType), value)
+}
+
+// defaultResponseMode is query for the code flow and fragment for any
+// response type that returns tokens from the authorization endpoint
+func defaultResponseMode(responseType string) string {
+	if strings.TrimSpace(responseType) == "code" || responseType == "" {
+		return ResponseModeQuery
+	}
+	return ResponseModeFragment
+}
+
+// responseMode resolves the mode an authorization response is delivered in,
+// falling back to the default when the requested mode is unusable
+func responseMode(req *AuthorizationRequest) string {
+	if slices.Contains(supportedResponseModes, req.ResponseMode) {
+		if req.ResponseMode != ResponseModeQuery || defaultResponseMode(req.ResponseType) == ResponseModeQuery {
+			return req.ResponseMode
+		}
+	}
+	return defaultResponseMode(req.ResponseType)
+}
+
+// validateResponseMode rejects unknown modes and query delivery of tokens,
+// which would leak them into logs and referrers
+func validateResponseMode(req *AuthorizationRequest) *OAuthError {
+	if req.ResponseMode == "" {
+		return nil
+	}
+	if !slices.Contains(supportedResponseModes, req.ResponseMode) {
+		return NewOAuthError(ErrCodeInvalidRequest, "unsupported response_mode %q", req.ResponseMode)
+	}
+	if req.ResponseMode == ResponseModeQuery && defaultResponseMode(req.ResponseType) != ResponseModeQuery {
+		return NewOAuthError(ErrCodeInvalidRequest, "response_type %q cannot use the query response mode", req.ResponseType)
+	}
+	// The form_post page only submits to web URLs
+	if req.ResponseMode == ResponseModeFormPost && !strings.HasPrefix(req.RedirectURI, "https:") && !strings.HasPrefix(req.RedirectURI, "http:") {
+		return NewOAuthError(ErrCodeInvalidRequest, "form_post requires an http or https redirect_uri")
+	}
+	return nil
+}
+
+// respond delivers authorization response parameters to a redirect URI in
+// the given mode
+func respond(redirectURI, mode string, params url.Values) *AuthorizationOutcome {
+	switch mode {
+	case ResponseModeFormPost:
+		return &AuthorizationOutcome{FormPost: &FormPostResponse{Action: redirectURI, Params: params}}
+	case ResponseModeFragment:
+		u, err := url.Parse(redirectURI)
+		if err != nil {
+			return &AuthorizationOutcome{RedirectURL: redirectURI}
+		}
+		u.Fragment = ""
+		return &AuthorizationOutcome{RedirectURL: u.String() + "#" + params.Encode()}
+	default:
+		return &AuthorizationOutcome{RedirectURL: appendQuery(redirectURI, params)}
+	}
+}
+
+// issueFrontChannelTokens mints the access token and ID token returned
+// directly from the authorization endpoint by the implicit and hybrid flows.
+// No refresh token is issued; the tokens still belong to a refresh token
+// family so that revoking the user's consent revokes them. Callers must hold
+// p.mu.
+func (p *OIDCProvider) issueFrontChannelTokens(req *AuthorizationRequest, auth *AuthResult, code string, params url.Values) *OAuthError {
+	now := time.Now()
+	family := &RefreshFamily{
+		ID:        generateRandomString(32),
+		ClientID:  req.ClientID,
+		UserID:    auth.UserID,
+		AuthTime:  auth.AuthTime,
+		AMR:       auth.AMR,
+		ExpiresAt: now.Add(accessTokenTTL),
+	}
+
+	var accessToken string
+	if hasResponseType(req.ResponseType, "token") {
+		token, err := jwtManager.GenerateAccessToken(auth.UserID, req.Scope)
+		if err != nil {
+			return NewOAuthError(ErrCodeServerError, "failed to generate access token: %v", err)
+		}
+		accessToken = token
+	}
+
+	var idToken string
+	if hasResponseType(req.ResponseType, "id_token") {
+		alg := p.idTokenAlg(req.ClientID)
+		extra := authenticationClaims(auth.AuthTime, auth.AMR)
+		p.emailClaims(auth.UserID, req.Scope, extra)
+		if accessToken != "" {
+			extra["at_hash"] = leftHalfHash(alg, accessToken)
+		}
+		if code != "" {
+			extra["c_hash"] = leftHalfHash(alg, code)
+		}
+		token, err := jwtManager.GenerateIDToken(alg, auth.UserID, req.ClientID, req.Nonce, extra)
+		if err != nil {
+			return NewOAuthError(ErrCodeServerError, "failed to generate ID token: %v", err)
+		}
+		idToken = token
+	}
+
+	if accessToken != "" {
+		if err := p.storage.SaveRefreshFamily(family); err != nil {
+			return NewOAuthError(ErrCodeServerError, "failed to store token family: %v", err)
+		}
+		if err := p.recordConsentFamily(auth.UserID, req.ClientID, family.ID); err != nil {
+			return NewOAuthError(ErrCodeServerError, "failed to record token family: %v", err)
+		}
+		if err := p.storage.SaveAccessToken(&AccessToken{
+			Token:     accessToken,
+			ClientID:  req.ClientID,
+			UserID:    auth.UserID,
+			Scope:     req.Scope,
+			FamilyID:  family.ID,
+			ExpiresAt: now.Add(accessTokenTTL),
+		}); err != nil {
+			return NewOAuthError(ErrCodeServerError, "failed to store access token: %v", err)
+		}
+
+		params.Set("access_token", accessToken)
+		params.Set("token_type", "Bearer")
+		params.Set("expires_in", strconv.Itoa(int(accessTokenTTL.Seconds())))
+		if req.Scope != "" {
+			params.Set("scope", req.Scope)
+		}
+	}
+	if idToken != "" {
+		params.Set("id_token", idToken)
+	}
+	return nil
+}
+
+// leftHalfHash computes the at_hash and c_hash ID token claims: the
+// base64url left-most half of the hash of the value, using the hash of the
+// ID token's signing algorithm
+func leftHalfHash(alg, value string) string {
+	sum := signingAlgorithms[alg].hash([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
+
+// idTokenAlg returns the algorithm the client's ID tokens are signed with.
+// Callers must hold p.mu.
+func (p *OIDCProvider) idTokenAlg(clientID string) string {
+	if client, err := p.storage.GetClient(clientID); err == nil && client.IDTokenSignedResponseAlg != "" {
+		return client.IDTokenSignedResponseAlg
+	}
+	return jwtManager.defaultAlgorithm()
+}
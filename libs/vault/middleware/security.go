@@ -81,6 +81,16 @@ func (rl *RateLimiter) Allow(identifier string) bool {
 	return true
 }
 
+// Exceeded reports whether identifier has used up its limit in the current
+// window, without counting a request
+func (rl *RateLimiter) Exceeded(identifier string) bool {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+
+	counter, exists := rl.requests[identifier]
+	return exists && time.Now().Before(counter.ResetTime) && counter.Count >= rl.limit
+}
+
 // SecurityMiddleware wraps handlers with security features
 func SecurityMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -130,6 +140,11 @@ func getClientIdentifier(r *http.Request) string {
 	// In WASM environment, we can't rely on real IP
 	// Use a combination of headers for identification
 
+	// Cloudflare sets the connecting IP, which clients cannot forge
+	if ip := r.Header.Get("CF-Connecting-IP"); ip != "" {
+		return ip
+	}
+
 	// Try X-Forwarded-For
 	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
 		return xff
@@ -0,0 +1,408 @@
+//go:build js && wasm
+// +build js,wasm
+
+package middleware
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"golang.org/x/crypto/sha3"
+)
+
+// AuthenticatorSIWE is the sign-in with Ethereum / CAIP-122 method
+const AuthenticatorSIWE = "siwe"
+
+// Account namespaces accepted in sign-in messages
+const (
+	// SIWENamespaceEthereum is EIP-4361: a 0x address and a 65-byte
+	// EIP-191 personal_sign signature
+	SIWENamespaceEthereum = "Ethereum"
+	// SIWENamespaceSonr is CAIP-122 signed by a Motor enclave: a sonr1
+	// address and a 64-byte MPC signature over the SHA3-256 of the message
+	SIWENamespaceSonr = "Sonr"
+)
+
+// siweClockSkew tolerates sign-in messages issued slightly in the future
+const siweClockSkew = 5 * time.Minute
+
+// SIWEMessage is a parsed EIP-4361 / CAIP-122 sign-in message
+type SIWEMessage struct {
+	Domain         string
+	Namespace      string
+	Address        string
+	Statement      string
+	URI            string
+	Version        string
+	ChainID        string
+	Nonce          string
+	IssuedAt       time.Time
+	ExpirationTime time.Time
+	NotBefore      time.Time
+	RequestID      string
+	Resources      []string
+}
+
+// SIWEAuthenticator verifies a signed sign-in message whose nonce is the
+// interaction challenge. The message and its hex signature are posted as the
+// form fields message and signature; Sonr messages also carry the signer's
+// public_key. The authenticated user is the did:pkh DID of an Ethereum
+// account, or the Motor DID of a Sonr account's key.
+type SIWEAuthenticator struct {
+	Domain  string
+	Origins []string
+}
+
+// NewSIWEAuthenticator creates a sign-in message authenticator for the
+// domain users sign in to and the origins allowed as the message URI
+func NewSIWEAuthenticator(domain string, origins []string) *SIWEAuthenticator {
+	return &SIWEAuthenticator{Domain: domain, Origins: origins}
+}
+
+func (a *SIWEAuthenticator) Method() string {
+	return AuthenticatorSIWE
+}
+
+func (a *SIWEAuthenticator) Authenticate(r *http.Request, interaction *Interaction, storage OIDCStorage) (*AuthResult, error) {
+	if r.FormValue("message") == "" {
+		return nil, ErrNoCredentials
+	}
+
+	msg, err := ParseSIWEMessage(r.FormValue("message"))
+	if err != nil {
+		return nil, err
+	}
+	if err := a.validate(msg, interaction); err != nil {
+		return nil, err
+	}
+
+	signature, err := decodeHex(r.FormValue("signature"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature encoding")
+	}
+
+	var pub *secp256k1.PublicKey
+	switch msg.Namespace {
+	case SIWENamespaceEthereum:
+		pub, err = verifyEthereumSignature(msg, r.FormValue("message"), signature)
+	case SIWENamespaceSonr:
+		pub, err = verifySonrSignature(msg, r.FormValue("message"), signature, r.FormValue("public_key"))
+	default:
+		err = fmt.Errorf("unsupported account namespace %q", msg.Namespace)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	did := motorDID(pub)
+	if msg.Namespace == SIWENamespaceEthereum {
+		did = ethereumDID(msg.ChainID, msg.Address)
+	}
+	if err := ensureUser(storage, did, msg.Address); err != nil {
+		return nil, err
+	}
+
+	return &AuthResult{
+		UserID:   did,
+		AuthTime: time.Now(),
+		AMR:      []string{"swk"},
+	}, nil
+}
+
+// validate checks the message is bound to this provider, this interaction
+// and the current time
+func (a *SIWEAuthenticator) validate(msg *SIWEMessage, interaction *Interaction) error {
+	if msg.Domain != a.Domain {
+		return fmt.Errorf("message is for domain %q", msg.Domain)
+	}
+	u, err := url.Parse(msg.URI)
+	if err != nil || !slices.Contains(a.Origins, u.Scheme+"://"+u.Host) {
+		return fmt.Errorf("uri %q is not allowed", msg.URI)
+	}
+	if msg.Version != "1" {
+		return fmt.Errorf("unsupported message version %q", msg.Version)
+	}
+	if !validChainID(msg.Namespace, msg.ChainID) {
+		return fmt.Errorf("invalid chain id %q", msg.ChainID)
+	}
+	if msg.Nonce != interaction.Challenge {
+		return fmt.Errorf("nonce mismatch")
+	}
+
+	now := time.Now()
+	if msg.IssuedAt.After(now.Add(siweClockSkew)) {
+		return fmt.Errorf("message issued in the future")
+	}
+	if !msg.ExpirationTime.IsZero() && now.After(msg.ExpirationTime) {
+		return fmt.Errorf("message expired")
+	}
+	if !msg.NotBefore.IsZero() && now.Before(msg.NotBefore) {
+		return fmt.Errorf("message not yet valid")
+	}
+	return nil
+}
+
+// verifyEthereumSignature recovers the key behind an EIP-191 personal_sign
+// signature and checks it controls the message address
+func verifyEthereumSignature(msg *SIWEMessage, raw string, signature []byte) (*secp256k1.PublicKey, error) {
+	if len(signature) != 65 {
+		return nil, fmt.Errorf("signature must be 65 bytes")
+	}
+	if !validEIP55(msg.Address) {
+		return nil, fmt.Errorf("address %q is not EIP-55 checksummed", msg.Address)
+	}
+
+	// r || s || v, with v as 0/1 or 27/28, becomes the compact form v || r || s
+	v := signature[64]
+	if v >= 27 {
+		v -= 27
+	}
+	if v > 1 {
+		return nil, fmt.Errorf("invalid signature recovery id")
+	}
+	compact := append([]byte{27 + v}, signature[:64]...)
+
+	prefixed := "\x19Ethereum Signed Message:\n" + strconv.Itoa(len(raw)) + raw
+	digest := keccak256([]byte(prefixed))
+	pub, _, err := ecdsa.RecoverCompact(compact, digest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature")
+	}
+	if !strings.EqualFold(ethereumAddress(pub), msg.Address) {
+		return nil, fmt.Errorf("signature does not match address")
+	}
+	return pub, nil
+}
+
+// verifySonrSignature checks an enclave MPC signature (r || s over the
+// SHA3-256 of the message) against the supplied key, which must derive the
+// message address
+func verifySonrSignature(msg *SIWEMessage, raw string, signature []byte, publicKey string) (*secp256k1.PublicKey, error) {
+	if len(signature) != 64 {
+		return nil, fmt.Errorf("signature must be 64 bytes")
+	}
+	keyBytes, err := decodeHex(publicKey)
+	if err != nil || len(keyBytes) == 0 {
+		return nil, fmt.Errorf("public_key is required for %s accounts", SIWENamespaceSonr)
+	}
+	pub, err := secp256k1.ParsePubKey(keyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public_key")
+	}
+	if motorAddress(pub) != msg.Address {
+		return nil, fmt.Errorf("public_key does not match address")
+	}
+
+	var r, s secp256k1.ModNScalar
+	if r.SetByteSlice(signature[:32]) || s.SetByteSlice(signature[32:]) {
+		return nil, fmt.Errorf("invalid signature")
+	}
+	digest := sha3.Sum256([]byte(raw))
+	if !ecdsa.NewSignature(&r, &s).Verify(digest[:], pub) {
+		return nil, fmt.Errorf("invalid signature")
+	}
+	return pub, nil
+}
+
+// ParseSIWEMessage parses the EIP-4361 / CAIP-122 message format:
+//
+//	${domain} wants you to sign in with your ${namespace} account:
+//	${address}
+//
+//	${statement}
+//
+//	URI: ${uri}
+//	Version: ${version}
+//	Chain ID: ${chain-id}
+//	Nonce: ${nonce}
+//	Issued At: ${issued-at}
+//	Expiration Time: ${expiration-time}
+//	Not Before: ${not-before}
+//	Request ID: ${request-id}
+//	Resources:
+//	- ${resources[0]}
+//
+// The statement, expiration, not-before, request ID and resources are optional.
+func ParseSIWEMessage(message string) (*SIWEMessage, error) {
+	lines := strings.Split(message, "\n")
+	if len(lines) < 4 {
+		return nil, fmt.Errorf("malformed sign-in message")
+	}
+
+	header, ok := strings.CutSuffix(lines[0], " account:")
+	if !ok {
+		return nil, fmt.Errorf("malformed sign-in message header")
+	}
+	domain, namespace, ok := strings.Cut(header, " wants you to sign in with your ")
+	if !ok || domain == "" || namespace == "" {
+		return nil, fmt.Errorf("malformed sign-in message header")
+	}
+	msg := &SIWEMessage{Domain: domain, Namespace: namespace, Address: lines[1]}
+	if msg.Address == "" || lines[2] != "" {
+		return nil, fmt.Errorf("malformed sign-in message address")
+	}
+
+	rest := lines[3:]
+	if !strings.HasPrefix(rest[0], "URI: ") {
+		if len(rest) < 2 || rest[1] != "" {
+			return nil, fmt.Errorf("malformed sign-in message statement")
+		}
+		msg.Statement = rest[0]
+		rest = rest[2:]
+	}
+
+	parseTime := func(field, v string) (time.Time, error) {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid %s", field)
+		}
+		return t, nil
+	}
+
+	var err error
+	for i := 0; i < len(rest); i++ {
+		line := rest[i]
+		if line == "Resources:" {
+			for _, res := range rest[i+1:] {
+				r, ok := strings.CutPrefix(res, "- ")
+				if !ok {
+					return nil, fmt.Errorf("malformed sign-in message resources")
+				}
+				msg.Resources = append(msg.Resources, r)
+			}
+			break
+		}
+
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			return nil, fmt.Errorf("malformed sign-in message line %q", line)
+		}
+		switch key {
+		case "URI":
+			msg.URI = value
+		case "Version":
+			msg.Version = value
+		case "Chain ID":
+			msg.ChainID = value
+		case "Nonce":
+			msg.Nonce = value
+		case "Issued At":
+			msg.IssuedAt, err = parseTime("issued-at", value)
+		case "Expiration Time":
+			msg.ExpirationTime, err = parseTime("expiration-time", value)
+		case "Not Before":
+			msg.NotBefore, err = parseTime("not-before", value)
+		case "Request ID":
+			msg.RequestID = value
+		default:
+			return nil, fmt.Errorf("unknown sign-in message field %q", key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if msg.URI == "" || msg.Version == "" || msg.ChainID == "" || msg.Nonce == "" || msg.IssuedAt.IsZero() {
+		return nil, fmt.Errorf("sign-in message is missing required fields")
+	}
+	return msg, nil
+}
+
+// motorAddress derives the address the enclave assigns to a key
+func motorAddress(pub *secp256k1.PublicKey) string {
+	return fmt.Sprintf("sonr1%x", pub.SerializeUncompressed()[:20])
+}
+
+// motorDID derives the enclave DID of a key, which is the OIDC subject for
+// users signing in with it
+func motorDID(pub *secp256k1.PublicKey) string {
+	return "did:sonr:" + motorAddress(pub)
+}
+
+// ethereumDID returns the did:pkh DID of an Ethereum account on an EIP-155
+// chain, the OIDC subject for users signing in with it. The same address
+// signing in on another chain is a different subject.
+func ethereumDID(chainID, address string) string {
+	return "did:pkh:eip155:" + chainID + ":" + address
+}
+
+// validChainID checks the chain ID of a sign-in message: a positive EIP-155
+// chain ID for Ethereum accounts, otherwise a CAIP-2 chain reference
+func validChainID(namespace, chainID string) bool {
+	if namespace == SIWENamespaceEthereum {
+		n, err := strconv.ParseUint(chainID, 10, 64)
+		return err == nil && n > 0 && strconv.FormatUint(n, 10) == chainID
+	}
+	if len(chainID) == 0 || len(chainID) > 32 {
+		return false
+	}
+	for _, c := range chainID {
+		if !(c == '-' || c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// ensureUser provisions a user record for a DID on first sight
+func ensureUser(storage OIDCStorage, did, username string) error {
+	if _, err := storage.GetUser(did); errors.Is(err, ErrNotFound) {
+		if err := storage.SaveUser(&User{ID: did, Username: username}); err != nil {
+			return fmt.Errorf("failed to provision user: %w", err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to load user: %w", err)
+	}
+	return nil
+}
+
+// ethereumAddress returns the EIP-55 address of a key
+func ethereumAddress(pub *secp256k1.PublicKey) string {
+	hash := keccak256(pub.SerializeUncompressed()[1:])
+	return eip55("0x" + hex.EncodeToString(hash[12:]))
+}
+
+// eip55 applies mixed-case checksum encoding to a hex address
+func eip55(address string) string {
+	lower := strings.ToLower(strings.TrimPrefix(address, "0x"))
+	hash := hex.EncodeToString(keccak256([]byte(lower)))
+	out := []byte(lower)
+	for i, c := range out {
+		if c >= 'a' && c <= 'f' && hash[i] >= '8' {
+			out[i] = c - 'a' + 'A'
+		}
+	}
+	return "0x" + string(out)
+}
+
+// validEIP55 reports whether address is a checksummed 20-byte hex address
+func validEIP55(address string) bool {
+	raw, ok := strings.CutPrefix(address, "0x")
+	if !ok || len(raw) != 40 {
+		return false
+	}
+	if _, err := hex.DecodeString(raw); err != nil {
+		return false
+	}
+	return eip55(address) == address
+}
+
+func keccak256(data []byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// decodeHex decodes hex with an optional 0x prefix
+func decodeHex(s string) ([]byte, error) {
+	return hex.DecodeString(strings.TrimPrefix(s, "0x"))
+}
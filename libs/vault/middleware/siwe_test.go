@@ -0,0 +1,207 @@
+//go:build js && wasm
+// +build js,wasm
+
+package middleware
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+const testSIWEMessage = `motor.sonr.io wants you to sign in with your Ethereum account:
+0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2
+
+Sign in to Motor
+
+URI: https://motor.sonr.io/login
+Version: 1
+Chain ID: 1
+Nonce: 32891756
+Issued At: 2026-01-01T00:00:00Z
+Expiration Time: 2026-01-01T00:10:00Z
+Not Before: 2026-01-01T00:00:00Z
+Request ID: req-1
+Resources:
+- https://motor.sonr.io/a
+- ipfs://bafy`
+
+func TestParseSIWEMessage(t *testing.T) {
+	minimal := strings.Join([]string{
+		"motor.sonr.io wants you to sign in with your Sonr account:",
+		"sonr1abc",
+		"",
+		"URI: https://motor.sonr.io",
+		"Version: 1",
+		"Chain ID: sonr-testnet-1",
+		"Nonce: abc123",
+		"Issued At: 2026-01-01T00:00:00Z",
+	}, "\n")
+	replace := func(old, new string) string { return strings.Replace(minimal, old, new, 1) }
+
+	tests := []struct {
+		name    string
+		message string
+		check   func(t *testing.T, msg *SIWEMessage)
+		wantErr bool
+	}{
+		{
+			name:    "all fields",
+			message: testSIWEMessage,
+			check: func(t *testing.T, msg *SIWEMessage) {
+				if msg.Domain != "motor.sonr.io" || msg.Namespace != SIWENamespaceEthereum || msg.Address != "0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2" {
+					t.Errorf("header = %q %q %q", msg.Domain, msg.Namespace, msg.Address)
+				}
+				if msg.Statement != "Sign in to Motor" || msg.URI != "https://motor.sonr.io/login" || msg.Version != "1" || msg.ChainID != "1" || msg.Nonce != "32891756" || msg.RequestID != "req-1" {
+					t.Errorf("fields = %+v", msg)
+				}
+				if !msg.ExpirationTime.Equal(time.Date(2026, 1, 1, 0, 10, 0, 0, time.UTC)) || msg.NotBefore.IsZero() {
+					t.Errorf("times = %v %v", msg.ExpirationTime, msg.NotBefore)
+				}
+				if len(msg.Resources) != 2 || msg.Resources[1] != "ipfs://bafy" {
+					t.Errorf("resources = %v", msg.Resources)
+				}
+			},
+		},
+		{
+			name:    "required fields only",
+			message: minimal,
+			check: func(t *testing.T, msg *SIWEMessage) {
+				if msg.Namespace != SIWENamespaceSonr || msg.Statement != "" || !msg.ExpirationTime.IsZero() || msg.Resources != nil {
+					t.Errorf("fields = %+v", msg)
+				}
+			},
+		},
+		{name: "too short", message: "motor.sonr.io wants you to sign in with your Ethereum account:", wantErr: true},
+		{name: "bad header", message: replace("wants you to sign in with your Sonr account:", "asks you to sign in:"), wantErr: true},
+		{name: "empty namespace", message: replace("your Sonr account", "your  account"), wantErr: true},
+		{name: "empty address", message: replace("sonr1abc", ""), wantErr: true},
+		{name: "no blank line after address", message: replace("sonr1abc\n", "sonr1abc\nextra"), wantErr: true},
+		{name: "statement without blank line", message: replace("\nURI:", "\nStatement\nURI:"), wantErr: true},
+		{name: "missing nonce", message: replace("Nonce: abc123\n", ""), wantErr: true},
+		{name: "missing issued at", message: strings.TrimSuffix(minimal, "\nIssued At: 2026-01-01T00:00:00Z"), wantErr: true},
+		{name: "invalid issued at", message: replace("2026-01-01T00:00:00Z", "yesterday"), wantErr: true},
+		{name: "invalid expiration", message: minimal + "\nExpiration Time: soon", wantErr: true},
+		{name: "unknown field", message: minimal + "\nColor: blue", wantErr: true},
+		{name: "malformed line", message: minimal + "\nnot a field", wantErr: true},
+		{name: "malformed resource", message: minimal + "\nResources:\nhttps://motor.sonr.io", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := ParseSIWEMessage(tt.message)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSIWEMessage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.check != nil {
+				tt.check(t, msg)
+			}
+		})
+	}
+}
+
+func TestValidChainID(t *testing.T) {
+	tests := []struct {
+		namespace string
+		chainID   string
+		want      bool
+	}{
+		{SIWENamespaceEthereum, "1", true},
+		{SIWENamespaceEthereum, "8453", true},
+		{SIWENamespaceEthereum, "0", false},
+		{SIWENamespaceEthereum, "01", false},
+		{SIWENamespaceEthereum, "-1", false},
+		{SIWENamespaceEthereum, "mainnet", false},
+		{SIWENamespaceEthereum, "", false},
+		{SIWENamespaceSonr, "sonr-testnet-1", true},
+		{SIWENamespaceSonr, "sonr_1", true},
+		{SIWENamespaceSonr, "", false},
+		{SIWENamespaceSonr, strings.Repeat("a", 33), false},
+		{SIWENamespaceSonr, "sonr:1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.namespace+"/"+tt.chainID, func(t *testing.T) {
+			if got := validChainID(tt.namespace, tt.chainID); got != tt.want {
+				t.Errorf("validChainID(%q, %q) = %v, want %v", tt.namespace, tt.chainID, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEIP55(t *testing.T) {
+	// Test vectors from EIP-55
+	for _, address := range []string{
+		"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+		"0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359",
+		"0xdbF03B407c01E7cD3CBea99509d93f8DDDC8C6FB",
+		"0xD1220A0cf47c7B9Be7A2E6BA89F429762e7b9aDb",
+	} {
+		if got := eip55(strings.ToLower(address)); got != address {
+			t.Errorf("eip55(%s) = %s", strings.ToLower(address), got)
+		}
+		if !validEIP55(address) {
+			t.Errorf("validEIP55(%s) = false", address)
+		}
+		if validEIP55(strings.ToLower(address)) {
+			t.Errorf("validEIP55(%s) = true for an unchecksummed address", strings.ToLower(address))
+		}
+	}
+}
+
+// signPersonal returns an EIP-191 personal_sign signature, r || s || v with
+// v as 27/28
+func signPersonal(key *secp256k1.PrivateKey, message string) []byte {
+	digest := keccak256([]byte("\x19Ethereum Signed Message:\n" + strconv.Itoa(len(message)) + message))
+	compact := ecdsa.SignCompact(key, digest, false)
+	return append(compact[1:], compact[0])
+}
+
+func TestVerifyEthereumSignature(t *testing.T) {
+	key, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := ethereumAddress(key.PubKey())
+	raw := "motor.sonr.io wants you to sign in with your Ethereum account:\n" + address
+	signature := signPersonal(key, raw)
+
+	withV := func(v byte) []byte {
+		sig := append([]byte(nil), signature...)
+		sig[64] = v
+		return sig
+	}
+
+	tests := []struct {
+		name      string
+		address   string
+		raw       string
+		signature []byte
+		wantErr   bool
+	}{
+		{"v as 27/28", address, raw, signature, false},
+		{"v as 0/1", address, raw, withV(signature[64] - 27), false},
+		{"invalid recovery id", address, raw, withV(29), true},
+		{"signature too short", address, raw, signature[:64], true},
+		{"unchecksummed address", strings.ToLower(address), raw, signature, true},
+		{"other signer", address, raw, signPersonal(other, raw), true},
+		{"tampered message", address, raw + " ", signature, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub, err := verifyEthereumSignature(&SIWEMessage{Address: tt.address}, tt.raw, tt.signature)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifyEthereumSignature() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !pub.IsEqual(key.PubKey()) {
+				t.Errorf("verifyEthereumSignature() recovered the wrong key")
+			}
+		})
+	}
+}
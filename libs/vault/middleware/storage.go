@@ -0,0 +1,594 @@
+//go:build js && wasm
+// +build js,wasm
+
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"syscall/js"
+	"time"
+
+	promise "github.com/nlepage/go-js-promise"
+)
+
+// ErrNotFound is returned by storage lookups for missing or expired entries
+var ErrNotFound = errors.New("not found")
+
+// OIDCStorage persists the provider's codes, tokens, clients and users.
+// Expired entries are never returned.
+type OIDCStorage interface {
+	SaveAuthCode(code *AuthorizationCode) error
+	GetAuthCode(code string) (*AuthorizationCode, error)
+	DeleteAuthCode(code string) error
+
+	SaveAccessToken(token *AccessToken) error
+	GetAccessToken(token string) (*AccessToken, error)
+	DeleteAccessToken(token string) error
+
+	SaveRefreshToken(token *RefreshToken) error
+	GetRefreshToken(token string) (*RefreshToken, error)
+	DeleteRefreshToken(token string) error
+
+	SaveRefreshFamily(family *RefreshFamily) error
+	GetRefreshFamily(familyID string) (*RefreshFamily, error)
+
+	SaveClient(client *OIDCClient) error
+	GetClient(clientID string) (*OIDCClient, error)
+	DeleteClient(clientID string) error
+
+	SaveUser(user *User) error
+	GetUser(userID string) (*User, error)
+
+	SaveInteraction(interaction *Interaction) error
+	GetInteraction(id string) (*Interaction, error)
+	DeleteInteraction(id string) error
+
+	SaveLoginSession(session *LoginSession) error
+	GetLoginSession(id string) (*LoginSession, error)
+	DeleteLoginSession(id string) error
+
+	SaveConsent(consent *Consent) error
+	GetConsent(userID, clientID string) (*Consent, error)
+	ListConsents(userID string) ([]*Consent, error)
+	DeleteConsent(userID, clientID string) error
+
+	SaveDeviceAuthorization(auth *DeviceAuthorization) error
+	GetDeviceAuthorization(deviceCode string) (*DeviceAuthorization, error)
+	GetDeviceAuthorizationByUserCode(userCode string) (*DeviceAuthorization, error)
+	DeleteDeviceAuthorization(deviceCode string) error
+
+	SigningKeyStore
+
+	// UseAssertionID records a client assertion ID until expiresAt,
+	// reporting false if it was already recorded
+	UseAssertionID(id string, expiresAt time.Time) (bool, error)
+}
+
+// KVBackend is a byte-oriented key-value store. expiresAt is a hint for
+// backends with native expiry; a zero time means the entry never expires.
+type KVBackend interface {
+	Get(key string) ([]byte, error)
+	Put(key string, value []byte, expiresAt time.Time) error
+	Delete(key string) error
+	List(prefix string) ([]string, error)
+}
+
+// Storage key prefixes
+const (
+	prefixAuthCode     = "oidc:code:"
+	prefixAccessToken  = "oidc:access:"
+	prefixRefreshToken = "oidc:refresh:"
+	prefixFamily       = "oidc:family:"
+	prefixClient       = "oidc:client:"
+	prefixUser         = "oidc:user:"
+	prefixAssertion    = "oidc:assertion:"
+	prefixInteraction  = "oidc:interaction:"
+	prefixSession      = "oidc:session:"
+	prefixConsent      = "oidc:consent:"
+	prefixDevice       = "oidc:device:"
+	prefixUserCode     = "oidc:usercode:"
+	prefixSigningKey   = "oidc:signingkey:"
+)
+
+// storedRecord wraps a JSON-encoded value with its expiry so backends
+// without native TTL support still hide stale entries
+type storedRecord struct {
+	ExpiresAt int64           `json:"expires_at,omitempty"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// KVStorage implements OIDCStorage on top of a KVBackend
+type KVStorage struct {
+	backend KVBackend
+}
+
+// NewKVStorage creates OIDC storage backed by a key-value store
+func NewKVStorage(backend KVBackend) *KVStorage {
+	return &KVStorage{backend: backend}
+}
+
+// NewMemoryStorage creates OIDC storage held in process memory, sweeping
+// expired entries at most once per sweepInterval
+func NewMemoryStorage(sweepInterval time.Duration) *KVStorage {
+	return NewKVStorage(NewMemoryKV(sweepInterval))
+}
+
+func putRecord(b KVBackend, key string, v interface{}, expiresAt time.Time) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", key, err)
+	}
+
+	rec := storedRecord{Data: data}
+	if !expiresAt.IsZero() {
+		rec.ExpiresAt = expiresAt.Unix()
+	}
+	raw, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", key, err)
+	}
+	return b.Put(key, raw, expiresAt)
+}
+
+func getRecord(b KVBackend, key string, v interface{}) error {
+	raw, err := b.Get(key)
+	if err != nil {
+		return err
+	}
+
+	var rec storedRecord
+	if err := json.Unmarshal(raw, &rec); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", key, err)
+	}
+	if rec.ExpiresAt > 0 && time.Now().Unix() >= rec.ExpiresAt {
+		b.Delete(key)
+		return ErrNotFound
+	}
+	if err := json.Unmarshal(rec.Data, v); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *KVStorage) SaveAuthCode(code *AuthorizationCode) error {
+	return putRecord(s.backend, prefixAuthCode+code.Code, code, code.ExpiresAt)
+}
+
+func (s *KVStorage) GetAuthCode(code string) (*AuthorizationCode, error) {
+	var c AuthorizationCode
+	if err := getRecord(s.backend, prefixAuthCode+code, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (s *KVStorage) DeleteAuthCode(code string) error {
+	return s.backend.Delete(prefixAuthCode + code)
+}
+
+func (s *KVStorage) SaveAccessToken(token *AccessToken) error {
+	return putRecord(s.backend, prefixAccessToken+token.Token, token, token.ExpiresAt)
+}
+
+func (s *KVStorage) GetAccessToken(token string) (*AccessToken, error) {
+	var t AccessToken
+	if err := getRecord(s.backend, prefixAccessToken+token, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (s *KVStorage) DeleteAccessToken(token string) error {
+	return s.backend.Delete(prefixAccessToken + token)
+}
+
+func (s *KVStorage) SaveRefreshToken(token *RefreshToken) error {
+	return putRecord(s.backend, prefixRefreshToken+token.Token, token, token.ExpiresAt)
+}
+
+func (s *KVStorage) GetRefreshToken(token string) (*RefreshToken, error) {
+	var t RefreshToken
+	if err := getRecord(s.backend, prefixRefreshToken+token, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (s *KVStorage) DeleteRefreshToken(token string) error {
+	return s.backend.Delete(prefixRefreshToken + token)
+}
+
+func (s *KVStorage) SaveRefreshFamily(family *RefreshFamily) error {
+	return putRecord(s.backend, prefixFamily+family.ID, family, family.ExpiresAt)
+}
+
+func (s *KVStorage) GetRefreshFamily(familyID string) (*RefreshFamily, error) {
+	var f RefreshFamily
+	if err := getRecord(s.backend, prefixFamily+familyID, &f); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func (s *KVStorage) SaveClient(client *OIDCClient) error {
+	return putRecord(s.backend, prefixClient+client.ClientID, client, time.Time{})
+}
+
+func (s *KVStorage) GetClient(clientID string) (*OIDCClient, error) {
+	var c OIDCClient
+	if err := getRecord(s.backend, prefixClient+clientID, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (s *KVStorage) DeleteClient(clientID string) error {
+	return s.backend.Delete(prefixClient + clientID)
+}
+
+func (s *KVStorage) SaveUser(user *User) error {
+	return putRecord(s.backend, prefixUser+user.ID, user, time.Time{})
+}
+
+func (s *KVStorage) GetUser(userID string) (*User, error) {
+	var u User
+	if err := getRecord(s.backend, prefixUser+userID, &u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (s *KVStorage) SaveInteraction(interaction *Interaction) error {
+	return putRecord(s.backend, prefixInteraction+interaction.ID, interaction, interaction.ExpiresAt)
+}
+
+func (s *KVStorage) GetInteraction(id string) (*Interaction, error) {
+	var i Interaction
+	if err := getRecord(s.backend, prefixInteraction+id, &i); err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+func (s *KVStorage) DeleteInteraction(id string) error {
+	return s.backend.Delete(prefixInteraction + id)
+}
+
+func (s *KVStorage) SaveLoginSession(session *LoginSession) error {
+	return putRecord(s.backend, prefixSession+session.ID, session, session.ExpiresAt)
+}
+
+func (s *KVStorage) GetLoginSession(id string) (*LoginSession, error) {
+	var ls LoginSession
+	if err := getRecord(s.backend, prefixSession+id, &ls); err != nil {
+		return nil, err
+	}
+	return &ls, nil
+}
+
+func (s *KVStorage) DeleteLoginSession(id string) error {
+	return s.backend.Delete(prefixSession + id)
+}
+
+// consentUserPrefix scopes consent keys to a user. IDs are escaped because
+// DIDs contain the ':' separator.
+func consentUserPrefix(userID string) string {
+	return prefixConsent + url.QueryEscape(userID) + ":"
+}
+
+func (s *KVStorage) SaveConsent(consent *Consent) error {
+	return putRecord(s.backend, consentUserPrefix(consent.UserID)+url.QueryEscape(consent.ClientID), consent, time.Time{})
+}
+
+func (s *KVStorage) GetConsent(userID, clientID string) (*Consent, error) {
+	var c Consent
+	if err := getRecord(s.backend, consentUserPrefix(userID)+url.QueryEscape(clientID), &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (s *KVStorage) ListConsents(userID string) ([]*Consent, error) {
+	keys, err := s.backend.List(consentUserPrefix(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	consents := make([]*Consent, 0, len(keys))
+	for _, key := range keys {
+		var c Consent
+		if err := getRecord(s.backend, key, &c); errors.Is(err, ErrNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		consents = append(consents, &c)
+	}
+	return consents, nil
+}
+
+func (s *KVStorage) DeleteConsent(userID, clientID string) error {
+	return s.backend.Delete(consentUserPrefix(userID) + url.QueryEscape(clientID))
+}
+
+// SaveDeviceAuthorization stores the authorization under its device code,
+// indexed by user code. Entries outlive the authorization by deviceCodeGrace
+// so late polls can be told the code expired.
+func (s *KVStorage) SaveDeviceAuthorization(auth *DeviceAuthorization) error {
+	expiresAt := auth.ExpiresAt.Add(deviceCodeGrace)
+	if err := putRecord(s.backend, prefixDevice+auth.DeviceCode, auth, expiresAt); err != nil {
+		return err
+	}
+	return putRecord(s.backend, prefixUserCode+auth.UserCode, auth.DeviceCode, expiresAt)
+}
+
+func (s *KVStorage) GetDeviceAuthorization(deviceCode string) (*DeviceAuthorization, error) {
+	var a DeviceAuthorization
+	if err := getRecord(s.backend, prefixDevice+deviceCode, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (s *KVStorage) GetDeviceAuthorizationByUserCode(userCode string) (*DeviceAuthorization, error) {
+	var deviceCode string
+	if err := getRecord(s.backend, prefixUserCode+userCode, &deviceCode); err != nil {
+		return nil, err
+	}
+	return s.GetDeviceAuthorization(deviceCode)
+}
+
+func (s *KVStorage) DeleteDeviceAuthorization(deviceCode string) error {
+	auth, err := s.GetDeviceAuthorization(deviceCode)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.backend.Delete(prefixUserCode + auth.UserCode); err != nil {
+		return err
+	}
+	return s.backend.Delete(prefixDevice + deviceCode)
+}
+
+// SaveSigningKey stores a generated signing key. Keys hold private key
+// material and never expire on their own; rotation deletes retired keys.
+func (s *KVStorage) SaveSigningKey(key *SigningKey) error {
+	return putRecord(s.backend, prefixSigningKey+key.KID, key, time.Time{})
+}
+
+func (s *KVStorage) ListSigningKeys() ([]*SigningKey, error) {
+	keys, err := s.backend.List(prefixSigningKey)
+	if err != nil {
+		return nil, err
+	}
+
+	signingKeys := make([]*SigningKey, 0, len(keys))
+	for _, key := range keys {
+		var k SigningKey
+		if err := getRecord(s.backend, key, &k); errors.Is(err, ErrNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		signingKeys = append(signingKeys, &k)
+	}
+	return signingKeys, nil
+}
+
+func (s *KVStorage) DeleteSigningKey(kid string) error {
+	return s.backend.Delete(prefixSigningKey + kid)
+}
+
+func (s *KVStorage) UseAssertionID(id string, expiresAt time.Time) (bool, error) {
+	var seen bool
+	err := getRecord(s.backend, prefixAssertion+id, &seen)
+	if err == nil {
+		return false, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return false, err
+	}
+	if err := putRecord(s.backend, prefixAssertion+id, true, expiresAt); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// MemoryKV is an in-process KVBackend that evicts expired entries
+type MemoryKV struct {
+	mu            sync.Mutex
+	entries       map[string]memoryEntry
+	sweepInterval time.Duration
+	lastSweep     time.Time
+}
+
+type memoryEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewMemoryKV creates an in-memory backend. Expired entries are swept on
+// writes once sweepInterval has elapsed since the previous sweep.
+func NewMemoryKV(sweepInterval time.Duration) *MemoryKV {
+	return &MemoryKV{
+		entries:       make(map[string]memoryEntry),
+		sweepInterval: sweepInterval,
+		lastSweep:     time.Now(),
+	}
+}
+
+func (m *MemoryKV) Get(key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		delete(m.entries, key)
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), entry.value...), nil
+}
+
+func (m *MemoryKV) Put(key string, value []byte, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.lastSweep) >= m.sweepInterval {
+		m.sweep(now)
+	}
+	m.entries[key] = memoryEntry{value: append([]byte(nil), value...), expiresAt: expiresAt}
+	return nil
+}
+
+func (m *MemoryKV) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+	return nil
+}
+
+func (m *MemoryKV) List(prefix string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var keys []string
+	for key, entry := range m.entries {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if !entry.expiresAt.IsZero() && now.After(entry.expiresAt) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Sweep removes all expired entries and returns how many were evicted
+func (m *MemoryKV) Sweep() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sweep(time.Now())
+}
+
+func (m *MemoryKV) sweep(now time.Time) int {
+	evicted := 0
+	for key, entry := range m.entries {
+		if !entry.expiresAt.IsZero() && now.After(entry.expiresAt) {
+			delete(m.entries, key)
+			evicted++
+		}
+	}
+	m.lastSweep = now
+	return evicted
+}
+
+// JSKVBackend bridges storage to a JavaScript object, such as a wrapper
+// around a Cloudflare KV namespace or Durable Object storage, exposing:
+//
+//	get(key): Promise<string | null>
+//	put(key, value, expiresAtMs): Promise<void>   // expiresAtMs is 0 for no expiry
+//	delete(key): Promise<void>
+//	list(prefix): Promise<string[]>
+type JSKVBackend struct {
+	bridge js.Value
+}
+
+// NewJSKVBackend wraps a JavaScript storage bridge object
+func NewJSKVBackend(bridge js.Value) *JSKVBackend {
+	return &JSKVBackend{bridge: bridge}
+}
+
+// call invokes a bridge method and waits for its result when it is a promise
+func (b *JSKVBackend) call(method string, args ...interface{}) (js.Value, error) {
+	var result js.Value
+	var callErr error
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				callErr = fmt.Errorf("storage bridge %s failed: %v", method, r)
+			}
+		}()
+		result = b.bridge.Call(method, args...)
+	}()
+	if callErr != nil {
+		return js.Undefined(), callErr
+	}
+
+	if result.Type() == js.TypeObject && result.Get("then").Type() == js.TypeFunction {
+		v, err := promise.Await(result)
+		if err != nil {
+			return js.Undefined(), fmt.Errorf("storage bridge %s failed: %w", method, err)
+		}
+		return v, nil
+	}
+	return result, nil
+}
+
+func (b *JSKVBackend) Get(key string) ([]byte, error) {
+	v, err := b.call("get", key)
+	if err != nil {
+		return nil, err
+	}
+	if v.IsNull() || v.IsUndefined() {
+		return nil, ErrNotFound
+	}
+	return []byte(v.String()), nil
+}
+
+func (b *JSKVBackend) Put(key string, value []byte, expiresAt time.Time) error {
+	var expiresAtMs int64
+	if !expiresAt.IsZero() {
+		expiresAtMs = expiresAt.UnixMilli()
+	}
+	_, err := b.call("put", key, string(value), expiresAtMs)
+	return err
+}
+
+func (b *JSKVBackend) Delete(key string) error {
+	_, err := b.call("delete", key)
+	return err
+}
+
+func (b *JSKVBackend) List(prefix string) ([]string, error) {
+	v, err := b.call("list", prefix)
+	if err != nil {
+		return nil, err
+	}
+	if v.IsNull() || v.IsUndefined() {
+		return nil, nil
+	}
+
+	keys := make([]string, v.Length())
+	for i := range keys {
+		keys[i] = v.Index(i).String()
+	}
+	return keys, nil
+}
+
+// storageBridgeGlobal names the JavaScript global checked for a storage
+// bridge when the provider starts
+const storageBridgeGlobal = "vaultOIDCStorage"
+
+// defaultOIDCStorage uses the host's storage bridge when one is installed,
+// falling back to process memory
+func defaultOIDCStorage() OIDCStorage {
+	if bridge := js.Global().Get(storageBridgeGlobal); bridge.Truthy() {
+		return NewKVStorage(NewJSKVBackend(bridge))
+	}
+	return NewMemoryStorage(time.Minute)
+}
@@ -0,0 +1,240 @@
+//go:build js && wasm
+// +build js,wasm
+
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"slices"
+	"strings"
+	"time"
+)
+
+// GrantTypeTokenExchange is the token exchange grant (RFC 8693)
+const GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+// Token type identifiers (RFC 8693 section 3)
+const (
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	// TokenTypeUCAN identifies a UCAN delegation
+	TokenTypeUCAN = "urn:sonr:params:oauth:token-type:ucan"
+)
+
+// SetScopeCapability sets the UCAN capability that stands for scope in token
+// exchange. Scopes without a configured capability map to the ability
+// "oauth/<scope>" on the issuer URL.
+func (p *OIDCProvider) SetScopeCapability(scope, resource, ability string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.scopeCapabilities == nil {
+		p.scopeCapabilities = make(map[string]UCANCapability)
+	}
+	p.scopeCapabilities[scope] = UCANCapability{Resource: resource, Ability: ability}
+}
+
+// scopeCapability returns the UCAN capability for scope. Callers must hold
+// p.mu.
+func (p *OIDCProvider) scopeCapability(scope string) UCANCapability {
+	if c, ok := p.scopeCapabilities[scope]; ok {
+		return c
+	}
+	return UCANCapability{Resource: p.issuer, Ability: "oauth/" + scope}
+}
+
+// DID returns the provider's did:web DID, the audience of UCANs exchanged
+// for access tokens and the issuer of UCANs minted from them
+func (p *OIDCProvider) DID() string {
+	return didWeb(p.issuer)
+}
+
+// ExchangeToken implements the token exchange grant between enclave UCANs
+// and OAuth access tokens. A UCAN delegated to the provider's DID becomes an
+// access token for the UCAN's root DID, with the scopes whose capabilities
+// it grants. An access token becomes a UCAN delegating its scopes'
+// capabilities to the requested audience DID.
+func (p *OIDCProvider) ExchangeToken(req *TokenRequest) (*TokenResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Authenticate client
+	client, err := p.authenticateClient(req)
+	if err != nil {
+		return nil, err
+	}
+	if client.IsPublic() {
+		return nil, NewOAuthError(ErrCodeUnauthorizedClient, "public clients may not use token exchange")
+	}
+	if !slices.Contains(client.GrantTypes, GrantTypeTokenExchange) {
+		return nil, NewOAuthError(ErrCodeUnauthorizedClient, "client is not allowed to use token exchange")
+	}
+	if req.SubjectToken == "" || req.SubjectTokenType == "" {
+		return nil, NewOAuthError(ErrCodeInvalidRequest, "subject_token and subject_token_type are required")
+	}
+
+	switch {
+	case req.SubjectTokenType == TokenTypeUCAN && (req.RequestedTokenType == "" || req.RequestedTokenType == TokenTypeAccessToken):
+		return p.exchangeUCAN(client, req)
+	case req.SubjectTokenType == TokenTypeAccessToken && req.RequestedTokenType == TokenTypeUCAN:
+		return p.delegateAccessToken(client, req)
+	default:
+		return nil, NewOAuthError(ErrCodeInvalidRequest, "unsupported exchange from %q to %q", req.SubjectTokenType, req.RequestedTokenType)
+	}
+}
+
+// exchangeUCAN issues an access token for a UCAN delegated to the provider.
+// Each UCAN can be exchanged once, and the access token never outlives it.
+// Callers must hold p.mu.
+func (p *OIDCProvider) exchangeUCAN(client *OIDCClient, req *TokenRequest) (*TokenResponse, error) {
+	now := time.Now()
+	ucan, err := VerifyUCAN(req.SubjectToken, now)
+	if err != nil {
+		return nil, NewOAuthError(ErrCodeInvalidGrant, "invalid UCAN: %v", err)
+	}
+	if ucan.Audience != p.DID() {
+		return nil, NewOAuthError(ErrCodeInvalidGrant, "UCAN audience must be %s", p.DID())
+	}
+
+	scope, err := p.ucanScope(client, ucan, req.Scope)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateResources(client, req.Resource); err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256([]byte(req.SubjectToken))
+	fresh, err := p.storage.UseAssertionID("ucan:"+base64.RawURLEncoding.EncodeToString(digest[:]), time.Unix(ucan.ExpiresAt, 0))
+	if err != nil {
+		return nil, NewOAuthError(ErrCodeServerError, "failed to record UCAN: %v", err)
+	}
+	if !fresh {
+		return nil, NewOAuthError(ErrCodeInvalidGrant, "UCAN has already been exchanged")
+	}
+
+	subject := ucan.Root()
+	address := strings.TrimPrefix(subject, "did:sonr:")
+	if err := ensureUser(p.storage, subject, address); err != nil {
+		return nil, NewOAuthError(ErrCodeServerError, "%v", err)
+	}
+
+	expiresAt := now.Add(accessTokenTTL)
+	if ucanExpiry := time.Unix(ucan.ExpiresAt, 0); ucanExpiry.Before(expiresAt) {
+		expiresAt = ucanExpiry
+	}
+	claims := accessTokenClaims(subject, scope, req.Resource)
+	claims.Expiration = expiresAt.Unix()
+	accessToken, err := jwtManager.GenerateToken(claims)
+	if err != nil {
+		return nil, NewOAuthError(ErrCodeServerError, "failed to generate access token: %v", err)
+	}
+	if err := p.storage.SaveAccessToken(&AccessToken{
+		Token:      accessToken,
+		ClientID:   client.ClientID,
+		UserID:     subject,
+		Scope:      scope,
+		Audience:   req.Resource,
+		Delegation: req.SubjectToken,
+		ExpiresAt:  expiresAt,
+	}); err != nil {
+		return nil, NewOAuthError(ErrCodeServerError, "failed to store access token: %v", err)
+	}
+
+	return &TokenResponse{
+		AccessToken:     accessToken,
+		IssuedTokenType: TokenTypeAccessToken,
+		TokenType:       "Bearer",
+		ExpiresIn:       int(time.Until(expiresAt).Seconds()),
+		Scope:           scope,
+	}, nil
+}
+
+// ucanScope returns the requested scopes, each of which the client must be
+// registered for and the UCAN must grant. Without a request, every
+// registered scope the UCAN grants is returned. Callers must hold p.mu.
+func (p *OIDCProvider) ucanScope(client *OIDCClient, ucan *UCAN, requested string) (string, error) {
+	if requested == "" {
+		var scopes []string
+		for _, s := range client.Scopes {
+			if s != "offline_access" && ucan.Grants(p.scopeCapability(s)) {
+				scopes = append(scopes, s)
+			}
+		}
+		if len(scopes) == 0 {
+			return "", NewOAuthError(ErrCodeInvalidScope, "the UCAN grants none of the client's scopes")
+		}
+		return strings.Join(scopes, " "), nil
+	}
+
+	for _, s := range strings.Fields(requested) {
+		if s == "offline_access" {
+			return "", NewOAuthError(ErrCodeInvalidScope, "token exchange does not issue refresh tokens")
+		}
+		if !slices.Contains(client.Scopes, s) {
+			return "", NewOAuthError(ErrCodeInvalidScope, "client is not allowed to request scope %q", s)
+		}
+		if c := p.scopeCapability(s); !ucan.Grants(c) {
+			return "", NewOAuthError(ErrCodeInvalidScope, "the UCAN does not grant %s on %s", c.Ability, c.Resource)
+		}
+	}
+	return strings.Join(strings.Fields(requested), " "), nil
+}
+
+// delegateAccessToken mints a UCAN from the provider to the audience DID
+// delegating the capabilities of the access token's scopes. When the access
+// token was itself exchanged for a UCAN, that UCAN is the new one's proof.
+// Callers must hold p.mu.
+func (p *OIDCProvider) delegateAccessToken(client *OIDCClient, req *TokenRequest) (*TokenResponse, error) {
+	stored, err := p.storage.GetAccessToken(req.SubjectToken)
+	if err != nil || time.Now().After(stored.ExpiresAt) || p.familyRevoked(stored.FamilyID) {
+		return nil, NewOAuthError(ErrCodeInvalidGrant, "invalid access token")
+	}
+	if _, err := jwtManager.ValidateToken(req.SubjectToken); err != nil {
+		return nil, NewOAuthError(ErrCodeInvalidGrant, "invalid access token")
+	}
+	if stored.ClientID != client.ClientID {
+		return nil, NewOAuthError(ErrCodeInvalidGrant, "access token was not issued to this client")
+	}
+	if stored.UserID == "" {
+		return nil, NewOAuthError(ErrCodeInvalidGrant, "access token does not act for a user")
+	}
+	if len(req.Audience) != 1 || !strings.HasPrefix(req.Audience[0], "did:") {
+		return nil, NewOAuthError(ErrCodeInvalidTarget, "exactly one audience DID is required")
+	}
+
+	scope, err := narrowScope(stored.Scope, req.Scope)
+	if err != nil {
+		return nil, err
+	}
+	var attenuations []UCANCapability
+	for _, s := range strings.Fields(scope) {
+		attenuations = append(attenuations, p.scopeCapability(s))
+	}
+
+	claims := JWTClaims{
+		Issuer:     p.DID(),
+		Audience:   req.Audience[0],
+		Expiration: stored.ExpiresAt.Unix(),
+		JWTID:      generateRandomString(16),
+		Extra: map[string]interface{}{
+			"nnc": generateRandomString(16),
+			"att": attenuations,
+			"fct": []map[string]string{{"sub": stored.UserID, "client_id": client.ClientID}},
+		},
+	}
+	if stored.Delegation != "" {
+		claims.Extra["prf"] = []string{stored.Delegation}
+	}
+	ucan, err := jwtManager.GenerateUCAN(claims)
+	if err != nil {
+		return nil, NewOAuthError(ErrCodeServerError, "failed to generate UCAN: %v", err)
+	}
+
+	return &TokenResponse{
+		AccessToken:     ucan,
+		IssuedTokenType: TokenTypeUCAN,
+		TokenType:       "N_A",
+		ExpiresIn:       int(time.Until(stored.ExpiresAt).Seconds()),
+		Scope:           scope,
+	}, nil
+}
@@ -0,0 +1,273 @@
+//go:build js && wasm
+// +build js,wasm
+
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	// UCANVersion is the UCAN spec version of delegations the vault issues
+	UCANVersion = "0.9.0"
+	// UCANAlgMPC is the JWS alg of UCANs minted by a Motor enclave: ECDSA
+	// secp256k1 over the SHA3-256 of the SHA-256 of the signing input
+	UCANAlgMPC = "MPC256"
+	// maxUCANProofDepth bounds recursion when verifying nested proofs
+	maxUCANProofDepth = 16
+)
+
+// UCANCapability is an ability on a resource granted by a UCAN
+type UCANCapability struct {
+	Resource string `json:"with"`
+	Ability  string `json:"can"`
+}
+
+// UCAN is a verified UCAN together with its verified proof chain
+type UCAN struct {
+	Raw          string
+	ID           string
+	Issuer       string
+	Audience     string
+	NotBefore    int64
+	ExpiresAt    int64
+	Capabilities []UCANCapability
+	Proofs       []*UCAN
+}
+
+// ucanClaims are the UCAN 0.9 claims read during verification
+type ucanClaims struct {
+	Issuer       string           `json:"iss"`
+	Audience     string           `json:"aud"`
+	NotBefore    int64            `json:"nbf"`
+	ExpiresAt    int64            `json:"exp"`
+	JWTID        string           `json:"jti"`
+	Attenuations []map[string]any `json:"att"`
+	Proofs       []string         `json:"prf"`
+}
+
+// VerifyUCAN verifies an enclave-minted UCAN and its inline proofs: every
+// signature, every validity window, that each proof was delegated to the
+// issuer of the token it supports, and that no token claims more than its
+// proofs grant. Proofs referenced by CID cannot be resolved outside the
+// enclave and are rejected.
+func VerifyUCAN(raw string, now time.Time) (*UCAN, error) {
+	return verifyUCAN(raw, now, 0)
+}
+
+func verifyUCAN(raw string, now time.Time, depth int) (*UCAN, error) {
+	if depth > maxUCANProofDepth {
+		return nil, fmt.Errorf("proof chain exceeds maximum depth of %d", maxUCANProofDepth)
+	}
+
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid token format")
+	}
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode header: %w", err)
+	}
+	var header JWTHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, fmt.Errorf("failed to parse header: %w", err)
+	}
+	if header.Alg != UCANAlgMPC {
+		return nil, fmt.Errorf("unsupported UCAN algorithm: %s", header.Alg)
+	}
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode claims: %w", err)
+	}
+	var claims ucanClaims
+	if err := json.Unmarshal(claimsJSON, &claims); err != nil {
+		return nil, fmt.Errorf("failed to parse claims: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode signature: %w", err)
+	}
+	if err := verifyMotorSignature(claims.Issuer, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	if claims.Audience == "" {
+		return nil, fmt.Errorf("UCAN has no audience")
+	}
+	if claims.ExpiresAt == 0 {
+		return nil, fmt.Errorf("UCAN has no expiry")
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return nil, fmt.Errorf("UCAN expired")
+	}
+	if claims.NotBefore > 0 && now.Unix() < claims.NotBefore {
+		return nil, fmt.Errorf("UCAN not yet valid")
+	}
+
+	token := &UCAN{
+		Raw:          raw,
+		ID:           claims.JWTID,
+		Issuer:       claims.Issuer,
+		Audience:     claims.Audience,
+		NotBefore:    claims.NotBefore,
+		ExpiresAt:    claims.ExpiresAt,
+		Capabilities: normalizeUCANCapabilities(claims.Attenuations),
+	}
+
+	for i, prf := range claims.Proofs {
+		if strings.Count(prf, ".") != 2 {
+			return nil, fmt.Errorf("proof %d is not an inline UCAN", i)
+		}
+		proof, err := verifyUCAN(prf, now, depth+1)
+		if err != nil {
+			return nil, fmt.Errorf("proof %d: %w", i, err)
+		}
+		if proof.Audience != token.Issuer {
+			return nil, fmt.Errorf("proof %d was delegated to %s, not %s", i, proof.Audience, token.Issuer)
+		}
+		if token.ExpiresAt > proof.ExpiresAt {
+			return nil, fmt.Errorf("UCAN outlives proof %d", i)
+		}
+		token.Proofs = append(token.Proofs, proof)
+	}
+
+	if len(token.Proofs) > 0 {
+		root := token.Proofs[0].Root()
+		var granted []UCANCapability
+		for _, proof := range token.Proofs {
+			if proof.Root() != root {
+				return nil, fmt.Errorf("proofs are rooted in different issuers")
+			}
+			granted = append(granted, proof.Capabilities...)
+		}
+		for _, c := range token.Capabilities {
+			if !c.coveredBy(granted) {
+				return nil, fmt.Errorf("capability %s on %s is not granted by any proof", c.Ability, c.Resource)
+			}
+		}
+	}
+	return token, nil
+}
+
+// Root returns the DID at the root of the delegation chain, which owns the
+// delegated resources
+func (u *UCAN) Root() string {
+	if len(u.Proofs) == 0 {
+		return u.Issuer
+	}
+	return u.Proofs[0].Root()
+}
+
+// Grants reports whether the UCAN delegates c
+func (u *UCAN) Grants(c UCANCapability) bool {
+	return c.coveredBy(u.Capabilities)
+}
+
+// verifyMotorSignature checks an MPC256 signature by recovering the signing
+// key and comparing its address with the did:sonr issuer, so UCANs can be
+// verified without the enclave's public key
+func verifyMotorSignature(issuer, signingInput string, signature []byte) error {
+	address, ok := strings.CutPrefix(issuer, "did:sonr:")
+	if !ok {
+		return fmt.Errorf("UCAN issuer %q is not a did:sonr DID", issuer)
+	}
+	if len(signature) != 64 {
+		return fmt.Errorf("signature must be 64 bytes")
+	}
+
+	inner := sha256.Sum256([]byte(signingInput))
+	digest := sha3.Sum256(inner[:])
+	compact := make([]byte, 65)
+	copy(compact[1:], signature)
+	for code := byte(0); code < 4; code++ {
+		compact[0] = 27 + 4 + code
+		pub, _, err := ecdsa.RecoverCompact(compact, digest[:])
+		if err == nil && motorAddress(pub) == address {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid UCAN signature")
+}
+
+// normalizeUCANCapabilities accepts both UCAN 0.9 {with, can} attenuations
+// and the {resource, actions} shape used by the TypeScript client, dropping
+// entries without a resource or ability
+func normalizeUCANCapabilities(attenuations []map[string]any) []UCANCapability {
+	var caps []UCANCapability
+	for _, m := range attenuations {
+		resource := firstString(m, "with", "resource")
+		if resource == "" {
+			continue
+		}
+		var abilities []string
+		if can := firstString(m, "can", "action", "ability"); can != "" {
+			abilities = append(abilities, can)
+		}
+		if actions, ok := m["actions"].([]any); ok {
+			for _, a := range actions {
+				if s, ok := a.(string); ok && s != "" {
+					abilities = append(abilities, s)
+				}
+			}
+		}
+		for _, ability := range abilities {
+			caps = append(caps, UCANCapability{Resource: resource, Ability: ability})
+		}
+	}
+	return caps
+}
+
+// coveredBy reports whether any of granted delegates c
+func (c UCANCapability) coveredBy(granted []UCANCapability) bool {
+	for _, g := range granted {
+		if patternMatches(g.Resource, c.Resource) && patternMatches(g.Ability, c.Ability) {
+			return true
+		}
+	}
+	return false
+}
+
+// patternMatches reports whether pattern grants value. "*" matches anything,
+// and a trailing "*" matches any value with the preceding prefix.
+func patternMatches(pattern, value string) bool {
+	if pattern == "*" || pattern == value {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(value, prefix)
+	}
+	return false
+}
+
+func firstString(m map[string]any, keys ...string) string {
+	for _, k := range keys {
+		if s, ok := m[k].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// didWeb returns the did:web DID of an https URL (did:web method spec)
+func didWeb(issuer string) string {
+	u, err := url.Parse(issuer)
+	if err != nil {
+		return ""
+	}
+	did := "did:web:" + strings.ReplaceAll(u.Host, ":", "%3A")
+	for _, segment := range strings.Split(strings.Trim(u.Path, "/"), "/") {
+		if segment != "" {
+			did += ":" + segment
+		}
+	}
+	return did
+}
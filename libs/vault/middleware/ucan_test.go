@@ -0,0 +1,208 @@
+//go:build js && wasm
+// +build js,wasm
+
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"golang.org/x/crypto/sha3"
+)
+
+// mintUCAN signs claims as an enclave would: MPC256 over the SHA3-256 of the
+// SHA-256 of the signing input
+func mintUCAN(t *testing.T, key *secp256k1.PrivateKey, alg string, claims map[string]any) string {
+	t.Helper()
+	header, err := json.Marshal(JWTHeader{Alg: alg, Typ: "JWT", UCV: UCANVersion})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	inner := sha256.Sum256([]byte(input))
+	digest := sha3.Sum256(inner[:])
+	sig := ecdsa.Sign(key, digest[:])
+	r, s := sig.R(), sig.S()
+	rb, sb := r.Bytes(), s.Bytes()
+	return input + "." + base64.RawURLEncoding.EncodeToString(append(rb[:], sb[:]...))
+}
+
+func TestVerifyUCAN(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	root, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	delegate, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootDID, delegateDID, otherDID := motorDID(root.PubKey()), motorDID(delegate.PubKey()), motorDID(other.PubKey())
+	exp := now.Add(time.Hour).Unix()
+
+	claims := func(iss, aud string, exp int64, att []map[string]any, prf ...string) map[string]any {
+		c := map[string]any{"iss": iss, "aud": aud, "exp": exp, "att": att}
+		if len(prf) > 0 {
+			c["prf"] = prf
+		}
+		return c
+	}
+	vaultAll := []map[string]any{{"with": "vault://alice/*", "can": "*"}}
+	vaultRead := []map[string]any{{"with": "vault://alice/docs", "can": "read"}}
+
+	proof := mintUCAN(t, root, UCANAlgMPC, claims(rootDID, delegateDID, exp, vaultAll))
+	narrowProof := mintUCAN(t, root, UCANAlgMPC, claims(rootDID, delegateDID, exp, vaultRead))
+	otherRoot := mintUCAN(t, other, UCANAlgMPC, claims(otherDID, delegateDID, exp, vaultAll))
+
+	tests := []struct {
+		name     string
+		token    string
+		wantRoot string
+		wantErr  bool
+	}{
+		{
+			name:     "root token",
+			token:    proof,
+			wantRoot: rootDID,
+		},
+		{
+			name:     "attenuated delegation",
+			token:    mintUCAN(t, delegate, UCANAlgMPC, claims(delegateDID, "did:web:app", exp, vaultRead, proof)),
+			wantRoot: rootDID,
+		},
+		{
+			name:     "resource and actions shape",
+			token:    mintUCAN(t, delegate, UCANAlgMPC, claims(delegateDID, "did:web:app", exp, []map[string]any{{"resource": "vault://alice/docs", "actions": []any{"read", "write"}}}, proof)),
+			wantRoot: rootDID,
+		},
+		{
+			name:    "capability not granted by proof",
+			token:   mintUCAN(t, delegate, UCANAlgMPC, claims(delegateDID, "did:web:app", exp, vaultAll, narrowProof)),
+			wantErr: true,
+		},
+		{
+			name:    "proof delegated to another audience",
+			token:   mintUCAN(t, other, UCANAlgMPC, claims(otherDID, "did:web:app", exp, vaultRead, proof)),
+			wantErr: true,
+		},
+		{
+			name:    "outlives proof",
+			token:   mintUCAN(t, delegate, UCANAlgMPC, claims(delegateDID, "did:web:app", exp+1, vaultRead, proof)),
+			wantErr: true,
+		},
+		{
+			name:    "proofs with different roots",
+			token:   mintUCAN(t, delegate, UCANAlgMPC, claims(delegateDID, "did:web:app", exp, vaultRead, proof, otherRoot)),
+			wantErr: true,
+		},
+		{
+			name:    "proof by CID",
+			token:   mintUCAN(t, delegate, UCANAlgMPC, claims(delegateDID, "did:web:app", exp, vaultRead, "bafyreib6ycyz6tvnrsumqmtxxsbrdqmyzi4jvqnkpyxnrnfj5srmxdpfxm")),
+			wantErr: true,
+		},
+		{
+			name:    "signed by another key",
+			token:   mintUCAN(t, other, UCANAlgMPC, claims(rootDID, delegateDID, exp, vaultAll)),
+			wantErr: true,
+		},
+		{
+			name:    "issuer is not did:sonr",
+			token:   mintUCAN(t, root, UCANAlgMPC, claims("did:key:z6Mk", delegateDID, exp, vaultAll)),
+			wantErr: true,
+		},
+		{
+			name:    "unsupported algorithm",
+			token:   mintUCAN(t, root, AlgES256K, claims(rootDID, delegateDID, exp, vaultAll)),
+			wantErr: true,
+		},
+		{
+			name:    "expired",
+			token:   mintUCAN(t, root, UCANAlgMPC, claims(rootDID, delegateDID, now.Unix(), vaultAll)),
+			wantErr: true,
+		},
+		{
+			name:    "no expiry",
+			token:   mintUCAN(t, root, UCANAlgMPC, claims(rootDID, delegateDID, 0, vaultAll)),
+			wantErr: true,
+		},
+		{
+			name:    "no audience",
+			token:   mintUCAN(t, root, UCANAlgMPC, claims(rootDID, "", exp, vaultAll)),
+			wantErr: true,
+		},
+		{
+			name:    "not yet valid",
+			token:   mintUCAN(t, root, UCANAlgMPC, map[string]any{"iss": rootDID, "aud": delegateDID, "exp": exp, "nbf": now.Add(time.Minute).Unix()}),
+			wantErr: true,
+		},
+		{
+			name:    "malformed",
+			token:   "not.a.ucan",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ucan, err := VerifyUCAN(tt.token, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyUCAN() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && ucan.Root() != tt.wantRoot {
+				t.Errorf("Root() = %s, want %s", ucan.Root(), tt.wantRoot)
+			}
+		})
+	}
+}
+
+func TestVerifyUCANProofDepth(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	key, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	did := motorDID(key.PubKey())
+	exp := now.Add(time.Hour).Unix()
+
+	// A chain one deeper than allowed, each token delegating to itself
+	token := mintUCAN(t, key, UCANAlgMPC, map[string]any{"iss": did, "aud": did, "exp": exp})
+	for i := 0; i <= maxUCANProofDepth; i++ {
+		token = mintUCAN(t, key, UCANAlgMPC, map[string]any{"iss": did, "aud": did, "exp": exp, "prf": []string{token}})
+	}
+	if _, err := VerifyUCAN(token, now); err == nil {
+		t.Fatal("VerifyUCAN() accepted a proof chain deeper than the maximum")
+	}
+}
+
+func TestPatternMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		value   string
+		want    bool
+	}{
+		{"*", "anything", true},
+		{"read", "read", true},
+		{"read", "write", false},
+		{"vault://alice/*", "vault://alice/docs", true},
+		{"vault://alice/*", "vault://bob/docs", false},
+		{"vault://alice/docs", "vault://alice/docs/secret", false},
+	}
+	for _, tt := range tests {
+		if got := patternMatches(tt.pattern, tt.value); got != tt.want {
+			t.Errorf("patternMatches(%q, %q) = %v, want %v", tt.pattern, tt.value, got, tt.want)
+		}
+	}
+}
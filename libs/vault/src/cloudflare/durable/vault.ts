@@ -14,6 +14,12 @@ import { getWasmExecScript } from "@sonr.io/sdk/wasm";
 
 const wasmExecScript = getWasmExecScript();
 
+/**
+ * Storage prefix for the expiry of OIDC entries, kept apart from the oidc:
+ * keys the provider lists
+ */
+const OIDC_EXPIRY_PREFIX = "oidc-expiry:";
+
 export interface VaultState {
   initialized: boolean;
   vaultId: string;
@@ -84,6 +90,9 @@ export class VaultDurable implements DurableObject {
 
       this.wasmInstance = instance;
 
+      // Persist OIDC codes, tokens and clients in Durable Object storage
+      this.installOIDCStorage();
+
       // Run the Go program (starts the HTTP server)
       // Don't await - it runs indefinitely
       go.run(instance);
@@ -111,6 +120,72 @@ export class VaultDurable implements DurableObject {
     }
   }
 
+  /**
+   * Expose Durable Object storage to the Go OIDC provider. The provider
+   * rejects expired entries itself; their expiry is recorded under
+   * OIDC_EXPIRY_PREFIX so the alarm can delete them.
+   */
+  private installOIDCStorage(): void {
+    const storage = this.state.storage;
+    (globalThis as Record<string, unknown>).vaultOIDCStorage = {
+      get: async (key: string) => (await storage.get<string>(key)) ?? null,
+      put: async (key: string, value: string, expiresAt: number) => {
+        await storage.put(key, value);
+        if (expiresAt > 0) {
+          await storage.put(OIDC_EXPIRY_PREFIX + key, expiresAt);
+          await this.scheduleSweep(expiresAt);
+        } else {
+          await storage.delete(OIDC_EXPIRY_PREFIX + key);
+        }
+      },
+      delete: (key: string) =>
+        storage.delete([key, OIDC_EXPIRY_PREFIX + key]),
+      list: async (prefix: string) =>
+        Array.from((await storage.list({ prefix })).keys()),
+    };
+  }
+
+  /**
+   * Move the alarm forward so it fires by the given time
+   */
+  private async scheduleSweep(at: number): Promise<void> {
+    const current = await this.state.storage.getAlarm();
+    if (current === null || current > at) {
+      await this.state.storage.setAlarm(at);
+    }
+  }
+
+  /**
+   * Delete expired OIDC entries and schedule the alarm for the next expiry
+   */
+  private async sweepExpiredOIDCEntries(): Promise<void> {
+    const storage = this.state.storage;
+    const now = Date.now();
+    const expired: string[] = [];
+    let next = 0;
+
+    const expiries = await storage.list<number>({ prefix: OIDC_EXPIRY_PREFIX });
+    for (const [marker, expiresAt] of expiries) {
+      if (expiresAt <= now) {
+        expired.push(marker.slice(OIDC_EXPIRY_PREFIX.length), marker);
+      } else if (next === 0 || expiresAt < next) {
+        next = expiresAt;
+      }
+    }
+
+    // delete() accepts at most 128 keys per call
+    for (let i = 0; i < expired.length; i += 128) {
+      await storage.delete(expired.slice(i, i + 128));
+    }
+    if (next > 0) {
+      await this.scheduleSweep(next);
+    }
+
+    console.log(
+      `[VaultDurable:${this.vaultId}] Swept ${expired.length / 2} expired OIDC entries`,
+    );
+  }
+
   /**
    * Handle HTTP requests
    */
@@ -181,7 +256,7 @@ export class VaultDurable implements DurableObject {
    */
   async alarm(): Promise<void> {
     console.log(`[VaultDurable:${this.vaultId}] Alarm triggered`);
-    // Could be used for cleanup, state sync, etc.
+    await this.sweepExpiredOIDCEntries();
   }
 
   /**